@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"compiler/token"
 	"fmt"
+	"math/big"
+	"strings"
 )
 
 // Node is the interface for all AST nodes.
@@ -42,13 +44,220 @@ func (p *Program) String() string {
 }
 
 type LetStatement struct {
+	Token      token.Token
+	Type       *TypeExpression // nil when the type is left to inference
 	Assignment AssignmentStatement
+	Public     bool // declared with `pub`, exported from its module
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return "let" }
 func (ls *LetStatement) String() string {
-	return fmt.Sprintf("let %s;", ls.Assignment.String())
+	var out bytes.Buffer
+	if ls.Public {
+		out.WriteString("pub ")
+	}
+	out.WriteString("let ")
+	if ls.Type != nil {
+		out.WriteString(ls.Type.String())
+		out.WriteString(" ")
+	}
+	out.WriteString(ls.Assignment.String())
+	out.WriteString(";")
+	return out.String()
+}
+
+// ConstStatement e.g. const limit = 10;
+type ConstStatement struct {
+	Token  token.Token
+	Name   *Identifier
+	Value  Expression
+	Public bool // declared with `pub`, exported from its module
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Lexeme }
+func (cs *ConstStatement) String() string {
+	s := fmt.Sprintf("const %s = %s;", cs.Name.String(), cs.Value.String())
+	if cs.Public {
+		return "pub " + s
+	}
+	return s
+}
+
+// TypeStatement declares a type name. type UserID = Integer; makes
+// UserID another name for Integer, while type Meters Integer; defines a
+// distinct type represented as an Integer.
+type TypeStatement struct {
+	Token  token.Token
+	Name   *Identifier
+	Type   *TypeExpression
+	Alias  bool
+	Public bool // declared with `pub`, exported from its module
+}
+
+func (ts *TypeStatement) statementNode()       {}
+func (ts *TypeStatement) TokenLiteral() string { return ts.Token.Lexeme }
+func (ts *TypeStatement) String() string {
+	s := fmt.Sprintf("type %s %s;", ts.Name.String(), ts.Type.String())
+	if ts.Alias {
+		s = fmt.Sprintf("type %s = %s;", ts.Name.String(), ts.Type.String())
+	}
+	if ts.Public {
+		return "pub " + s
+	}
+	return s
+}
+
+// RecordStatement declares a record type with named fields and the
+// methods called on its values. In a method, self is the record the
+// method was called on.
+//
+//	record Rect { Integer w; Integer h; func Integer area() { return self.w * self.h; } }
+type RecordStatement struct {
+	Token   token.Token
+	Name    *Identifier
+	Fields  []*Field
+	Methods []*FunctionalLiteral
+	Public  bool // declared with `pub`, exported from its module
+}
+
+func (rs *RecordStatement) statementNode()       {}
+func (rs *RecordStatement) TokenLiteral() string { return rs.Token.Lexeme }
+func (rs *RecordStatement) String() string {
+	var out bytes.Buffer
+	if rs.Public {
+		out.WriteString("pub ")
+	}
+	out.WriteString("record " + rs.Name.String() + " {")
+	for _, f := range rs.Fields {
+		out.WriteString(" " + f.String() + ";")
+	}
+	for _, m := range rs.Methods {
+		out.WriteString(" " + m.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+// Field is a field of a record.
+type Field struct {
+	Type *TypeExpression
+	Name *Identifier
+}
+
+func (f *Field) String() string { return f.Type.String() + " " + f.Name.String() }
+
+// InterfaceStatement declares an interface type: the methods a value
+// must have to be used as one. Any record with methods of the same
+// names and signatures implements it. The methods have no bodies.
+//
+//	interface Shape { Integer area(); }
+type InterfaceStatement struct {
+	Token   token.Token
+	Name    *Identifier
+	Methods []*FunctionalLiteral
+	Public  bool // declared with `pub`, exported from its module
+}
+
+func (is *InterfaceStatement) statementNode()       {}
+func (is *InterfaceStatement) TokenLiteral() string { return is.Token.Lexeme }
+func (is *InterfaceStatement) String() string {
+	var out bytes.Buffer
+	if is.Public {
+		out.WriteString("pub ")
+	}
+	out.WriteString("interface " + is.Name.String() + " {")
+	for _, m := range is.Methods {
+		out.WriteString(" " + m.Signature() + ";")
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+// SwitchStatement is a type switch. It runs the first case whose type
+// the subject has, with the subject bound to the case's name, or the
+// default case if none matches.
+//
+//	switch (shape) { case Circle c { ... } case Rect r { ... } default { ... } }
+type SwitchStatement struct {
+	Token   token.Token
+	Subject Expression
+	Cases   []*TypeCase
+	Default *BlockStatement // nil when there is no default case
+}
+
+func (ss *SwitchStatement) statementNode()       {}
+func (ss *SwitchStatement) TokenLiteral() string { return ss.Token.Lexeme }
+func (ss *SwitchStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("switch (" + ss.Subject.String() + ") {")
+	for _, c := range ss.Cases {
+		out.WriteString(" " + c.String())
+	}
+	if ss.Default != nil {
+		out.WriteString(" default " + ss.Default.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+// TypeCase is a case of a type switch.
+type TypeCase struct {
+	Token token.Token // the 'case' token
+	Type  *TypeExpression
+	Name  *Identifier // nil when the value is not bound
+	Body  *BlockStatement
+}
+
+func (tc *TypeCase) String() string {
+	if tc.Name == nil {
+		return "case " + tc.Type.String() + " " + tc.Body.String()
+	}
+	return "case " + tc.Type.String() + " " + tc.Name.String() + " " + tc.Body.String()
+}
+
+// SelectStatement waits until one of its cases can send or receive,
+// and runs that case, or runs the default case if none can right away.
+//
+//	select { case recv(c) v { ... } case send(out, x) { ... } default { ... } }
+type SelectStatement struct {
+	Token   token.Token
+	Cases   []*SelectCase
+	Default *BlockStatement // nil when select should wait
+}
+
+func (ss *SelectStatement) statementNode()       {}
+func (ss *SelectStatement) TokenLiteral() string { return ss.Token.Lexeme }
+func (ss *SelectStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("select {")
+	for _, c := range ss.Cases {
+		out.WriteString(" " + c.String())
+	}
+	if ss.Default != nil {
+		out.WriteString(" default " + ss.Default.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+// SelectCase is a case of a select statement: a call of send or recv.
+type SelectCase struct {
+	Token token.Token // the 'case' token
+	Call  *CallExpression
+	Name  *Identifier // for recv, the name bound to the value received
+	Body  *BlockStatement
+}
+
+// IsSend reports whether the case sends rather than receives.
+func (sc *SelectCase) IsSend() bool { return sc.Call.Function.String() == "send" }
+
+func (sc *SelectCase) String() string {
+	if sc.Name == nil {
+		return "case " + sc.Call.String() + " " + sc.Body.String()
+	}
+	return "case " + sc.Call.String() + " " + sc.Name.String() + " " + sc.Body.String()
 }
 
 type AssignmentStatement struct {
@@ -73,6 +282,7 @@ func (i *Identifier) String() string       { return i.Value }
 
 // IntegerLiteral is a number.
 type IntegerLiteral struct {
+	Token token.Token
 	Value int64
 }
 
@@ -80,8 +290,19 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return fmt.Sprintf("%d", il.Value) }
 func (il *IntegerLiteral) String() string       { return il.TokenLiteral() }
 
+// BigIntegerLiteral is an integer literal with the n suffix, e.g. 100n.
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (bl *BigIntegerLiteral) expressionNode()      {}
+func (bl *BigIntegerLiteral) TokenLiteral() string { return bl.Token.Lexeme }
+func (bl *BigIntegerLiteral) String() string       { return bl.Value.String() + "n" }
+
 // PrefixExpression e.g. -x
 type PrefixExpression struct {
+	Token    token.Token
 	Operator string     // e.g. "-"
 	Right    Expression // the sub‐expression
 }
@@ -99,9 +320,10 @@ func (pe *PrefixExpression) String() string {
 
 // InfixExpression e.g. x + y
 type InfixExpression struct {
-	Left     Expression // left‐hand side
-	Operator string     // e.g. "+"
-	Right    Expression // right‐hand side
+	Token    token.Token // the operator token
+	Left     Expression  // left‐hand side
+	Operator string      // e.g. "+"
+	Right    Expression  // right‐hand side
 }
 
 func (ie *InfixExpression) expressionNode()      {}
@@ -118,28 +340,89 @@ func (ie *InfixExpression) String() string {
 
 type FunctionStatement struct {
 	Literal *FunctionalLiteral
+	Public  bool // declared with `pub`, exported from its module
 }
 
 func (fs *FunctionStatement) statementNode()       {}
 func (fs *FunctionStatement) TokenLiteral() string { return fs.Literal.Token.Lexeme }
-func (fs *FunctionStatement) String() string       { return fs.Literal.String() }
+func (fs *FunctionStatement) String() string {
+	if fs.Public {
+		return "pub " + fs.Literal.String()
+	}
+	return fs.Literal.String()
+}
 
 type FunctionalLiteral struct {
-	Token        token.Token
-	ReturnType   string
-	FunctionName *Identifier
-	Parameters   []*Identifier
-	Body         *BlockStatement
+	Token          token.Token
+	ReturnType     *TypeExpression // nil when the function returns nothing
+	FunctionName   *Identifier
+	TypeParameters []*TypeParameter // e.g. [T Integer | String]
+	Parameters     []*Parameter
+	Body           *BlockStatement
+	Attributes     []string // e.g. "checked" for @checked
+
+	// Generator is set when the body yields. Calling a generator
+	// function returns a generator that runs the body lazily.
+	Generator bool
+
+	// Lambda is set for a function written as an expression, such as
+	// (x) => x * 2. Its body returns the expression after the arrow,
+	// and its FunctionName is "lambda", which declares nothing.
+	Lambda bool
 }
 
 func (fl *FunctionalLiteral) statementNode()       {}
+func (fl *FunctionalLiteral) expressionNode()      {}
 func (fl *FunctionalLiteral) TokenLiteral() string { return fl.Token.Lexeme }
 func (fl *FunctionalLiteral) String() string {
+	if fl.Lambda {
+		return fl.lambdaString()
+	}
 	var out bytes.Buffer
+	for _, attr := range fl.Attributes {
+		out.WriteString("@" + attr + " ")
+	}
 	out.WriteString("func ")
-	out.WriteString(fl.ReturnType)
+	out.WriteString(fl.Signature())
 	out.WriteString(" ")
+	out.WriteString(fl.Body.String())
+	return out.String()
+}
+
+// Signature returns the declaration of fl without `func` and the body,
+// as interfaces list their methods: Integer add(Integer a, Integer b).
+func (fl *FunctionalLiteral) Signature() string {
+	var out bytes.Buffer
+	if fl.ReturnType != nil {
+		out.WriteString(fl.ReturnType.String())
+		out.WriteString(" ")
+	}
 	out.WriteString(fl.FunctionName.String())
+	if len(fl.TypeParameters) > 0 {
+		out.WriteString("[")
+		for i, tp := range fl.TypeParameters {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			out.WriteString(tp.String())
+		}
+		out.WriteString("]")
+	}
+	out.WriteString("(")
+	for i, p := range fl.Parameters {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(p.String())
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+// lambdaString returns a lambda as it is written: (x) => (x * 2), or
+// with its body in braces if it is more than a returned expression.
+func (fl *FunctionalLiteral) lambdaString() string {
+	var out bytes.Buffer
 	out.WriteString("(")
 	for i, p := range fl.Parameters {
 		if i > 0 {
@@ -147,11 +430,34 @@ func (fl *FunctionalLiteral) String() string {
 		}
 		out.WriteString(p.String())
 	}
-	out.WriteString(") ")
+	out.WriteString(") => ")
+	if len(fl.Body.Statements) == 1 {
+		if rs, ok := fl.Body.Statements[0].(*ReturnStatement); ok && len(rs.ReturnValues) == 1 {
+			out.WriteString(rs.ReturnValues[0].String())
+			return out.String()
+		}
+	}
 	out.WriteString(fl.Body.String())
 	return out.String()
 }
 
+// HasAttribute reports whether fl is declared with @name.
+func (fl *FunctionalLiteral) HasAttribute(name string) bool {
+	for _, attr := range fl.Attributes {
+		if attr == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Variadic reports whether the last parameter of fl collects any
+// remaining arguments.
+func (fl *FunctionalLiteral) Variadic() bool {
+	n := len(fl.Parameters)
+	return n > 0 && fl.Parameters[n-1].Variadic
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
@@ -171,16 +477,30 @@ func (bs *BlockStatement) String() string {
 }
 
 type ReturnStatement struct {
-	Token       token.Token
-	ReturnValue Expression
+	Token        token.Token
+	ReturnValues []Expression // empty for a bare `return;`
 }
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Lexeme }
 func (rs *ReturnStatement) String() string {
-	return fmt.Sprintf("return %s;", rs.ReturnValue.String())
+	if len(rs.ReturnValues) == 0 {
+		return "return;"
+	}
+	return fmt.Sprintf("return %s;", joinExpressions(rs.ReturnValues))
+}
+
+// YieldStatement e.g. yield i; hands a value to the consumer of a
+// generator.
+type YieldStatement struct {
+	Token token.Token
+	Value Expression
 }
 
+func (ys *YieldStatement) statementNode()       {}
+func (ys *YieldStatement) TokenLiteral() string { return ys.Token.Lexeme }
+func (ys *YieldStatement) String() string       { return "yield " + ys.Value.String() + ";" }
+
 type CallExpression struct {
 	Token     token.Token // the '(' token
 	Function  Expression  // Identifier or FunctionLiteral
@@ -208,3 +528,346 @@ func (ce *CallExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+
+// ExpressionStatement wraps an expression used on its own, e.g. `f();`.
+type ExpressionStatement struct {
+	Token      token.Token
+	Expression Expression
+}
+
+func (es *ExpressionStatement) statementNode()       {}
+func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Lexeme }
+func (es *ExpressionStatement) String() string {
+	if es.Expression != nil {
+		return es.Expression.String() + ";"
+	}
+	return ""
+}
+
+// Boolean is `true` or `false`.
+type Boolean struct {
+	Token token.Token
+	Value bool
+}
+
+func (b *Boolean) expressionNode()      {}
+func (b *Boolean) TokenLiteral() string { return b.Token.Lexeme }
+func (b *Boolean) String() string       { return b.Token.Lexeme }
+
+// NullLiteral is `null`, the absence of a value of an optional type.
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (n *NullLiteral) expressionNode()      {}
+func (n *NullLiteral) TokenLiteral() string { return n.Token.Lexeme }
+func (n *NullLiteral) String() string       { return "null" }
+
+// IfStatement e.g. if (x < y) { ... } else { ... }
+type IfStatement struct {
+	Token       token.Token
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement // nil when there is no else branch
+}
+
+func (is *IfStatement) statementNode()       {}
+func (is *IfStatement) TokenLiteral() string { return is.Token.Lexeme }
+func (is *IfStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("if ")
+	out.WriteString(is.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(is.Consequence.String())
+	if is.Alternative != nil {
+		out.WriteString(" else ")
+		out.WriteString(is.Alternative.String())
+	}
+	return out.String()
+}
+
+// ImportStatement e.g. import "math"; or import "./util.blue";
+type ImportStatement struct {
+	Token token.Token
+	Path  string      // the path as written in the source
+	Name  *Identifier // the name the module is bound to
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Lexeme }
+func (is *ImportStatement) String() string {
+	return fmt.Sprintf("import %q;", is.Path)
+}
+
+// MemberExpression e.g. math.sqrt, or user?.name, which is null when
+// user is.
+type MemberExpression struct {
+	Token  token.Token // the '.' or '?.' token
+	Object Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Lexeme }
+func (me *MemberExpression) String() string {
+	return me.Object.String() + me.Token.Lexeme + me.Member.String()
+}
+
+// Safe reports whether the member is accessed with `?.`.
+func (me *MemberExpression) Safe() bool { return me.Token.Lexeme == "?." }
+
+// TypeExpression is a type as written in the source: a name such as
+// Integer, or a parenthesized list of types for multiple return values.
+// A trailing `?` makes it optional, so that it also admits null.
+type TypeExpression struct {
+	Token     token.Token
+	Name      string            // empty for a tuple
+	Arguments []*TypeExpression // type arguments, e.g. Integer in Result[Integer]
+	Elements  []*TypeExpression // the element types of a tuple
+	Optional  bool              // Integer?
+}
+
+func (te *TypeExpression) TokenLiteral() string { return te.Token.Lexeme }
+func (te *TypeExpression) String() string {
+	if te == nil {
+		return ""
+	}
+	if te.Optional {
+		return te.base() + "?"
+	}
+	return te.base()
+}
+
+func (te *TypeExpression) base() string {
+	if te.Name != "" && len(te.Arguments) == 0 {
+		return te.Name
+	}
+	var out bytes.Buffer
+	if te.Name != "" {
+		out.WriteString(te.Name)
+		out.WriteString("[")
+		for i, arg := range te.Arguments {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			out.WriteString(arg.String())
+		}
+		out.WriteString("]")
+		return out.String()
+	}
+	out.WriteString("(")
+	for i, el := range te.Elements {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(el.String())
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+// StringLiteral e.g. "hello"
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Lexeme }
+func (sl *StringLiteral) String() string       { return fmt.Sprintf("%q", sl.Value) }
+
+// DestructureStatement binds the elements of a tuple to several names,
+// e.g. let q, r = divmod(7, 2);
+type DestructureStatement struct {
+	Token token.Token // the 'let' token
+	Names []*Identifier
+	Value Expression
+}
+
+func (ds *DestructureStatement) statementNode()       {}
+func (ds *DestructureStatement) TokenLiteral() string { return ds.Token.Lexeme }
+func (ds *DestructureStatement) String() string {
+	names := make([]string, len(ds.Names))
+	for i, n := range ds.Names {
+		names[i] = n.String()
+	}
+	return fmt.Sprintf("let %s = %s;", strings.Join(names, ", "), ds.Value.String())
+}
+
+func joinExpressions(exps []Expression) string {
+	parts := make([]string, len(exps))
+	for i, e := range exps {
+		parts[i] = e.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Parameter is a function parameter with an optional type, e.g. `T a`.
+type Parameter struct {
+	Name     *Identifier
+	Type     *TypeExpression // nil when the parameter is untyped
+	Variadic bool            // ...Integer nums, collecting the remaining arguments
+}
+
+func (p *Parameter) TokenLiteral() string { return p.Name.TokenLiteral() }
+func (p *Parameter) String() string {
+	prefix := ""
+	if p.Variadic {
+		prefix = "..."
+	}
+	if p.Type == nil {
+		return prefix + p.Name.String()
+	}
+	return prefix + p.Type.String() + " " + p.Name.String()
+}
+
+// TypeParameter declares a type variable of a generic function together
+// with the types it may stand for. An empty constraint allows any type.
+type TypeParameter struct {
+	Name       *Identifier
+	Constraint []*TypeExpression
+}
+
+func (tp *TypeParameter) TokenLiteral() string { return tp.Name.TokenLiteral() }
+func (tp *TypeParameter) String() string {
+	if len(tp.Constraint) == 0 {
+		return tp.Name.String()
+	}
+	types := make([]string, len(tp.Constraint))
+	for i, t := range tp.Constraint {
+		types[i] = t.String()
+	}
+	return tp.Name.String() + " " + strings.Join(types, " | ")
+}
+
+// TryExpression is the postfix `?` operator, e.g. parse(s)?
+type TryExpression struct {
+	Token      token.Token // the '?' token
+	Expression Expression
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Lexeme }
+func (te *TryExpression) String() string       { return te.Expression.String() + "?" }
+
+// SpawnStatement e.g. spawn fetch(url); runs a call concurrently with
+// the code that spawned it.
+type SpawnStatement struct {
+	Token token.Token
+	Call  *CallExpression
+}
+
+func (ss *SpawnStatement) statementNode()       {}
+func (ss *SpawnStatement) TokenLiteral() string { return ss.Token.Lexeme }
+func (ss *SpawnStatement) String() string       { return "spawn " + ss.Call.String() + ";" }
+
+// ChannelExpression e.g. chan[Integer](10) makes a channel. Without a
+// capacity, chan[Integer]() makes an unbuffered one.
+type ChannelExpression struct {
+	Token    token.Token     // the 'chan' token
+	Type     *TypeExpression // chan[T]
+	Capacity Expression      // nil for an unbuffered channel
+}
+
+func (ce *ChannelExpression) expressionNode()      {}
+func (ce *ChannelExpression) TokenLiteral() string { return ce.Token.Lexeme }
+func (ce *ChannelExpression) String() string {
+	if ce.Capacity == nil {
+		return ce.Type.String() + "()"
+	}
+	return ce.Type.String() + "(" + ce.Capacity.String() + ")"
+}
+
+// DeferStatement e.g. defer close(f);
+type DeferStatement struct {
+	Token token.Token
+	Call  *CallExpression
+}
+
+func (ds *DeferStatement) statementNode()       {}
+func (ds *DeferStatement) TokenLiteral() string { return ds.Token.Lexeme }
+func (ds *DeferStatement) String() string       { return "defer " + ds.Call.String() + ";" }
+
+// ForStatement e.g. for (i < 10) { ... }, for (i in 0..10) { ... } or,
+// without a condition, for { ... }
+type ForStatement struct {
+	Token     token.Token
+	Condition Expression // nil when the loop only ends by break or return
+	Body      *BlockStatement
+
+	// Variable and Iterable are set for a for-in loop, which binds
+	// Variable to each element of Iterable in turn.
+	Variable *Identifier
+	Iterable Expression
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Lexeme }
+func (fs *ForStatement) String() string {
+	if fs.Iterable != nil {
+		return "for (" + fs.Variable.String() + " in " + fs.Iterable.String() + ") " + fs.Body.String()
+	}
+	if fs.Condition == nil {
+		return "for " + fs.Body.String()
+	}
+	return "for " + fs.Condition.String() + " " + fs.Body.String()
+}
+
+// BranchStatement is `break` or `continue`.
+type BranchStatement struct {
+	Token token.Token
+}
+
+func (bs *BranchStatement) statementNode()       {}
+func (bs *BranchStatement) TokenLiteral() string { return bs.Token.Lexeme }
+func (bs *BranchStatement) String() string       { return bs.Token.Lexeme + ";" }
+
+// MacroStatement e.g. macro unless(cond, body) { ... } declares a macro.
+// A call of the macro is replaced, before the program runs, by the
+// code the macro's body returns. The parameters are bound to the
+// call's arguments unevaluated, as quoted code.
+type MacroStatement struct {
+	Token      token.Token
+	Name       *Identifier
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ms *MacroStatement) statementNode()       {}
+func (ms *MacroStatement) TokenLiteral() string { return ms.Token.Lexeme }
+func (ms *MacroStatement) String() string {
+	params := make([]string, len(ms.Parameters))
+	for i, p := range ms.Parameters {
+		params[i] = p.String()
+	}
+	return "macro " + ms.Name.String() + "(" + strings.Join(params, ", ") + ") " + ms.Body.String()
+}
+
+// QuoteExpression e.g. quote(a + unquote(b)) or quote { ... } is code
+// as a value. Each unquote(e) inside it is replaced by the value of e
+// when the quote is evaluated.
+type QuoteExpression struct {
+	Token token.Token // the 'quote' token
+	Node  Node        // an Expression, or a *BlockStatement of statements
+}
+
+func (qe *QuoteExpression) expressionNode()      {}
+func (qe *QuoteExpression) TokenLiteral() string { return qe.Token.Lexeme }
+func (qe *QuoteExpression) String() string {
+	if b, ok := qe.Node.(*BlockStatement); ok {
+		return "quote " + b.String()
+	}
+	return "quote(" + qe.Node.String() + ")"
+}
+
+// ComptimeExpression e.g. comptime { return fib(20) } is evaluated while
+// the program is compiled and replaced by a literal of its value, which
+// is what the block returns, or else the value of its last statement.
+type ComptimeExpression struct {
+	Token token.Token // the 'comptime' token
+	Block *BlockStatement
+}
+
+func (ce *ComptimeExpression) expressionNode()      {}
+func (ce *ComptimeExpression) TokenLiteral() string { return ce.Token.Lexeme }
+func (ce *ComptimeExpression) String() string       { return "comptime " + ce.Block.String() }
@@ -0,0 +1,280 @@
+package ast
+
+// ModifierFunc is called by Modify on each node of a tree, after the
+// node's children, and returns the node to put in its place.
+type ModifierFunc func(Node) Node
+
+// Modify returns a copy of the tree rooted at node in which every node
+// has been replaced by what modifier returns for it, children first.
+// node itself is left unchanged. Besides expressions and statements,
+// modifier is called on the identifiers that statements and parameters
+// declare, but not on the names of functions, types, record members or
+// on type expressions, which are shared with node. The code inside a
+// quote expression is not modified either.
+//
+// In a list of statements, a statement that modifier replaces with a
+// *BlockStatement is replaced by the block's statements. Where a single
+// expression or statement is expected, a replacement of another kind
+// is ignored.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		c := *n
+		c.Statements = modifyStatements(n.Statements, modifier)
+		return modifier(&c)
+
+	case *BlockStatement:
+		c := *n
+		c.Statements = modifyStatements(n.Statements, modifier)
+		return modifier(&c)
+
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = modifyExpression(n.Expression, modifier)
+		return modifier(&c)
+
+	case *LetStatement:
+		c := *n
+		c.Assignment.Name = modifyIdentifier(n.Assignment.Name, modifier)
+		c.Assignment.Value = modifyExpression(n.Assignment.Value, modifier)
+		return modifier(&c)
+
+	case *ConstStatement:
+		c := *n
+		c.Name = modifyIdentifier(n.Name, modifier)
+		c.Value = modifyExpression(n.Value, modifier)
+		return modifier(&c)
+
+	case *DestructureStatement:
+		c := *n
+		c.Names = make([]*Identifier, len(n.Names))
+		for i, name := range n.Names {
+			c.Names[i] = modifyIdentifier(name, modifier)
+		}
+		c.Value = modifyExpression(n.Value, modifier)
+		return modifier(&c)
+
+	case *AssignmentStatement:
+		c := *n
+		c.Name = modifyIdentifier(n.Name, modifier)
+		c.Value = modifyExpression(n.Value, modifier)
+		return modifier(&c)
+
+	case *ReturnStatement:
+		c := *n
+		c.ReturnValues = modifyExpressions(n.ReturnValues, modifier)
+		return modifier(&c)
+
+	case *YieldStatement:
+		c := *n
+		c.Value = modifyExpression(n.Value, modifier)
+		return modifier(&c)
+
+	case *DeferStatement:
+		c := *n
+		c.Call = modifyCall(n.Call, modifier)
+		return modifier(&c)
+
+	case *SpawnStatement:
+		c := *n
+		c.Call = modifyCall(n.Call, modifier)
+		return modifier(&c)
+
+	case *IfStatement:
+		c := *n
+		c.Condition = modifyExpression(n.Condition, modifier)
+		c.Consequence = modifyBlock(n.Consequence, modifier)
+		if n.Alternative != nil {
+			c.Alternative = modifyBlock(n.Alternative, modifier)
+		}
+		return modifier(&c)
+
+	case *ForStatement:
+		c := *n
+		if n.Variable != nil {
+			c.Variable = modifyIdentifier(n.Variable, modifier)
+		}
+		if n.Iterable != nil {
+			c.Iterable = modifyExpression(n.Iterable, modifier)
+		}
+		if n.Condition != nil {
+			c.Condition = modifyExpression(n.Condition, modifier)
+		}
+		c.Body = modifyBlock(n.Body, modifier)
+		return modifier(&c)
+
+	case *SwitchStatement:
+		c := *n
+		c.Subject = modifyExpression(n.Subject, modifier)
+		c.Cases = make([]*TypeCase, len(n.Cases))
+		for i, tc := range n.Cases {
+			cc := *tc
+			if tc.Name != nil {
+				cc.Name = modifyIdentifier(tc.Name, modifier)
+			}
+			cc.Body = modifyBlock(tc.Body, modifier)
+			c.Cases[i] = &cc
+		}
+		if n.Default != nil {
+			c.Default = modifyBlock(n.Default, modifier)
+		}
+		return modifier(&c)
+
+	case *SelectStatement:
+		c := *n
+		c.Cases = make([]*SelectCase, len(n.Cases))
+		for i, sc := range n.Cases {
+			cc := *sc
+			cc.Call = modifyCall(sc.Call, modifier)
+			if sc.Name != nil {
+				cc.Name = modifyIdentifier(sc.Name, modifier)
+			}
+			cc.Body = modifyBlock(sc.Body, modifier)
+			c.Cases[i] = &cc
+		}
+		if n.Default != nil {
+			c.Default = modifyBlock(n.Default, modifier)
+		}
+		return modifier(&c)
+
+	case *FunctionStatement:
+		c := *n
+		if fl, ok := Modify(n.Literal, modifier).(*FunctionalLiteral); ok {
+			c.Literal = fl
+		}
+		return modifier(&c)
+
+	case *RecordStatement:
+		c := *n
+		c.Methods = make([]*FunctionalLiteral, len(n.Methods))
+		for i, m := range n.Methods {
+			c.Methods[i] = m
+			if fl, ok := Modify(m, modifier).(*FunctionalLiteral); ok {
+				c.Methods[i] = fl
+			}
+		}
+		return modifier(&c)
+
+	case *MacroStatement:
+		c := *n
+		c.Parameters = make([]*Identifier, len(n.Parameters))
+		for i, p := range n.Parameters {
+			c.Parameters[i] = modifyIdentifier(p, modifier)
+		}
+		c.Body = modifyBlock(n.Body, modifier)
+		return modifier(&c)
+
+	case *FunctionalLiteral:
+		c := *n
+		c.Parameters = make([]*Parameter, len(n.Parameters))
+		for i, p := range n.Parameters {
+			cp := *p
+			cp.Name = modifyIdentifier(p.Name, modifier)
+			c.Parameters[i] = &cp
+		}
+		c.Body = modifyBlock(n.Body, modifier)
+		return modifier(&c)
+
+	case *PrefixExpression:
+		c := *n
+		c.Right = modifyExpression(n.Right, modifier)
+		return modifier(&c)
+
+	case *InfixExpression:
+		c := *n
+		c.Left = modifyExpression(n.Left, modifier)
+		c.Right = modifyExpression(n.Right, modifier)
+		return modifier(&c)
+
+	case *CallExpression:
+		c := *n
+		c.Function = modifyExpression(n.Function, modifier)
+		c.Arguments = modifyExpressions(n.Arguments, modifier)
+		return modifier(&c)
+
+	case *MemberExpression:
+		c := *n
+		c.Object = modifyExpression(n.Object, modifier)
+		return modifier(&c)
+
+	case *TryExpression:
+		c := *n
+		c.Expression = modifyExpression(n.Expression, modifier)
+		return modifier(&c)
+
+	case *ChannelExpression:
+		c := *n
+		if n.Capacity != nil {
+			c.Capacity = modifyExpression(n.Capacity, modifier)
+		}
+		return modifier(&c)
+
+	case *QuoteExpression:
+		c := *n
+		return modifier(&c)
+
+	case *ComptimeExpression:
+		c := *n
+		c.Block = modifyBlock(n.Block, modifier)
+		return modifier(&c)
+
+	case *Identifier:
+		c := *n
+		return modifier(&c)
+	}
+	return modifier(node)
+}
+
+func modifyStatements(stmts []Statement, modifier ModifierFunc) []Statement {
+	out := make([]Statement, 0, len(stmts))
+	for _, s := range stmts {
+		switch m := Modify(s, modifier).(type) {
+		case *BlockStatement:
+			out = append(out, m.Statements...)
+		case Statement:
+			out = append(out, m)
+		default:
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func modifyExpressions(exprs []Expression, modifier ModifierFunc) []Expression {
+	out := make([]Expression, len(exprs))
+	for i, e := range exprs {
+		out[i] = modifyExpression(e, modifier)
+	}
+	return out
+}
+
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+	if e == nil {
+		return nil
+	}
+	if m, ok := Modify(e, modifier).(Expression); ok {
+		return m
+	}
+	return e
+}
+
+func modifyIdentifier(id *Identifier, modifier ModifierFunc) *Identifier {
+	if m, ok := Modify(id, modifier).(*Identifier); ok {
+		return m
+	}
+	return id
+}
+
+func modifyCall(call *CallExpression, modifier ModifierFunc) *CallExpression {
+	if m, ok := Modify(call, modifier).(*CallExpression); ok {
+		return m
+	}
+	return call
+}
+
+func modifyBlock(b *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if m, ok := Modify(b, modifier).(*BlockStatement); ok {
+		return m
+	}
+	return b
+}
@@ -2,24 +2,37 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
+	"compiler/ast"
 	"compiler/environment"
 	"compiler/evaluator"
+	"compiler/flow"
 	"compiler/lexer"
 	"compiler/parser"
+	"compiler/resolver"
+	"compiler/types"
 )
 
 func main() {
-	// 1) Locate your source file
-	wd, err := os.Getwd()
-	if err != nil {
-		log.Fatalf("could not get working directory: %v", err)
+	dumpAST := flag.Bool("ast", false, "print the parsed AST before running")
+	checked := flag.Bool("checked", false, "make integer overflow a runtime error in every function")
+	searchPath := flag.String("path", "", "list of directories searched for imports, separated by the OS path list separator")
+	flag.Parse()
+
+	// 1) Locate your source file: the first argument, or files/main.blue
+	path := flag.Arg(0)
+	if path == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("could not get working directory: %v", err)
+		}
+		path = filepath.Join(wd, "files", "main.blue")
 	}
-	path := filepath.Join(wd, "files", "main.blue")
 
 	// 2) Read it all in one shot
 	data, err := os.ReadFile(path)
@@ -32,17 +45,87 @@ func main() {
 	l := lexer.New(source)
 	p := parser.New(l)
 	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, msg := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, msg)
+		}
+		os.Exit(1)
+	}
+	program, macroErrs := evaluator.ExpandMacros(program)
+	if len(macroErrs) > 0 {
+		fail(path, macroErrs)
+	}
+	if _, errs := resolver.Resolve(program); len(errs) > 0 {
+		fail(path, errs)
+	}
+
+	// 4) Imports are looked up in -path, then $BLUEPATH, then next to
+	// the entry file. The uses of imported modules are checked against
+	// what they export.
+	loader := evaluator.Modules
+	loader.SearchPath = append(loader.SearchPath, filepath.SplitList(*searchPath)...)
+	loader.SearchPath = append(loader.SearchPath, filepath.SplitList(os.Getenv("BLUEPATH"))...)
+	loader.SearchPath = append(loader.SearchPath, filepath.Dir(path))
+	importer := loader.Importer(path)
+
+	// The code in comptime blocks is checked before it runs, and the
+	// program again once the blocks are replaced by their values.
+	check(path, program, importer)
+	evaluator.CheckedArithmetic = *checked
+	program, comptimeErrs := evaluator.Comptime(program)
+	if len(comptimeErrs) > 0 {
+		fail(path, comptimeErrs)
+	}
+	check(path, program, importer)
 
 	// (Optional) dump the AST for debugging
-	astJSON, _ := json.MarshalIndent(program, "", "  ")
-	fmt.Printf("AST:\n%s\n", astJSON)
+	if *dumpAST {
+		astJSON, _ := json.MarshalIndent(program, "", "  ")
+		fmt.Printf("AST:\n%s\n", astJSON)
+	}
 
-	// 4) Evaluate in a fresh environment
+	// 5) Evaluate in a fresh environment and run main; its return
+	// value becomes the exit code.
 	env := environment.NewEnvironment()
-	result := evaluator.Eval(program, env)
-	if result != nil {
-		fmt.Printf("Result: %s\n", result.Inspect())
-	} else {
-		fmt.Println("Result: <nil>")
+	os.Exit(exitCode(loader.RunFile(path, program, env)))
+}
+
+// check reports the type and control-flow errors in program, and exits
+// if there are any.
+func check(path string, program *ast.Program, importer types.Importer) {
+	typeErrs := types.CheckImports(program, nil, importer)
+	flowErrs := flow.Check(program)
+	if len(typeErrs) > 0 || len(flowErrs) > 0 {
+		report(path, typeErrs)
+		fail(path, flowErrs)
+	}
+}
+
+func report[E error](path string, errs []E) {
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+	}
+}
+
+func fail[E error](path string, errs []E) {
+	report(path, errs)
+	os.Exit(1)
+}
+
+func exitCode(result environment.Object) int {
+	switch result := result.(type) {
+	case nil, *environment.Null:
+		return 0
+	case *environment.Integer:
+		return int(result.Value)
+	case *environment.Error:
+		fmt.Fprintln(os.Stderr, result.Inspect())
+		return 1
+	case *environment.Panic:
+		fmt.Fprintln(os.Stderr, result.Inspect())
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "main must return INTEGER, got %s\n", result.Type())
+		return 1
 	}
 }
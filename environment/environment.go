@@ -1,25 +1,211 @@
 package environment
 
+import (
+	"fmt"
+	"sync"
+)
+
+// Environment is one scope of variables. Spawned tasks may share
+// environments, so every read and write of a variable is atomic: a
+// task sees either the old or the new value of a variable another task
+// assigns, never a mix. A read followed by a write, as in x = x + 1, is
+// not atomic as a whole; tasks that update shared variables should
+// coordinate through channels.
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	mu     sync.RWMutex
+	store  map[string]Object
+	consts map[string]bool
+	outer  *Environment
+	frame  *Frame // set on the environment a function call starts in
+
+	// limits is set on the environments of code evaluated while the
+	// program is compiled, which must have no effects beyond the value
+	// it computes. It is shared with the environments enclosed by the
+	// restricted one.
+	limits *Limits
+
+	// imports is the chain of files whose imports led to the module the
+	// environment belongs to, from the entry file to the module's own.
+	// It is shared with the environments enclosed by the module's.
+	imports []string
+}
+
+// Limits bounds the work of code evaluated while the program is
+// compiled, so that code that never finishes is reported rather than
+// run forever.
+type Limits struct {
+	Steps int // the loop iterations and calls the code may still take
+	Depth int // how many more calls may be nested in the running one
+}
+
+// Frame is the state of one function call, shared by every scope in the
+// function's body.
+type Frame struct {
+	// Deferred holds the calls registered with `defer`, in the order
+	// they were registered.
+	Deferred []func() Object
+	// Panic is the panic unwinding this call while its deferred calls
+	// run; recovering clears it.
+	Panic *Panic
+	// DeferredBy is, for a deferred call, the frame that deferred it.
+	DeferredBy *Frame
+	// Checked is set when the function was declared @checked, making
+	// integer overflow in its body panic.
+	Checked bool
+	// Yield is set for a call of a generator function. It hands a value
+	// to the generator's consumer and waits until the next value is
+	// asked for, returning false if the generator is closed instead.
+	Yield func(Object) bool
+	// Task is the spawned task the call runs in, nil in the main
+	// program.
+	Task *Task
+	// Depth is the number of calls the call is nested in, itself
+	// included.
+	Depth int
+	// Generator is, in the body of a generator and the calls made from
+	// it, the evaluator's handle on the generator running that body;
+	// nil elsewhere.
+	Generator interface{}
+}
+
+// Task is a call started by spawn. It keeps track of the tasks it
+// spawns in turn.
+type Task struct {
+	mu       sync.Mutex
+	children int           // the tasks spawned from this one that have not finished
+	idle     chan struct{} // closed when the last of them finishes
+	failure  Object
+}
+
+// Spawned records that a task spawned from t has started.
+func (t *Task) Spawned() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.children == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.children++
+}
+
+// Finished records that a task spawned from t has finished.
+func (t *Task) Finished() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.children--
+	if t.children == 0 {
+		close(t.idle)
+	}
+}
+
+// Idle returns a channel that is closed once no task spawned from t,
+// up to now, is still running.
+func (t *Task) Idle() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.children == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	return t.idle
+}
+
+// Fail records that a task spawned from t failed with obj, an error or
+// a panic. Only the first failure is kept.
+func (t *Task) Fail(obj Object) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failure == nil {
+		t.failure = obj
+	}
+}
+
+// Failure returns the failure recorded since it was last asked for, or
+// nil.
+func (t *Task) Failure() Object {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	obj := t.failure
+	t.failure = nil
+	return obj
 }
 
 func NewEnvironment() *Environment {
 	return &Environment{
-		store: make(map[string]Object),
-		outer: nil,
+		store:  make(map[string]Object),
+		consts: make(map[string]bool),
+		outer:  nil,
 	}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	if outer != nil {
+		env.limits = outer.limits
+		env.imports = outer.imports
+	}
+	return env
+}
+
+// SetImports records that e is the environment of a module loaded
+// through the chain of imports files, which ends with its own file.
+func (e *Environment) SetImports(files []string) {
+	e.imports = files
+}
+
+// Imports returns the chain of files whose imports led to the module
+// e belongs to, or nil if e belongs to no file.
+func (e *Environment) Imports() []string {
+	return e.imports
+}
+
+// NewRestrictedEnvironment returns an environment enclosed by outer, which
+// may be nil, for code evaluated while the program is compiled. Code
+// running in it, or in any environment it encloses, may not start tasks,
+// use channels or import modules, and must stay within limits.
+func NewRestrictedEnvironment(outer *Environment, limits Limits) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.limits = &limits
+	return env
+}
+
+// Restricted reports whether e is a restricted environment or enclosed
+// by one.
+func (e *Environment) Restricted() bool {
+	return e.limits != nil
+}
+
+// Limits returns what is left of the limits of the restricted
+// environment e is, or is enclosed by, or nil if there is none.
+func (e *Environment) Limits() *Limits {
+	return e.limits
+}
+
+// NewCallEnvironment returns the environment a function call with the
+// given frame starts in.
+func NewCallEnvironment(outer *Environment, frame *Frame) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.frame = frame
 	return env
 }
 
+// Frame returns the frame of the innermost function call e belongs to,
+// or nil outside of any call.
+func (e *Environment) Frame() *Frame {
+	for env := e; env != nil; env = env.outer {
+		if env.frame != nil {
+			return env.frame
+		}
+	}
+	return nil
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
-	if val, ok := e.store[name]; ok {
+	e.mu.RLock()
+	val, ok := e.store[name]
+	e.mu.RUnlock()
+	if ok {
 		return val, true
 	}
 	if e.outer != nil {
@@ -28,7 +214,40 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return nil, false
 }
 
+// Set declares name in this scope, shadowing any outer declaration.
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.store[name] = val
+	delete(e.consts, name)
+	return val
+}
+
+// SetConst declares name in this scope as a constant that Assign will
+// refuse to change.
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.store[name] = val
+	e.consts[name] = true
 	return val
 }
+
+// Assign updates name in the scope where it was declared. It fails if
+// name was never declared or is a constant.
+func (e *Environment) Assign(name string, val Object) error {
+	e.mu.Lock()
+	if _, ok := e.store[name]; ok {
+		defer e.mu.Unlock()
+		if e.consts[name] {
+			return fmt.Errorf("cannot assign to constant %s", name)
+		}
+		e.store[name] = val
+		return nil
+	}
+	e.mu.Unlock()
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return fmt.Errorf("cannot assign to undeclared variable %s", name)
+}
@@ -2,17 +2,35 @@ package environment
 
 import (
 	"compiler/ast"
+	"compiler/token"
 	"fmt"
+	"math/big"
+	"strings"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	STRING_OBJ       = "STRING"
+	TUPLE_OBJ        = "TUPLE"
 	NULL_OBJ         = "NULL"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	MODULE_OBJ       = "MODULE"
+	BUILTIN_OBJ      = "BUILTIN"
+	RESULT_OBJ       = "RESULT"
+	PANIC_OBJ        = "PANIC"
+	BRANCH_OBJ       = "BRANCH"
+	BIG_INTEGER_OBJ  = "BIG_INTEGER"
+	TYPE_OBJ         = "TYPE"
+	RANGE_OBJ        = "RANGE"
+	GENERATOR_OBJ    = "GENERATOR"
+	CHANNEL_OBJ      = "CHANNEL"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
 )
 
 type Object interface {
@@ -27,6 +45,116 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// BigInteger is an integer of any size.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (b *BigInteger) Type() ObjectType { return BIG_INTEGER_OBJ }
+func (b *BigInteger) Inspect() string  { return b.Value.String() }
+
+// IntKind describes a fixed-width integer type such as Int32.
+type IntKind struct {
+	Name   string
+	Bits   int
+	Signed bool
+}
+
+var (
+	Int8   = &IntKind{Name: "Int8", Bits: 8, Signed: true}
+	Int16  = &IntKind{Name: "Int16", Bits: 16, Signed: true}
+	Int32  = &IntKind{Name: "Int32", Bits: 32, Signed: true}
+	Int64  = &IntKind{Name: "Int64", Bits: 64, Signed: true}
+	UInt8  = &IntKind{Name: "UInt8", Bits: 8}
+	UInt16 = &IntKind{Name: "UInt16", Bits: 16}
+	UInt32 = &IntKind{Name: "UInt32", Bits: 32}
+	UInt64 = &IntKind{Name: "UInt64", Bits: 64}
+)
+
+// IntKinds maps the name of each fixed-width integer type, including
+// Byte, an alias of UInt8, to its kind.
+var IntKinds = map[string]*IntKind{
+	"Int8": Int8, "Int16": Int16, "Int32": Int32, "Int64": Int64,
+	"UInt8": UInt8, "UInt16": UInt16, "UInt32": UInt32, "UInt64": UInt64,
+	"Byte": UInt8,
+}
+
+// Big returns the number v, a value of kind k, stands for. UInt64
+// values above the int64 range are stored as their bit pattern.
+func (k *IntKind) Big(v int64) *big.Int {
+	if !k.Signed && k.Bits == 64 {
+		return new(big.Int).SetUint64(uint64(v))
+	}
+	return big.NewInt(v)
+}
+
+// Wrap reduces n to the range of k the way two's complement hardware
+// does, and reports whether n was already in range.
+func (k *IntKind) Wrap(n *big.Int) (v int64, fits bool) {
+	modulus := new(big.Int).Lsh(big.NewInt(1), uint(k.Bits))
+	u := new(big.Int).Mod(n, modulus) // in [0, 2^Bits)
+	if k.Signed && u.Bit(k.Bits-1) == 1 {
+		u.Sub(u, modulus)
+	}
+	fits = u.Cmp(n) == 0
+	if !k.Signed && k.Bits == 64 {
+		return int64(u.Uint64()), fits
+	}
+	return u.Int64(), fits
+}
+
+// SizedInteger is a value of a fixed-width integer type.
+type SizedInteger struct {
+	Kind  *IntKind
+	Value int64
+}
+
+func (s *SizedInteger) Type() ObjectType { return ObjectType(strings.ToUpper(s.Kind.Name)) }
+func (s *SizedInteger) Inspect() string  { return s.Kind.Big(s.Value).String() }
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// Tuple holds the values of a function that returns more than one.
+type Tuple struct {
+	Elements []Object
+}
+
+func (t *Tuple) Type() ObjectType { return TUPLE_OBJ }
+func (t *Tuple) Inspect() string {
+	parts := make([]string, len(t.Elements))
+	for i, el := range t.Elements {
+		parts[i] = el.Inspect()
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func (t *Tuple) Iterator() Iterator { return &tupleIterator{elements: t.Elements} }
+
+type tupleIterator struct {
+	elements []Object
+}
+
+func (it *tupleIterator) Next() (Object, bool) {
+	if len(it.elements) == 0 {
+		return nil, false
+	}
+	el := it.elements[0]
+	it.elements = it.elements[1:]
+	return el, true
+}
+
 type Null struct{}
 
 func (n *Null) Type() ObjectType { return NULL_OBJ }
@@ -48,12 +176,15 @@ func (f *Function) Type() ObjectType {
 	return FUNCTION_OBJ
 }
 func (f *Function) Inspect() string {
+	if f.Literal.Lambda {
+		return f.Literal.String()
+	}
 	// you could print its signature & body:
 	return fmt.Sprintf("%s %s %s %s",
-		f.Literal.Token.Lexeme,       // "func"
-		f.Literal.ReturnType,         // e.g. "Integer"
-		f.Literal.FunctionName.Value, // function name
-		f.Literal.Body.String(),      // the "{ … }"
+		f.Literal.Token.Lexeme,        // "func"
+		f.Literal.ReturnType.String(), // e.g. "Integer"
+		f.Literal.FunctionName.Value,  // function name
+		f.Literal.Body.String(),       // the "{ … }"
 	)
 }
 
@@ -68,3 +199,273 @@ func (rv *ReturnValue) Type() ObjectType {
 func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
+
+// Module is an imported file. Only its exported names are reachable
+// from the importing file.
+type Module struct {
+	Name    string
+	Path    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module %s", m.Name) }
+
+type BuiltinFunction func(args ...Object) Object
+
+// Builtin is a function implemented by the interpreter.
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
+
+// Result is the outcome of an operation that can fail: either Ok with a
+// Value, or Err with the Value describing what went wrong.
+type Result struct {
+	Ok    bool
+	Value Object
+}
+
+func (r *Result) Type() ObjectType { return RESULT_OBJ }
+func (r *Result) Inspect() string {
+	if r.Ok {
+		return "Ok(" + r.Value.Inspect() + ")"
+	}
+	return "Err(" + r.Value.Inspect() + ")"
+}
+
+// Panic is a Blue panic unwinding the call stack. Trace lists the calls
+// it has unwound through, innermost first.
+type Panic struct {
+	Value Object
+	Trace []string
+}
+
+// traceEnds is how many of the innermost and of the outermost calls
+// of a long trace Inspect lists, leaving out those in between.
+const traceEnds = 20
+
+func (p *Panic) Type() ObjectType { return PANIC_OBJ }
+func (p *Panic) Inspect() string {
+	var out strings.Builder
+	out.WriteString("panic: ")
+	out.WriteString(p.Value.Inspect())
+	for i, frame := range p.Trace {
+		if i == traceEnds && len(p.Trace) > 2*traceEnds {
+			fmt.Fprintf(&out, "\n\t... %d more calls", len(p.Trace)-2*traceEnds)
+		}
+		if i >= traceEnds && i < len(p.Trace)-traceEnds {
+			continue
+		}
+		out.WriteString("\n\t")
+		out.WriteString(frame)
+	}
+	return out.String()
+}
+
+// Branch is a break or continue on its way out to the innermost
+// enclosing loop.
+type Branch struct {
+	Token token.Token
+}
+
+func (b *Branch) Type() ObjectType { return BRANCH_OBJ }
+func (b *Branch) Inspect() string  { return b.Token.Lexeme }
+
+// TypeName is a type declared with a type statement. Called like a
+// function, it converts its argument to the type. Underlying is the
+// type it was declared as, written in the scope Env.
+type TypeName struct {
+	Name       string
+	Underlying *ast.TypeExpression
+	Alias      bool
+	Env        *Environment
+}
+
+func (t *TypeName) Type() ObjectType { return TYPE_OBJ }
+func (t *TypeName) Inspect() string  { return "type " + t.Name }
+
+// NamedValue is a value of a distinct named type, such as Meters(5).
+// Value is its representation in the underlying type.
+type NamedValue struct {
+	TypeName string
+	Value    Object
+}
+
+func (n *NamedValue) Type() ObjectType { return ObjectType(strings.ToUpper(n.TypeName)) }
+func (n *NamedValue) Inspect() string  { return n.TypeName + "(" + n.Value.Inspect() + ")" }
+
+// RecordType is a record type declared with a record statement. Called
+// like a function, it builds a record from the values of its fields, in
+// the order they are declared. Its methods run in the scope Env.
+type RecordType struct {
+	Name    string
+	Fields  []string
+	Methods map[string]*ast.FunctionalLiteral
+	Env     *Environment
+}
+
+func (rt *RecordType) Type() ObjectType { return TYPE_OBJ }
+func (rt *RecordType) Inspect() string  { return "record " + rt.Name }
+
+// Record is a value of a record type. Fields holds the value of each
+// field of Def, in the same order.
+type Record struct {
+	Def    *RecordType
+	Fields []Object
+}
+
+func (r *Record) Type() ObjectType { return ObjectType(strings.ToUpper(r.Def.Name)) }
+func (r *Record) Inspect() string {
+	var out strings.Builder
+	out.WriteString(r.Def.Name + "{")
+	for i, name := range r.Def.Fields {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(name + ": " + r.Fields[i].Inspect())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// Field returns the value of the field called name.
+func (r *Record) Field(name string) (Object, bool) {
+	for i, f := range r.Def.Fields {
+		if f == name {
+			return r.Fields[i], true
+		}
+	}
+	return nil, false
+}
+
+// InterfaceType is an interface declared with an interface statement.
+// Methods holds the signature of each method, written in the scope Env.
+type InterfaceType struct {
+	Name    string
+	Methods map[string]*ast.FunctionalLiteral
+	Env     *Environment
+}
+
+func (it *InterfaceType) Type() ObjectType { return TYPE_OBJ }
+func (it *InterfaceType) Inspect() string  { return "interface " + it.Name }
+
+// BoundMethod is a method selected from a record, such as r.area, ready
+// to be called with the record as self.
+type BoundMethod struct {
+	Receiver *Record
+	Name     string
+}
+
+func (bm *BoundMethod) Type() ObjectType { return FUNCTION_OBJ }
+func (bm *BoundMethod) Inspect() string  { return bm.Receiver.Def.Name + "." + bm.Name }
+
+// Iterator yields the elements of a collection one at a time.
+type Iterator interface {
+	// Next returns the next element, or false once there are none.
+	Next() (Object, bool)
+}
+
+// Iterable is a collection a for-in loop can traverse.
+type Iterable interface {
+	Object
+	Iterator() Iterator
+}
+
+// Range is the integers from Start up to End, including End when
+// Inclusive is set.
+type Range struct {
+	Start, End int64
+	Inclusive  bool
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	op := ".."
+	if r.Inclusive {
+		op = "..="
+	}
+	return fmt.Sprintf("%d%s%d", r.Start, op, r.End)
+}
+
+func (r *Range) Iterator() Iterator {
+	return &rangeIterator{next: r.Start, end: r.End, inclusive: r.Inclusive}
+}
+
+type rangeIterator struct {
+	next, end int64
+	inclusive bool
+	done      bool
+}
+
+func (it *rangeIterator) Next() (Object, bool) {
+	if it.done || it.next > it.end || (it.next == it.end && !it.inclusive) {
+		return nil, false
+	}
+	n := it.next
+	// Stop rather than wrap around after a range ending at the largest
+	// Integer.
+	if n == it.end {
+		it.done = true
+	} else {
+		it.next++
+	}
+	return &Integer{Value: n}, true
+}
+
+// Closer is an iterator that must be told when it is abandoned before
+// its end.
+type Closer interface {
+	Close()
+}
+
+// Generator is the iterator a call of a generator function returns.
+// Resume runs the function until it yields its next value, and Stop
+// ends it early, running its deferred calls. The caller passed to
+// Resume is the Frame.Generator of the code resuming it. A generator
+// is its own iterator, so traversing it again continues where it left
+// off.
+type Generator struct {
+	Name   string
+	Resume func(caller interface{}) (Object, bool)
+	Stop   func()
+}
+
+func (g *Generator) Type() ObjectType     { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string      { return "generator " + g.Name }
+func (g *Generator) Iterator() Iterator   { return g }
+func (g *Generator) Next() (Object, bool) { return g.Resume(nil) }
+func (g *Generator) Close()               { g.Stop() }
+
+// Channel is a channel made by chan[T](capacity), which spawned tasks
+// use to pass values to each other.
+type Channel struct {
+	Elem string // the element type, as written
+	Ch   chan Object
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "chan[" + c.Elem + "]" }
+
+// Quote is code as a value, made by a quote expression.
+type Quote struct {
+	Node ast.Node // an Expression, or a *ast.BlockStatement of statements
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string {
+	return (&ast.QuoteExpression{Node: q.Node}).String()
+}
+
+// Macro is a macro declared by a macro statement. Macros only exist
+// while the program is being expanded, before it runs.
+type Macro struct {
+	Statement *ast.MacroStatement
+	Env       *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string  { return "macro " + m.Statement.Name.Value }
@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+
+	"compiler/environment"
+)
+
+// CheckedArithmetic makes integer overflow panic everywhere, as
+// if every function were declared @checked.
+var CheckedArithmetic = false
+
+// isChecked reports whether integer overflow traps in code running in
+// env.
+func isChecked(env *environment.Environment) bool {
+	if CheckedArithmetic {
+		return true
+	}
+	frame := env.Frame()
+	return frame != nil && frame.Checked
+}
+
+// integerArithmetic applies the operator op to l and r. Division and
+// modulo by zero always fail; overflow fails only when checked, and
+// wraps around otherwise. A failure is described by the returned
+// message.
+func integerArithmetic(op string, l, r int64, checked bool) (int64, string) {
+	if (op == "/" || op == "%") && r == 0 {
+		return 0, "integer divide by zero"
+	}
+	if checked && overflows(op, l, r) {
+		return 0, "integer overflow: " + formatOperation(op, l, r)
+	}
+
+	switch op {
+	case "+":
+		return l + r, ""
+	case "-":
+		return l - r, ""
+	case "*":
+		return l * r, ""
+	case "/":
+		return l / r, ""
+	default:
+		return l % r, ""
+	}
+}
+
+// overflows reports whether l op r is outside the range of int64.
+func overflows(op string, l, r int64) bool {
+	switch op {
+	case "+":
+		return (r > 0 && l > math.MaxInt64-r) || (r < 0 && l < math.MinInt64-r)
+	case "-":
+		return (r < 0 && l > math.MaxInt64+r) || (r > 0 && l < math.MinInt64+r)
+	case "*":
+		if l == 0 || r == 0 {
+			return false
+		}
+		if (l == -1 && r == math.MinInt64) || (r == -1 && l == math.MinInt64) {
+			return true
+		}
+		return (l*r)/r != l
+	case "/":
+		return l == math.MinInt64 && r == -1
+	}
+	return false
+}
+
+func formatOperation(op string, l, r int64) string {
+	return fmt.Sprintf("%d %s %d", l, op, r)
+}
+
+// wrapping returns a builtin applying op with two's complement
+// wraparound, whether or not arithmetic is checked.
+func wrapping(name, op string) *environment.Builtin {
+	return &environment.Builtin{Name: name, Fn: func(args ...environment.Object) environment.Object {
+		if err := checkArgCount(name, args, 2); err != nil {
+			return err
+		}
+		a, aok := args[0].(*environment.Integer)
+		b, bok := args[1].(*environment.Integer)
+		if !aok || !bok {
+			return newError("arguments to `%s` must be INTEGER, got %s and %s", name, args[0].Type(), args[1].Type())
+		}
+		val, err := integerArithmetic(op, a.Value, b.Value, false)
+		if err != "" {
+			return newError("%s", err)
+		}
+		return &environment.Integer{Value: val}
+	}}
+}
@@ -0,0 +1,100 @@
+package evaluator
+
+import (
+	"math/big"
+
+	"compiler/ast"
+	"compiler/environment"
+)
+
+func evalBigIntegerInfixExpression(node *ast.InfixExpression, left, right environment.Object) environment.Object {
+	l := left.(*environment.BigInteger).Value
+	r := right.(*environment.BigInteger).Value
+
+	switch node.Operator {
+	case "+":
+		return &environment.BigInteger{Value: new(big.Int).Add(l, r)}
+	case "-":
+		return &environment.BigInteger{Value: new(big.Int).Sub(l, r)}
+	case "*":
+		return &environment.BigInteger{Value: new(big.Int).Mul(l, r)}
+	case "/", "%":
+		if r.Sign() == 0 {
+			return runtimePanic(node.Token, "integer divide by zero")
+		}
+		// Quo and Rem truncate toward zero like Integer division does.
+		if node.Operator == "/" {
+			return &environment.BigInteger{Value: new(big.Int).Quo(l, r)}
+		}
+		return &environment.BigInteger{Value: new(big.Int).Rem(l, r)}
+	case "&":
+		return &environment.BigInteger{Value: new(big.Int).And(l, r)}
+	case "|":
+		return &environment.BigInteger{Value: new(big.Int).Or(l, r)}
+	case "^":
+		return &environment.BigInteger{Value: new(big.Int).Xor(l, r)}
+	case "==":
+		return nativeBoolToBooleanObject(l.Cmp(r) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(l.Cmp(r) != 0)
+	case "<":
+		return nativeBoolToBooleanObject(l.Cmp(r) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(l.Cmp(r) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(l.Cmp(r) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(l.Cmp(r) >= 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), node.Operator, right.Type())
+	}
+}
+
+// convertToBigInteger is BigInteger(x), accepting an integer of any type
+// or a string of decimal digits.
+func convertToBigInteger(args ...environment.Object) environment.Object {
+	if err := checkArgCount("BigInteger", args, 1); err != nil {
+		return err
+	}
+	switch arg := underlyingValue(args[0]).(type) {
+	case *environment.Integer:
+		return &environment.BigInteger{Value: big.NewInt(arg.Value)}
+	case *environment.BigInteger:
+		return arg
+	case *environment.SizedInteger:
+		return &environment.BigInteger{Value: arg.Kind.Big(arg.Value)}
+	case *environment.String:
+		val, ok := new(big.Int).SetString(arg.Value, 10)
+		if !ok {
+			return newError("cannot convert %q to BigInteger", arg.Value)
+		}
+		return &environment.BigInteger{Value: val}
+	default:
+		return newError("cannot convert %s to BigInteger", args[0].Type())
+	}
+}
+
+// convertToInteger is Integer(x). A BigInteger that does not fit in an
+// Integer is an error rather than being truncated.
+func convertToInteger(args ...environment.Object) environment.Object {
+	if err := checkArgCount("Integer", args, 1); err != nil {
+		return err
+	}
+	switch arg := underlyingValue(args[0]).(type) {
+	case *environment.Integer:
+		return arg
+	case *environment.BigInteger:
+		if !arg.Value.IsInt64() {
+			return newError("BigInteger %s overflows Integer", arg.Value)
+		}
+		return &environment.Integer{Value: arg.Value.Int64()}
+	case *environment.SizedInteger:
+		n := arg.Kind.Big(arg.Value)
+		if !n.IsInt64() {
+			return newError("%s %s overflows Integer", arg.Kind.Name, n)
+		}
+		return &environment.Integer{Value: n.Int64()}
+	default:
+		return newError("cannot convert %s to Integer", args[0].Type())
+	}
+}
@@ -0,0 +1,189 @@
+package evaluator
+
+import (
+	"unicode/utf8"
+
+	"compiler/environment"
+)
+
+// builtins are looked up after every user binding, so a program may
+// shadow any of them.
+var builtins = map[string]*environment.Builtin{
+	"Int8":   conversion("Int8"),
+	"Int16":  conversion("Int16"),
+	"Int32":  conversion("Int32"),
+	"Int64":  conversion("Int64"),
+	"UInt8":  conversion("UInt8"),
+	"UInt16": conversion("UInt16"),
+	"UInt32": conversion("UInt32"),
+	"UInt64": conversion("UInt64"),
+	"Byte":   conversion("Byte"),
+
+	"Ok": {Name: "Ok", Fn: func(args ...environment.Object) environment.Object {
+		if err := checkArgCount("Ok", args, 1); err != nil {
+			return err
+		}
+		return &environment.Result{Ok: true, Value: args[0]}
+	}},
+
+	"Err": {Name: "Err", Fn: func(args ...environment.Object) environment.Object {
+		if err := checkArgCount("Err", args, 1); err != nil {
+			return err
+		}
+		return &environment.Result{Ok: false, Value: args[0]}
+	}},
+
+	"isOk": {Name: "isOk", Fn: func(args ...environment.Object) environment.Object {
+		result, err := resultArg("isOk", args)
+		if err != nil {
+			return err
+		}
+		return nativeBoolToBooleanObject(result.Ok)
+	}},
+
+	"isErr": {Name: "isErr", Fn: func(args ...environment.Object) environment.Object {
+		result, err := resultArg("isErr", args)
+		if err != nil {
+			return err
+		}
+		return nativeBoolToBooleanObject(!result.Ok)
+	}},
+
+	"unwrap": {Name: "unwrap", Fn: func(args ...environment.Object) environment.Object {
+		result, err := resultArg("unwrap", args)
+		if err != nil {
+			return err
+		}
+		if !result.Ok {
+			return newError("unwrap called on %s", result.Inspect())
+		}
+		return result.Value
+	}},
+
+	"unwrapOr": {Name: "unwrapOr", Fn: func(args ...environment.Object) environment.Object {
+		if err := checkArgCount("unwrapOr", args, 2); err != nil {
+			return err
+		}
+		result, err := resultArg("unwrapOr", args[:1])
+		if err != nil {
+			return err
+		}
+		if !result.Ok {
+			return args[1]
+		}
+		return result.Value
+	}},
+
+	"message": {Name: "message", Fn: func(args ...environment.Object) environment.Object {
+		result, err := resultArg("message", args)
+		if err != nil {
+			return err
+		}
+		if result.Ok {
+			return newError("message called on %s", result.Inspect())
+		}
+		if s, ok := result.Value.(*environment.String); ok {
+			return s
+		}
+		return &environment.String{Value: result.Value.Inspect()}
+	}},
+
+	"panic": {Name: "panic", Fn: func(args ...environment.Object) environment.Object {
+		if err := checkArgCount("panic", args, 1); err != nil {
+			return err
+		}
+		return &environment.Panic{Value: args[0]}
+	}},
+
+	"len": {Name: "len", Fn: func(args ...environment.Object) environment.Object {
+		if err := checkArgCount("len", args, 1); err != nil {
+			return err
+		}
+		switch arg := args[0].(type) {
+		case *environment.String:
+			return &environment.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+		case *environment.Tuple:
+			return &environment.Integer{Value: int64(len(arg.Elements))}
+		default:
+			return newError("argument to `len` not supported, got %s", args[0].Type())
+		}
+	}},
+
+	"at": {Name: "at", Fn: func(args ...environment.Object) environment.Object {
+		if err := checkArgCount("at", args, 2); err != nil {
+			return err
+		}
+		index, ok := args[1].(*environment.Integer)
+		if !ok {
+			return newError("second argument to `at` must be INTEGER, got %s", args[1].Type())
+		}
+
+		var elements []environment.Object
+		switch arg := args[0].(type) {
+		case *environment.String:
+			for _, r := range arg.Value {
+				elements = append(elements, &environment.String{Value: string(r)})
+			}
+		case *environment.Tuple:
+			elements = arg.Elements
+		default:
+			return newError("argument to `at` not supported, got %s", args[0].Type())
+		}
+
+		i := index.Value
+		if i < 0 || i >= int64(len(elements)) {
+			return errResult("index out of range [%d] with length %d", i, len(elements))
+		}
+		return &environment.Result{Ok: true, Value: elements[i]}
+	}},
+
+	"div": {Name: "div", Fn: func(args ...environment.Object) environment.Object {
+		if err := checkArgCount("div", args, 2); err != nil {
+			return err
+		}
+		a, aok := args[0].(*environment.Integer)
+		b, bok := args[1].(*environment.Integer)
+		if !aok || !bok {
+			return newError("arguments to `div` must be INTEGER, got %s and %s", args[0].Type(), args[1].Type())
+		}
+		if b.Value == 0 {
+			return errResult("division by zero")
+		}
+		return &environment.Result{Ok: true, Value: &environment.Integer{Value: a.Value / b.Value}}
+	}},
+
+	"Integer":    {Name: "Integer", Fn: convertToInteger},
+	"BigInteger": {Name: "BigInteger", Fn: convertToBigInteger},
+
+	"send":  {Name: "send", Fn: builtinSend},
+	"recv":  {Name: "recv", Fn: builtinRecv},
+	"close": {Name: "close", Fn: builtinClose},
+
+	"wrapping_add": wrapping("wrapping_add", "+"),
+	"wrapping_sub": wrapping("wrapping_sub", "-"),
+	"wrapping_mul": wrapping("wrapping_mul", "*"),
+}
+
+func checkArgCount(name string, args []environment.Object, want int) *environment.Error {
+	if len(args) != want {
+		return arityError(name, want, len(args), false)
+	}
+	return nil
+}
+
+func resultArg(name string, args []environment.Object) (*environment.Result, *environment.Error) {
+	if err := checkArgCount(name, args, 1); err != nil {
+		return nil, err
+	}
+	result, ok := args[0].(*environment.Result)
+	if !ok {
+		return nil, newError("argument to `%s` must be RESULT, got %s", name, args[0].Type())
+	}
+	return result, nil
+}
+
+// errResult is how builtins report failures that Blue code can handle:
+// an Err result carrying the message, rather than an evaluator error.
+func errResult(format string, a ...interface{}) *environment.Result {
+	return &environment.Result{Ok: false, Value: &environment.String{Value: newError(format, a...).Message}}
+}
@@ -0,0 +1,198 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"compiler/ast"
+	"compiler/environment"
+	"compiler/token"
+)
+
+// comptimeLimits bounds the loop iterations and calls code evaluated at
+// compile time may take, and how deeply its calls may nest, so that
+// code that never finishes is reported rather than run forever.
+var comptimeLimits = environment.Limits{Steps: 1000000, Depth: 10000}
+
+// Comptime returns a copy of program in which each comptime block, and
+// the initializer of each top-level constant that is a constant
+// expression, is replaced by a literal of its value. It runs once the
+// program is resolved and checked, so the code it evaluates is known to
+// be well typed; the program is checked again afterwards, when the
+// types of the literals are known.
+//
+// The code is evaluated as if at the top level of the program, in a
+// restricted environment: it may call the functions the program
+// declares and refer to the constants folded before it, but it cannot
+// start tasks, use channels, import modules or refer to variables,
+// which only have values once the program runs. A constant expression
+// is made of literals, operators and folded constants; any other
+// constant is left to be evaluated when the program runs.
+func Comptime(program *ast.Program) (*ast.Program, []*CompileError) {
+	c := &comptime{env: environment.NewRestrictedEnvironment(nil, comptimeLimits), consts: make(map[string]bool)}
+	hoistDeclarations(program.Statements, c.env)
+	stmts := make([]ast.Statement, 0, len(program.Statements))
+	for _, s := range program.Statements {
+		s = c.blocks(s)
+		if cs, ok := s.(*ast.ConstStatement); ok {
+			s = c.constant(cs)
+		}
+		stmts = append(stmts, s)
+	}
+	return &ast.Program{Statements: stmts}, c.errors
+}
+
+type comptime struct {
+	env    *environment.Environment // holds the program's declarations and folded constants
+	consts map[string]bool          // the names of the folded constants
+	errors []*CompileError
+}
+
+func (c *comptime) errorf(tok token.Token, format string, args ...interface{}) {
+	c.errors = append(c.errors, &CompileError{Line: tok.Line, Column: tok.Column, Msg: fmt.Sprintf(format, args...)})
+}
+
+// blocks returns a copy of stmt with its comptime blocks replaced by
+// literals. A block that fails is left in place.
+func (c *comptime) blocks(stmt ast.Statement) ast.Statement {
+	folded := ast.Modify(stmt, func(n ast.Node) ast.Node {
+		ce, ok := n.(*ast.ComptimeExpression)
+		if !ok {
+			return n
+		}
+		val := evalComptime(ce, c.env)
+		if c.failed(ce.Token, "in comptime block", val) {
+			return n
+		}
+		lit, ok := literal(val, ce.Token)
+		if !ok {
+			c.errorf(ce.Token, "comptime block evaluates to %s, which cannot be written as a literal", val.Type())
+			return n
+		}
+		return lit
+	})
+	if s, ok := folded.(ast.Statement); ok {
+		return s
+	}
+	return stmt
+}
+
+// constant folds the initializer of cs if it is a constant expression
+// with a value that can be written as a literal, and makes the constant
+// known to the code evaluated after it.
+func (c *comptime) constant(cs *ast.ConstStatement) ast.Statement {
+	if !c.isConstant(cs.Value) {
+		return cs
+	}
+	val := Eval(cs.Value, c.env)
+	if c.failed(cs.Name.Token, "in constant "+cs.Name.Value, val) {
+		return cs
+	}
+	lit, ok := literal(val, cs.Token)
+	if !ok {
+		return cs
+	}
+	c.env.SetConst(cs.Name.Value, val)
+	c.consts[cs.Name.Value] = true
+	folded := *cs
+	folded.Value = lit
+	return &folded
+}
+
+// isConstant reports whether e is a constant expression.
+func (c *comptime) isConstant(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral, *ast.BigIntegerLiteral, *ast.Boolean, *ast.StringLiteral, *ast.NullLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return c.isConstant(e.Right)
+	case *ast.InfixExpression:
+		return c.isConstant(e.Left) && c.isConstant(e.Right)
+	case *ast.Identifier:
+		return c.consts[e.Value]
+	}
+	return false
+}
+
+// failed reports, as an error at tok, a value that is an error or a
+// panic.
+func (c *comptime) failed(tok token.Token, context string, val environment.Object) bool {
+	switch val := val.(type) {
+	case *environment.Error:
+		c.errorf(tok, "%s: %s", context, val.Message)
+	case *environment.Panic:
+		c.errorf(tok, "%s: %s", context, val.Inspect())
+	default:
+		return false
+	}
+	return true
+}
+
+// evalComptime evaluates the block of ce in a restricted environment
+// enclosed by env. Outside of Comptime, which replaces comptime blocks
+// before the program runs, this only happens in the functions called
+// by compile-time code.
+func evalComptime(ce *ast.ComptimeExpression, env *environment.Environment) environment.Object {
+	frame := &environment.Frame{}
+	blockEnv := environment.NewCallEnvironment(environment.NewRestrictedEnvironment(env, comptimeLimits), frame)
+	result := runDeferred(frame, strayBranch(evalFunctionBody(ce.Block, blockEnv)))
+	if rv, ok := result.(*environment.ReturnValue); ok {
+		return rv.Value
+	}
+	return result
+}
+
+// step counts a loop iteration of code running in env, and returns an
+// error if the code is evaluated at compile time and has taken too many
+// steps.
+func step(env *environment.Environment) *environment.Error {
+	limits := env.Limits()
+	if limits == nil {
+		return nil
+	}
+	if limits.Steps--; limits.Steps < 0 {
+		return newError("compile-time evaluation takes more than %d steps", comptimeLimits.Steps)
+	}
+	return nil
+}
+
+// maxCallDepth is how deeply calls may nest when the program runs.
+// A call beyond it panics, well before the interpreter runs out of
+// stack itself.
+const maxCallDepth = 50000
+
+// enter counts a call of fl that runs in env like step, and also
+// returns an error if the call is nested too deeply, or at run time a
+// stack overflow panic. Unless it returns one of those, leave must be
+// called when the call returns.
+func enter(fl *ast.FunctionalLiteral, env *environment.Environment) environment.Object {
+	if err := step(env); err != nil {
+		return err
+	}
+	if frame := env.Frame(); frame != nil && frame.Depth > maxCallDepth {
+		return runtimePanic(fl.Token, "stack overflow")
+	}
+	limits := env.Limits()
+	if limits == nil {
+		return nil
+	}
+	if limits.Depth == 0 {
+		return newError("compile-time calls nest more than %d deep", comptimeLimits.Depth)
+	}
+	limits.Depth--
+	return nil
+}
+
+func leave(env *environment.Environment) {
+	if limits := env.Limits(); limits != nil {
+		limits.Depth++
+	}
+}
+
+// notAtCompileTime returns an error if code running in env is evaluated
+// at compile time, where what it does at tok is not allowed.
+func notAtCompileTime(env *environment.Environment, tok token.Token, what string) *environment.Error {
+	if !env.Restricted() {
+		return nil
+	}
+	return newError("line %d:%d: %s is not allowed at compile time", tok.Line, tok.Column, what)
+}
@@ -0,0 +1,76 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"compiler/ast"
+	"compiler/environment"
+)
+
+// evalDeferStatement evaluates the function and arguments of a deferred
+// call right away and registers the call to run when the enclosing
+// function returns.
+func evalDeferStatement(ds *ast.DeferStatement, env *environment.Environment) environment.Object {
+	frame := env.Frame()
+	if frame == nil {
+		return newError("line %d:%d: defer outside of a function", ds.Token.Line, ds.Token.Column)
+	}
+
+	function := Eval(ds.Call.Function, env)
+	if isAbrupt(function) {
+		return function
+	}
+	args := []environment.Object{}
+	for _, a := range ds.Call.Arguments {
+		arg := Eval(a, env)
+		if isAbrupt(arg) {
+			return arg
+		}
+		args = append(args, arg)
+	}
+
+	frame.Deferred = append(frame.Deferred, func() environment.Object {
+		result := callFunction(function, args, &environment.Frame{DeferredBy: frame, Task: frame.Task, Generator: frame.Generator, Depth: frame.Depth + 1})
+		if p, ok := result.(*environment.Panic); ok {
+			p.Trace = append(p.Trace, fmt.Sprintf("deferred %s (line %d:%d)",
+				ds.Call.Function.String(), ds.Token.Line, ds.Token.Column))
+		}
+		return result
+	})
+	return NULL
+}
+
+// runDeferred runs the calls deferred in frame, last registered first,
+// once the function body has finished with result. It returns what the
+// call as a whole evaluates to: a panic that is still unwinding, null if
+// a deferred call recovered the panic, or result otherwise.
+func runDeferred(frame *environment.Frame, result environment.Object) environment.Object {
+	if len(frame.Deferred) == 0 {
+		return result
+	}
+
+	if p, ok := result.(*environment.Panic); ok {
+		frame.Panic = p
+	}
+
+	for i := len(frame.Deferred) - 1; i >= 0; i-- {
+		switch out := frame.Deferred[i]().(type) {
+		case *environment.Panic:
+			// A panic in a deferred call replaces the one in flight.
+			frame.Panic = out
+		case *environment.Error:
+			if frame.Panic == nil {
+				result = out
+			}
+		}
+	}
+	frame.Deferred = nil
+
+	if frame.Panic != nil {
+		return frame.Panic
+	}
+	if _, ok := result.(*environment.Panic); ok {
+		return NULL
+	}
+	return result
+}
@@ -2,138 +2,690 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 
 	"compiler/ast"
 	"compiler/environment"
 )
 
+var (
+	NULL  = &environment.Null{}
+	TRUE  = &environment.Boolean{Value: true}
+	FALSE = &environment.Boolean{Value: false}
+)
+
 func Eval(node ast.Node, env *environment.Environment) environment.Object {
-	fmt.Printf("node: %v", node)
 	switch node := node.(type) {
 
 	case *ast.Program:
 		return evalProgram(node, env)
 
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+
 	case *ast.LetStatement:
 		val := Eval(node.Assignment.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		env.Set(node.Assignment.Name.Value, val)
 		return val
 
+	case *ast.DestructureStatement:
+		return evalDestructureStatement(node, env)
+
+	case *ast.ConstStatement:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return env.SetConst(node.Name.Value, val)
+
 	case *ast.AssignmentStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if err := env.Assign(node.Name.Value, val); err != nil {
+			return newError("line %d:%d: %s", node.Name.Token.Line, node.Name.Token.Column, err)
+		}
 		return val
 
+	case *ast.FunctionStatement:
+		return declareFunction(node, env)
+
+	case *ast.TypeStatement:
+		return declareType(node, env)
+
+	case *ast.RecordStatement:
+		return declareRecord(node, env)
+
+	case *ast.InterfaceStatement:
+		return declareInterface(node, env)
+
+	case *ast.SwitchStatement:
+		return evalSwitchStatement(node, env)
+
+	case *ast.IfStatement:
+		return evalIfStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.BranchStatement:
+		return &environment.Branch{Token: node.Token}
+
+	case *ast.DeferStatement:
+		return evalDeferStatement(node, env)
+
+	case *ast.YieldStatement:
+		return evalYieldStatement(node, env)
+
+	case *ast.SpawnStatement:
+		return evalSpawnStatement(node, env)
+
+	case *ast.SelectStatement:
+		return evalSelectStatement(node, env)
+
+	case *ast.ChannelExpression:
+		return evalChannelExpression(node, env)
+
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+
 	case *ast.IntegerLiteral:
 		return &environment.Integer{Value: node.Value}
 
+	case *ast.BigIntegerLiteral:
+		return &environment.BigInteger{Value: node.Value}
+
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.NullLiteral:
+		return NULL
+
+	case *ast.StringLiteral:
+		return &environment.String{Value: node.Value}
+
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node, right, env)
 
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+		if node.Operator == "??" {
+			// The default is only evaluated when it is needed.
+			if left != NULL {
+				return left
+			}
+			return Eval(node.Right, env)
+		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node, left, right, env)
 
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.MemberExpression:
+		object := Eval(node.Object, env)
+		if isAbrupt(object) || (object == NULL && node.Safe()) {
+			return object
+		}
+		return evalMemberExpression(object, node.Member)
+
 	case *ast.FunctionalLiteral:
 		return &environment.Function{Literal: node, Env: env}
 
+	case *ast.QuoteExpression:
+		return evalQuote(node, env)
+
+	case *ast.ComptimeExpression:
+		return evalComptime(node, env)
+
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		args := []environment.Object{}
-		for _, a := range node.Arguments {
-			args = append(args, Eval(a, env))
-		}
-		return applyFunction(function, args...)
+		return evalCallExpression(node, env)
+
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		return &environment.ReturnValue{Value: val}
+		return evalReturnStatement(node, env)
 	}
 
-	print("yeah")
-	return nil
+	return NULL
+}
+
+// Run evaluates program in env and then calls its main function, and
+// waits for the tasks the program spawned. The result is whatever main
+// returned, or an error if main is missing or the program or one of its
+// tasks failed while running.
+func Run(program *ast.Program, env *environment.Environment) environment.Object {
+	result := Eval(program, env)
+	if isAbrupt(result) {
+		return result
+	}
+
+	main, ok := env.Get("main")
+	if !ok {
+		return newError("no main function declared")
+	}
+	if _, ok := main.(*environment.Function); !ok {
+		return newError("main is not a function: %s", main.Type())
+	}
+	result = applyFunction(main)
+	if p, ok := result.(*environment.Panic); ok {
+		p.Trace = append(p.Trace, "main")
+	}
+	if failure := waitForTasks(nil); failure != nil && !isAbrupt(result) {
+		result = failure
+	}
+	closeGenerators()
+	return result
+}
+
+func evalCallExpression(node *ast.CallExpression, env *environment.Environment) environment.Object {
+	if isBuiltinCall(node, env, "recover") {
+		return evalRecover(node, env)
+	}
+	if isBuiltinCall(node, env, "wait") {
+		return evalWait(node, env)
+	}
+	if isBuiltinCall(node, env, "next") {
+		return evalNext(node, env)
+	}
+
+	function := Eval(node.Function, env)
+	if isAbrupt(function) {
+		return function
+	}
+	args := []environment.Object{}
+	for _, a := range node.Arguments {
+		arg := Eval(a, env)
+		if isAbrupt(arg) {
+			return arg
+		}
+		args = append(args, arg)
+	}
+
+	result := callFunction(function, args, &environment.Frame{Task: currentTask(env), Generator: currentGenerator(env), Depth: callDepth(env) + 1})
+	if p, ok := result.(*environment.Panic); ok {
+		p.Trace = append(p.Trace, fmt.Sprintf("%s (line %d:%d)",
+			node.Function.String(), node.Token.Line, node.Token.Column))
+	}
+	return result
+}
+
+// callDepth returns the number of calls code running in env is nested
+// in.
+func callDepth(env *environment.Environment) int {
+	if frame := env.Frame(); frame != nil {
+		return frame.Depth
+	}
+	return 0
 }
 
 func applyFunction(fn environment.Object, args ...environment.Object) environment.Object {
+	return callFunction(fn, args, &environment.Frame{})
+}
+
+// callFunction calls fn with args. A Blue function runs in the given
+// frame, which collects its deferred calls.
+func callFunction(fn environment.Object, args []environment.Object, frame *environment.Frame) (result environment.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = goPanic(r)
+		}
+	}()
+
+	if builtin, ok := fn.(*environment.Builtin); ok {
+		return builtin.Fn(args...)
+	}
+	if t, ok := fn.(*environment.TypeName); ok {
+		return convert(t, args)
+	}
+	if rt, ok := fn.(*environment.RecordType); ok {
+		return construct(rt, args)
+	}
+	if method, ok := fn.(*environment.BoundMethod); ok {
+		fn = dispatch(method)
+		if isError(fn) {
+			return fn
+		}
+	}
+
 	function, ok := fn.(*environment.Function)
 	if !ok {
 		return newError("not a function: %s", fn.Type())
 	}
 
-	extendedEnv := environment.NewEnclosedEnvironment(function.Env)
+	if err := checkArity(function.Literal, len(args)); err != nil {
+		return err
+	}
+
+	var bindings map[string]string
+	if len(function.Literal.TypeParameters) > 0 {
+		var err *environment.Error
+		if bindings, err = instantiate(function.Literal, args, function.Env); err != nil {
+			return err
+		}
+	}
+
+	frame.Checked = function.Literal.HasAttribute("checked")
+	extendedEnv := environment.NewCallEnvironment(function.Env, frame)
+	if err := enter(function.Literal, extendedEnv); err != nil {
+		return err
+	}
+	defer leave(extendedEnv)
 
 	for i, param := range function.Literal.Parameters {
-		extendedEnv.Set(param.Value, args[i])
+		if param.Variadic {
+			rest := append([]environment.Object{}, args[i:]...)
+			extendedEnv.Set(param.Name.Value, &environment.Tuple{Elements: rest})
+			break
+		}
+		extendedEnv.Set(param.Name.Value, args[i])
 	}
 
-	evaluated := Eval(function.Literal.Body, extendedEnv)
+	if function.Literal.Generator {
+		return newGenerator(function.Literal, extendedEnv, frame)
+	}
+	evaluated := runBody(function.Literal, extendedEnv, frame)
+
+	if bindings != nil && function.Literal.ReturnType != nil && !isAbrupt(evaluated) {
+		if err := unify(function.Literal.FunctionName.Value, function.Literal.ReturnType, evaluated, bindings, function.Env); err != nil {
+			return err
+		}
+	}
+	return evaluated
+}
+
+// runBody evaluates the body of fl in env, the environment of a call
+// holding its arguments, then runs the calls deferred in frame. The
+// result is the value the call returns.
+func runBody(fl *ast.FunctionalLiteral, env *environment.Environment, frame *environment.Frame) environment.Object {
+	evaluated := strayBranch(evalFunctionBody(fl.Body, env))
+	evaluated = runDeferred(frame, evaluated)
 
 	if returnValue, ok := evaluated.(*environment.ReturnValue); ok {
-		return returnValue.Value
+		evaluated = returnValue.Value
 	}
 	return evaluated
 }
 
-func evalProgram(program *ast.Program, env *environment.Environment) environment.Object {
-	var result environment.Object
-	for _, stmt := range program.Statements {
+// checkArity reports a call of fl with the wrong number of arguments.
+// A variadic parameter takes any number of arguments, including none.
+func checkArity(fl *ast.FunctionalLiteral, got int) *environment.Error {
+	want := len(fl.Parameters)
+	if fl.Variadic() {
+		if got < want-1 {
+			return arityError(fl.FunctionName.Value, want-1, got, true)
+		}
+		return nil
+	}
+	if got != want {
+		return arityError(fl.FunctionName.Value, want, got, false)
+	}
+	return nil
+}
+
+func arityError(name string, want, got int, atLeast bool) *environment.Error {
+	expects := fmt.Sprintf("%d arguments", want)
+	if want == 1 {
+		expects = "1 argument"
+	}
+	if atLeast {
+		expects = "at least " + expects
+	}
+	return newError("%s expects %s, got %d", name, expects, got)
+}
+
+// evalFunctionBody runs body in env, the scope that also holds the
+// parameters, so it is evaluated statement by statement rather than as
+// a nested block. A Go panic is turned into a Blue panic here so that
+// deferred calls still run.
+func evalFunctionBody(body *ast.BlockStatement, env *environment.Environment) (result environment.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = goPanic(r)
+		}
+	}()
+	return evalStatements(body.Statements, env)
+}
+
+func evalProgram(program *ast.Program, env *environment.Environment) (result environment.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = goPanic(r)
+		}
+	}()
+
+	result = strayBranch(evalStatements(program.Statements, env))
+	if returnValue, ok := result.(*environment.ReturnValue); ok {
+		return returnValue.Value
+	}
+	return result
+}
+
+func evalBlockStatement(block *ast.BlockStatement, env *environment.Environment) environment.Object {
+	return evalStatements(block.Statements, environment.NewEnclosedEnvironment(env))
+}
+
+// evalStatements runs stmts in env, stopping at the first return or
+// error. The result is left wrapped so enclosing blocks stop as well;
+// only function calls and the program unwrap return values.
+func evalStatements(stmts []ast.Statement, env *environment.Environment) environment.Object {
+	hoistDeclarations(stmts, env)
+
+	var result environment.Object = NULL
+	for _, stmt := range stmts {
 		result = Eval(stmt, env)
+		if isAbrupt(result) {
+			return result
+		}
 	}
 	return result
 }
 
-func evalPrefixExpression(operator string, right environment.Object) environment.Object {
-	switch operator {
+// hoistDeclarations binds every function and type declared directly in
+// stmts before any of them runs, so functions can call each other
+// regardless of the order they are declared in.
+func hoistDeclarations(stmts []ast.Statement, env *environment.Environment) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.FunctionStatement:
+			declareFunction(stmt, env)
+		case *ast.TypeStatement:
+			declareType(stmt, env)
+		case *ast.RecordStatement:
+			declareRecord(stmt, env)
+		case *ast.InterfaceStatement:
+			declareInterface(stmt, env)
+		}
+	}
+}
+
+func declareFunction(fs *ast.FunctionStatement, env *environment.Environment) environment.Object {
+	fn := &environment.Function{Literal: fs.Literal, Env: env}
+	return env.Set(fs.Literal.FunctionName.Value, fn)
+}
+
+// evalReturnStatement wraps the returned value; several values are
+// returned together as a tuple.
+func evalReturnStatement(rs *ast.ReturnStatement, env *environment.Environment) environment.Object {
+	values := make([]environment.Object, 0, len(rs.ReturnValues))
+	for _, exp := range rs.ReturnValues {
+		val := Eval(exp, env)
+		if isAbrupt(val) {
+			return val
+		}
+		values = append(values, val)
+	}
+
+	switch len(values) {
+	case 0:
+		return &environment.ReturnValue{Value: NULL}
+	case 1:
+		return &environment.ReturnValue{Value: values[0]}
+	default:
+		return &environment.ReturnValue{Value: &environment.Tuple{Elements: values}}
+	}
+}
+
+func evalDestructureStatement(ds *ast.DestructureStatement, env *environment.Environment) environment.Object {
+	val := Eval(ds.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	tuple, ok := val.(*environment.Tuple)
+	if !ok {
+		return newError("line %d:%d: assignment mismatch: %d names but 1 value",
+			ds.Token.Line, ds.Token.Column, len(ds.Names))
+	}
+	if len(tuple.Elements) != len(ds.Names) {
+		return newError("line %d:%d: assignment mismatch: %d names but %d values",
+			ds.Token.Line, ds.Token.Column, len(ds.Names), len(tuple.Elements))
+	}
+
+	for i, name := range ds.Names {
+		env.Set(name.Value, tuple.Elements[i])
+	}
+	return tuple
+}
+
+func evalIfStatement(is *ast.IfStatement, env *environment.Environment) environment.Object {
+	condition := Eval(is.Condition, env)
+	if isAbrupt(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(is.Consequence, env)
+	} else if is.Alternative != nil {
+		return Eval(is.Alternative, env)
+	}
+	return NULL
+}
+
+// evalForStatement runs the body until the condition is false or the
+// body breaks out. Each iteration gets a fresh block scope.
+func evalForStatement(fs *ast.ForStatement, env *environment.Environment) environment.Object {
+	if fs.Iterable != nil {
+		return evalForInStatement(fs, env)
+	}
+	for {
+		if err := step(env); err != nil {
+			return err
+		}
+		if fs.Condition != nil {
+			condition := Eval(fs.Condition, env)
+			if isAbrupt(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		if stop := evalLoopBody(fs.Body, env); stop != nil {
+			return stop
+		}
+	}
+}
+
+// evalLoopBody runs one iteration of a loop body. It returns what the
+// loop should stop with, or nil to go on to the next iteration.
+func evalLoopBody(body *ast.BlockStatement, env *environment.Environment) environment.Object {
+	result := evalBlockStatement(body, env)
+	if branch, ok := result.(*environment.Branch); ok {
+		if branch.Token.Lexeme == "break" {
+			return NULL
+		}
+		return nil
+	}
+	if isAbrupt(result) {
+		return result
+	}
+	return nil
+}
+
+// strayBranch turns a break or continue that left every loop into an
+// error.
+func strayBranch(obj environment.Object) environment.Object {
+	if branch, ok := obj.(*environment.Branch); ok {
+		return newError("line %d:%d: %s is not in a loop", branch.Token.Line, branch.Token.Column, branch.Token.Lexeme)
+	}
+	return obj
+}
+
+func evalPrefixExpression(node *ast.PrefixExpression, right environment.Object, env *environment.Environment) environment.Object {
+	if named, ok := right.(*environment.NamedValue); ok && node.Operator != "!" {
+		return withTypeName(named.TypeName, evalPrefixExpression(node, named.Value, env))
+	}
+	switch node.Operator {
 	case "-":
+		if b, ok := right.(*environment.BigInteger); ok {
+			return &environment.BigInteger{Value: new(big.Int).Neg(b.Value)}
+		}
+		if sized, ok := right.(*environment.SizedInteger); ok {
+			return evalSizedNegation(node, sized, isChecked(env))
+		}
 		if right.Type() != environment.INTEGER_OBJ {
 			return newError("unknown operator: -%s", right.Type())
 		}
 		val := right.(*environment.Integer).Value
+		if val == math.MinInt64 && isChecked(env) {
+			return runtimePanic(node.Token, "integer overflow: -(%d)", val)
+		}
 		return &environment.Integer{Value: -val}
+	case "!":
+		return nativeBoolToBooleanObject(!isTruthy(right))
+	case "~":
+		switch right := right.(type) {
+		case *environment.Integer:
+			return &environment.Integer{Value: ^right.Value}
+		case *environment.SizedInteger:
+			v, _ := right.Kind.Wrap(new(big.Int).Not(right.Kind.Big(right.Value)))
+			return &environment.SizedInteger{Kind: right.Kind, Value: v}
+		case *environment.BigInteger:
+			return &environment.BigInteger{Value: new(big.Int).Not(right.Value)}
+		}
+		return newError("unknown operator: ~%s", right.Type())
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError("unknown operator: %s%s", node.Operator, right.Type())
 	}
 }
 
-func evalInfixExpression(operator string, left, right environment.Object) environment.Object {
-	if left.Type() == environment.INTEGER_OBJ && right.Type() == environment.INTEGER_OBJ {
-		return evalIntegerInfixExpression(operator, left, right)
+func evalInfixExpression(node *ast.InfixExpression, left, right environment.Object, env *environment.Environment) environment.Object {
+	operator := node.Operator
+	if result, ok := evalNamedInfixExpression(node, left, right, env); ok {
+		return result
+	}
+	if isShift(node, left, right) {
+		return evalShiftExpression(node, left, right)
+	}
+	left, right, err := sizedLiterals(node, left, right)
+	if err != nil {
+		return err
+	}
+	if left == NULL || right == NULL {
+		return evalNullComparison(operator, left, right)
+	}
+
+	if l, ok := left.(*environment.SizedInteger); ok {
+		if r, ok := right.(*environment.SizedInteger); ok && l.Kind == r.Kind {
+			return evalSizedInfixExpression(node, l, r, isChecked(env))
+		}
+	}
+	switch {
+	case left.Type() == environment.INTEGER_OBJ && right.Type() == environment.INTEGER_OBJ:
+		return evalIntegerInfixExpression(node, left, right, isChecked(env))
+	case left.Type() == environment.BIG_INTEGER_OBJ && right.Type() == environment.BIG_INTEGER_OBJ:
+		return evalBigIntegerInfixExpression(node, left, right)
+	case left.Type() == environment.BOOLEAN_OBJ && right.Type() == environment.BOOLEAN_OBJ:
+		return evalBooleanInfixExpression(operator, left, right)
+	case left.Type() == environment.STRING_OBJ && right.Type() == environment.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	}
 	return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 }
 
-func evalIntegerInfixExpression(operator string, left, right environment.Object) environment.Object {
+// evalNullComparison compares null with a value of any type. Null is
+// only equal to itself and supports no other operators.
+func evalNullComparison(operator string, left, right environment.Object) environment.Object {
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(left == right)
+	case "!=":
+		return nativeBoolToBooleanObject(left != right)
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+func evalIntegerInfixExpression(node *ast.InfixExpression, left, right environment.Object, checked bool) environment.Object {
+	operator := node.Operator
 	l := left.(*environment.Integer).Value
 	r := right.(*environment.Integer).Value
 
+	switch operator {
+	case "+", "-", "*", "/", "%":
+		val, err := integerArithmetic(operator, l, r, checked)
+		if err != "" {
+			return runtimePanic(node.Token, "%s", err)
+		}
+		return &environment.Integer{Value: val}
+	case "..", "..=":
+		return &environment.Range{Start: l, End: r, Inclusive: operator == "..="}
+	case "&":
+		return &environment.Integer{Value: l & r}
+	case "|":
+		return &environment.Integer{Value: l | r}
+	case "^":
+		return &environment.Integer{Value: l ^ r}
+	case "==":
+		return nativeBoolToBooleanObject(l == r)
+	case "!=":
+		return nativeBoolToBooleanObject(l != r)
+	case "<":
+		return nativeBoolToBooleanObject(l < r)
+	case ">":
+		return nativeBoolToBooleanObject(l > r)
+	case "<=":
+		return nativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return nativeBoolToBooleanObject(l >= r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalBooleanInfixExpression(operator string, left, right environment.Object) environment.Object {
+	l := left.(*environment.Boolean).Value
+	r := right.(*environment.Boolean).Value
+
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(l == r)
+	case "!=":
+		return nativeBoolToBooleanObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalStringInfixExpression(operator string, left, right environment.Object) environment.Object {
+	l := left.(*environment.String).Value
+	r := right.(*environment.String).Value
+
 	switch operator {
 	case "+":
-		return &environment.Integer{Value: l + r}
-	case "-":
-		return &environment.Integer{Value: l - r}
-	case "*":
-		return &environment.Integer{Value: l * r}
-	case "/":
-		return &environment.Integer{Value: l / r}
+		return &environment.String{Value: l + r}
+	case "==":
+		return nativeBoolToBooleanObject(l == r)
+	case "!=":
+		return nativeBoolToBooleanObject(l != r)
+	case "<":
+		return nativeBoolToBooleanObject(l < r)
+	case ">":
+		return nativeBoolToBooleanObject(l > r)
+	case "<=":
+		return nativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return nativeBoolToBooleanObject(l >= r)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -143,9 +695,70 @@ func evalIdentifier(node *ast.Identifier, env *environment.Environment) environm
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+	if env.Restricted() {
+		// The resolver has found the name, so it is a variable that only
+		// has a value once the program runs.
+		return newError("line %d:%d: %s is not known at compile time", node.Token.Line, node.Token.Column, node.Value)
+	}
 	return newError("identifier not found: %s", node.Value)
 }
 
+// evalTryExpression unwraps an Ok result, or returns an Err result from
+// the enclosing function.
+func evalTryExpression(te *ast.TryExpression, env *environment.Environment) environment.Object {
+	val := Eval(te.Expression, env)
+	if isAbrupt(val) {
+		return val
+	}
+	result, ok := val.(*environment.Result)
+	if !ok {
+		return newError("line %d:%d: ? applied to %s, not a Result", te.Token.Line, te.Token.Column, val.Type())
+	}
+	if !result.Ok {
+		return &environment.ReturnValue{Value: result}
+	}
+	return result.Value
+}
+
+func evalMemberExpression(object environment.Object, member *ast.Identifier) environment.Object {
+	if r, ok := object.(*environment.Record); ok {
+		return evalRecordMember(r, member)
+	}
+	mod, ok := object.(*environment.Module)
+	if !ok {
+		return newError("%s has no member %s", object.Type(), member.Value)
+	}
+	if val, ok := mod.Exports[member.Value]; ok {
+		return val
+	}
+	return newError("module %s has no exported member %s", mod.Name, member.Value)
+}
+
+func nativeBoolToBooleanObject(b bool) *environment.Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
+func isTruthy(obj environment.Object) bool {
+	switch obj := obj.(type) {
+	case *environment.Boolean:
+		return obj.Value
+	case *environment.Null:
+		return false
+	case *environment.NamedValue:
+		return isTruthy(obj.Value)
+	case nil:
+		return false
+	default:
+		return true
+	}
+}
+
 func newError(format string, a ...interface{}) *environment.Error {
 	return &environment.Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -156,3 +769,17 @@ func isError(obj environment.Object) bool {
 	}
 	return false
 }
+
+// isAbrupt reports whether obj interrupts normal evaluation and must be
+// passed up unchanged: an error, a panic, or a value being returned from
+// the enclosing function, which `?` can produce in the middle of an
+// expression.
+func isAbrupt(obj environment.Object) bool {
+	if obj != nil {
+		switch obj.Type() {
+		case environment.ERROR_OBJ, environment.PANIC_OBJ, environment.RETURN_VALUE_OBJ, environment.BRANCH_OBJ:
+			return true
+		}
+	}
+	return false
+}
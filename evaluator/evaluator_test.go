@@ -0,0 +1,1600 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"compiler/ast"
+	"compiler/environment"
+	"compiler/lexer"
+	"compiler/parser"
+)
+
+func testEval(t *testing.T, input string) environment.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return Eval(program, environment.NewEnvironment())
+}
+
+func testRun(t *testing.T, input string) environment.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return Run(program, environment.NewEnvironment())
+}
+
+func testIntegerObject(t *testing.T, obj environment.Object, expected int64) {
+	t.Helper()
+	result, ok := obj.(*environment.Integer)
+	if !ok {
+		t.Fatalf("object is not Integer. got=%T (%+v)", obj, obj)
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+}
+
+func testErrorObject(t *testing.T, obj environment.Object, expected string) {
+	t.Helper()
+	errObj, ok := obj.(*environment.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", obj, obj)
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, expected)
+	}
+}
+
+func testPanicObject(t *testing.T, obj environment.Object, expected string) {
+	t.Helper()
+	p, ok := obj.(*environment.Panic)
+	if !ok {
+		t.Fatalf("no panic returned. got=%T (%+v)", obj, obj)
+	}
+	if got := p.Value.Inspect(); got != expected {
+		t.Errorf("wrong panic value. got=%q, want=%q", got, expected)
+	}
+}
+
+func TestFunctionDeclarationIsBound(t *testing.T) {
+	input := `
+func Integer double(x) {
+	return x * 2;
+}
+double(21);`
+	testIntegerObject(t, testEval(t, input), 42)
+}
+
+func TestFunctionsAreHoisted(t *testing.T) {
+	input := `
+func Integer main() {
+	if (isEven(10)) {
+		return 1;
+	}
+	return 0;
+}
+
+func isEven(n) {
+	if (n == 0) {
+		return true;
+	}
+	return isOdd(n - 1);
+}
+
+func isOdd(n) {
+	if (n == 0) {
+		return false;
+	}
+	return isEven(n - 1);
+}`
+	testIntegerObject(t, testRun(t, input), 1)
+}
+
+func TestEarlyReturnFromNestedBlock(t *testing.T) {
+	input := `
+func Integer main() {
+	if (true) {
+		if (true) {
+			return 7;
+		}
+		return 8;
+	}
+	return 9;
+}`
+	testIntegerObject(t, testRun(t, input), 7)
+}
+
+func TestRunWithoutMain(t *testing.T) {
+	testErrorObject(t, testRun(t, "let x = 1;"), "no main function declared")
+}
+
+func TestAssignmentUpdatesDeclaringScope(t *testing.T) {
+	input := `
+func Integer main() {
+	let total = 1;
+	if (true) {
+		total = total + 41;
+	}
+	return total;
+}`
+	testIntegerObject(t, testRun(t, input), 42)
+}
+
+func TestLetShadowsOuterVariable(t *testing.T) {
+	input := `
+func Integer main() {
+	let x = 1;
+	if (true) {
+		let x = 2;
+		x = 3;
+	}
+	return x;
+}`
+	testIntegerObject(t, testRun(t, input), 1)
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const limit = 10;\nlimit = 11;", "line 2:1: cannot assign to constant limit"},
+		{"func f() { missing = 1; }\nf();", "line 1:12: cannot assign to undeclared variable missing"},
+		{"const c = 1;\nfunc f() { c = 2; }\nf();", "line 2:12: cannot assign to constant c"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestMultipleReturnValues(t *testing.T) {
+	input := `
+func (Integer, Integer) divmod(a, b) {
+	return a / b, a - a / b * b;
+}
+
+func Integer main() {
+	let q, r = divmod(7, 2);
+	return q * 10 + r;
+}`
+	testIntegerObject(t, testRun(t, input), 31)
+}
+
+func TestTupleOfMixedTypes(t *testing.T) {
+	input := `
+func (Integer, String) lookup() {
+	return 404, "not found";
+}
+let code, msg = lookup();
+msg + "!";`
+	result, ok := testEval(t, input).(*environment.String)
+	if !ok || result.Value != "not found!" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestDestructuringArityMismatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"func f() { return 1, 2, 3; }\nlet a, b = f();", "line 2:1: assignment mismatch: 2 names but 3 values"},
+		{"func f() { return 1; }\nlet a, b = f();", "line 2:1: assignment mismatch: 2 names but 1 value"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestGenericFunctionInstantiation(t *testing.T) {
+	input := `
+func T max[T Integer | String](T a, T b) {
+	if (a > b) {
+		return a;
+	}
+	return b;
+}
+
+func Integer main() {
+	if (max("apple", "pear") != "pear") {
+		return 1;
+	}
+	return max(3, 7);
+}`
+	testIntegerObject(t, testRun(t, input), 7)
+}
+
+func TestGenericParametersOfNamedTypes(t *testing.T) {
+	input := `
+interface Shape { Integer area(); }
+
+record Sq {
+	Integer side;
+	func Integer area() { return side * side; }
+}
+
+type UserID = Integer;
+
+func T pick[T](Shape s, T x) { return x; }
+func T tag[T](UserID id, T x) { return x; }
+
+func Integer main() {
+	return pick(Sq(2), 3) + tag(4, 5);
+}`
+	testIntegerObject(t, testRun(t, input), 8)
+}
+
+func TestGenericInstantiationErrors(t *testing.T) {
+	decl := "func T max[T Integer | String](T a, T b) { return a; }\n"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{decl + `max(1, "one");`, "max: type parameter T inferred as both Integer and String"},
+		{decl + `max(true, false);`, "max: Boolean does not satisfy T Integer | String"},
+		{"func T first[T](Integer n) { return n; }\nfirst(1);", "first: cannot infer type parameter T"},
+		{"func T wrong[T](T a) { return \"x\"; }\nwrong(1);", "wrong: type parameter T inferred as both Integer and String"},
+		{"type UserID = Integer;\nfunc T tag[T](UserID id, T x) { return x; }\ntag(\"a\", 1);", "tag: cannot use String as UserID"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestResultPropagation(t *testing.T) {
+	input := `
+func Result[Integer] half(n) {
+	if (n / 2 * 2 != n) {
+		return Err("odd number");
+	}
+	return Ok(n / 2);
+}
+
+func Result[Integer] quarter(n) {
+	let h = half(n)?;
+	return Ok(half(h)? + 0);
+}
+
+func Integer main() {
+	let good = quarter(12);
+	let bad = quarter(6);
+	if (isErr(bad)) {
+		if (message(bad) == "odd number") {
+			return unwrap(good);
+		}
+	}
+	return 0;
+}`
+	testIntegerObject(t, testRun(t, input), 3)
+}
+
+func TestBuiltinFailuresAreResults(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`message(div(1, 0));`, "division by zero"},
+		{`message(at("abc", 5));`, "index out of range [5] with length 3"},
+		{`unwrapOr(at("abc", 1), "?");`, "b"},
+	}
+	for _, tt := range tests {
+		result, ok := testEval(t, tt.input).(*environment.String)
+		if !ok || result.Value != tt.expected {
+			t.Errorf("%s = %+v; want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestTryOnNonResult(t *testing.T) {
+	testErrorObject(t, testEval(t, "let x = 1?;"), "line 1:10: ? applied to INTEGER, not a Result")
+}
+
+func TestPanicUnwindsWithTrace(t *testing.T) {
+	input := `
+func fail(n) {
+	if (n == 0) {
+		panic("boom");
+	}
+	return fail(n - 1);
+}
+
+func Integer main() {
+	fail(1);
+	return 0;
+}`
+	p, ok := testRun(t, input).(*environment.Panic)
+	if !ok {
+		t.Fatalf("expected a panic")
+	}
+	want := "panic: boom\n\tpanic (line 4:8)\n\tfail (line 6:13)\n\tfail (line 10:6)\n\tmain"
+	if got := p.Inspect(); got != want {
+		t.Errorf("Inspect() = %q; want %q", got, want)
+	}
+}
+
+func TestRecoverCatchesPanics(t *testing.T) {
+	input := `
+func Integer risky(n) {
+	if (n > 2) {
+		panic("too big");
+	}
+	return n;
+}
+
+func Integer main() {
+	let caught = recover(risky(5));
+	let fine = recover(risky(2));
+	if (message(caught) == "too big") {
+		return unwrap(fine);
+	}
+	return 0;
+}`
+	testIntegerObject(t, testRun(t, input), 2)
+}
+
+func TestGoRuntimePanicsBecomeBluePanics(t *testing.T) {
+	builtins["crash"] = &environment.Builtin{Name: "crash", Fn: func(args ...environment.Object) environment.Object {
+		var tuple *environment.Tuple
+		return tuple.Elements[0]
+	}}
+	defer delete(builtins, "crash")
+
+	input := `
+func Integer fail() {
+	return crash();
+}
+
+func Integer main() {
+	let r = recover(fail());
+	if (isErr(r)) {
+		return fail();
+	}
+	return 0;
+}`
+	p, ok := testRun(t, input).(*environment.Panic)
+	if !ok {
+		t.Fatalf("expected a panic")
+	}
+	if len(p.Trace) != 3 || p.Trace[0] != "crash (line 3:14)" || p.Trace[1] != "fail (line 9:14)" {
+		t.Errorf("unexpected trace: %q", p.Trace)
+	}
+}
+
+func TestStackOverflowPanics(t *testing.T) {
+	input := `
+func Integer down(Integer n) {
+	return down(n + 1) + 1;
+}
+
+func Integer main() {
+	let r = recover(down(0));
+	if (message(r) == "line 2:1: stack overflow") {
+		return down(0);
+	}
+	return 0;
+}`
+	obj := testRun(t, input)
+	testPanicObject(t, obj, "line 2:1: stack overflow")
+	if got := obj.Inspect(); !strings.Contains(got, fmt.Sprintf("... %d more calls", maxCallDepth+2-40)) {
+		t.Errorf("trace not shortened: %.200q", got)
+	}
+}
+
+func TestDeferredCallsRunLastInFirstOut(t *testing.T) {
+	input := `
+let log = "";
+
+func record(s) {
+	log = log + s;
+}
+
+func Integer work() {
+	defer record("a");
+	defer record("b");
+	if (true) {
+		defer record("c");
+		return 1;
+	}
+	return 2;
+}
+
+func Integer main() {
+	work();
+	if (log == "cba") {
+		return 0;
+	}
+	return 1;
+}`
+	testIntegerObject(t, testRun(t, input), 0)
+}
+
+func TestDeferredArgumentsAreCapturedEarly(t *testing.T) {
+	input := `
+let seen = 0;
+
+func note(n) {
+	seen = n;
+}
+
+func Integer work() {
+	let x = 1;
+	defer note(x);
+	x = 2;
+	return x;
+}
+
+func Integer main() {
+	return work() * 10 + seen;
+}`
+	testIntegerObject(t, testRun(t, input), 21)
+}
+
+func TestDeferredRecoverStopsPanic(t *testing.T) {
+	input := `
+let caught = "";
+
+func handle() {
+	caught = recover();
+}
+
+func work() {
+	defer handle();
+	panic("boom");
+}
+
+func Integer main() {
+	work();
+	if (caught == "boom") {
+		return 0;
+	}
+	return 1;
+}`
+	testIntegerObject(t, testRun(t, input), 0)
+}
+
+func TestDeferredCallsRunWhilePanicking(t *testing.T) {
+	input := `
+let cleaned = false;
+
+func cleanup() {
+	cleaned = true;
+}
+
+func work() {
+	defer cleanup();
+	panic("boom");
+}
+
+func Integer main() {
+	let r = recover(work());
+	if (cleaned) {
+		if (isErr(r)) {
+			return 0;
+		}
+	}
+	return 1;
+}`
+	testIntegerObject(t, testRun(t, input), 0)
+}
+
+func TestForLoops(t *testing.T) {
+	input := `
+func Integer main() {
+	let i = 0;
+	let sum = 0;
+	for (i < 10) {
+		i = i + 1;
+		if (i == 3) {
+			continue;
+		}
+		sum = sum + i;
+	}
+	for {
+		if (sum > 100) {
+			break;
+		}
+		sum = sum * 2;
+	}
+	return sum;
+}`
+	testIntegerObject(t, testRun(t, input), 104)
+}
+
+func TestBranchOutsideLoop(t *testing.T) {
+	input := `
+func f() {
+	break;
+}
+
+func Integer main() {
+	for {
+		f();
+		return 1;
+	}
+}`
+	testErrorObject(t, testRun(t, input), "line 3:2: break is not in a loop")
+}
+
+func TestArityIsCheckedAtCallTime(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"func add(a, b) { return a + b; } add(1);", "add expects 2 arguments, got 1"},
+		{"func add(a, b) { return a + b; } add(1, 2, 3);", "add expects 2 arguments, got 3"},
+		{"func f(a, ...rest) { return a; } f();", "f expects at least 1 argument, got 0"},
+		{"len();", "len expects 1 argument, got 0"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(t, tt.input), tt.want)
+	}
+}
+
+func TestVariadicArgumentsAreCollected(t *testing.T) {
+	input := `
+func Integer sum(...Integer nums) {
+	let total = 0;
+	let i = 0;
+	for (i < len(nums)) {
+		total = total + unwrap(at(nums, i));
+		i = i + 1;
+	}
+	return total;
+}
+
+func Integer main() {
+	return sum() + sum(1) + sum(2, 3, 4);
+}`
+	testIntegerObject(t, testRun(t, input), 10)
+}
+
+func TestDivisionByZeroPanics(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"let x = 0; 1 / x;", "line 1:14: integer divide by zero"},
+		{"let x = 0;\n7 % x;", "line 2:3: integer divide by zero"},
+	}
+	for _, tt := range tests {
+		testPanicObject(t, testEval(t, tt.input), tt.want)
+	}
+	testIntegerObject(t, testEval(t, "7 % 3;"), 1)
+	testIntegerObject(t, testEval(t, "-7 % 3;"), -1)
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	input := `
+func Integer wraps(n) {
+	return n + 1;
+}
+
+@checked
+func Integer traps(n) {
+	return n + 1;
+}
+
+let max = 9223372036854775807;
+`
+	wraps := input + "wraps(max);"
+	testIntegerObject(t, testEval(t, wraps), math.MinInt64)
+	testPanicObject(t, testEval(t, input+"traps(max);"), "line 8:11: integer overflow: 9223372036854775807 + 1")
+
+	CheckedArithmetic = true
+	defer func() { CheckedArithmetic = false }()
+	testPanicObject(t, testEval(t, wraps), "line 3:11: integer overflow: 9223372036854775807 + 1")
+	testIntegerObject(t, testEval(t, input+"wrapping_add(max, 1);"), math.MinInt64)
+	testPanicObject(t, testEval(t, "-9223372036854775807 * 2;"), "line 1:22: integer overflow: -9223372036854775807 * 2")
+}
+
+func TestRecoverCatchesArithmeticFailures(t *testing.T) {
+	input := `
+func Integer divide(a) {
+	return 10 / a;
+}
+
+@checked
+func Integer next(n) {
+	return n + 1;
+}
+`
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"recover(divide(0));", "Err(line 3:12: integer divide by zero)"},
+		{"recover(divide(5));", "Ok(2)"},
+		{"recover(next(9223372036854775807));", "Err(line 8:11: integer overflow: 9223372036854775807 + 1)"},
+		{"recover(Int8(100) * 2);", "Ok(-56)"},
+		{"recover(1n % 0n);", "Err(line 10:12: integer divide by zero)"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, input+tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestBigIntegerArithmetic(t *testing.T) {
+	input := `
+func BigInteger factorial(BigInteger n) {
+	if (n <= 1n) {
+		return 1n;
+	}
+	return n * factorial(n - 1n);
+}
+
+factorial(25n);
+`
+	result, ok := testEval(t, input).(*environment.BigInteger)
+	if !ok {
+		t.Fatalf("expected a BigInteger")
+	}
+	if got, want := result.Inspect(), "15511210043330985984000000"; got != want {
+		t.Errorf("factorial(25n) = %s; want %s", got, want)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"-7n / 2n;", "-3"},
+		{"-7n % 2n;", "-1"},
+		{"BigInteger(9223372036854775807) + 1n;", "9223372036854775808"},
+		{`BigInteger("123456789012345678901234567890") - 1n;`, "123456789012345678901234567889"},
+		{"Integer(42n) + 1;", "43"},
+		{"100000000000000000000n > 99999999999999999999n;", "true"},
+		{"6n & 3n;", "2"},
+		{"6n | 3n;", "7"},
+		{"6n ^ 3n;", "5"},
+		{"-6n & 3n;", "2"},
+		{"18446744073709551616n | 1n;", "18446744073709551617"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+
+	testErrorObject(t, testEval(t, "Integer(9223372036854775808n);"), "BigInteger 9223372036854775808 overflows Integer")
+	testPanicObject(t, testEval(t, "1n / 0n;"), "line 1:4: integer divide by zero")
+}
+
+func TestSizedIntegers(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Int8(127) + 1;", "-128"},
+		{"UInt8(0) - 1;", "255"},
+		{"Byte(300);", "44"},
+		{"Int32(-1) * Int32(2);", "-2"},
+		{"UInt64(0) - 1;", "18446744073709551615"},
+		{"UInt64(0) - 1 > UInt64(1);", "true"},
+		{"Int16(-7) / 2;", "-3"},
+		{"Integer(UInt32(4294967295));", "4294967295"},
+		{"BigInteger(UInt64(0) - 1) + 1n;", "18446744073709551616"},
+		{"-Int8(-128);", "-128"},
+		{"UInt8(1) << 9;", "0"},
+		{"Int8(-128) >> 7;", "-1"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+
+	testErrorObject(t, testEval(t, "Int8(1) + 200;"), "line 1:11: constant 200 overflows Int8")
+	testErrorObject(t, testEval(t, "Int8(1) + Int16(1);"), "type mismatch: INT8 + INT16")
+	testPanicObject(t, testEval(t, "Int32(1) / 0;"), "line 1:10: integer divide by zero")
+	testPanicObject(t, testEval(t, "@checked func f(x) { return x + 1; } f(Int8(127));"),
+		"line 1:31: Int8 overflow: 127 + 1")
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"12 & 10;", "8"},
+		{"12 | 10;", "14"},
+		{"12 ^ 10;", "6"},
+		{"~0;", "-1"},
+		{"1 << 62;", "4611686018427387904"},
+		{"1 << 64;", "0"},
+		{"-16 >> 2;", "-4"},
+		{"~UInt8(0);", "255"},
+		{"UInt16(65280) & UInt16(4080) | 1;", "3841"},
+		{"1n << 100;", "1267650600228229401496703205376"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+	testErrorObject(t, testEval(t, "1 << -1;"), "line 1:3: negative shift count -1")
+}
+
+func TestNullableValues(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"null;", "null"},
+		{"let Integer? x = null; x ?? 5;", "5"},
+		{"let Integer? x = 3; x ?? 5;", "3"},
+		{"null == null;", "true"},
+		{"let Integer? x = 3; x != null;", "true"},
+		{"let x = 1; null == x;", "false"},
+		{`let m = null; m?.name;`, "null"},
+		{"func f() { } f();", "null"},
+		{"func Integer? find(Integer n) { if (n > 1) { return n; } return null; } find(0) ?? find(2);", "2"},
+		{"func T? first[T](...T xs) { if (len(xs) == 0) { return null; } return unwrap(at(xs, 0)); } first(7) ?? first(8);", "7"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+
+	// The default is not evaluated when the value is not null.
+	testPanicObject(t, testEval(t, "let x = null; x ?? 1 / 0;"), "line 1:22: integer divide by zero")
+	if got := testEval(t, "1 ?? 1 / 0;").Inspect(); got != "1" {
+		t.Errorf("1 ?? 1 / 0 = %s; want 1", got)
+	}
+	testErrorObject(t, testEval(t, "null + 1;"), "unknown operator: NULL + INTEGER")
+}
+
+func TestTypeDeclarations(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"type Meters Integer; Meters(5);", "Meters(5)"},
+		{"type Meters Integer; Meters(5) + Meters(2) * 3;", "Meters(11)"},
+		{"type Meters Integer; -Meters(5);", "Meters(-5)"},
+		{"type Meters Integer; Meters(5) > Meters(2);", "true"},
+		{"type Meters Integer; type Feet Integer; Feet(Meters(3));", "Feet(3)"},
+		{"type UserID = Integer; UserID(7) + 1;", "8"},
+		{"type Level Int8; Level(127) + 1;", "Level(-128)"},
+		{"type Name String; Name(\"ada\");", "Name(ada)"},
+		{"type Km Meters; type Meters Integer; Km(Meters(2)) << 1;", "Km(4)"},
+		{"type Flag Boolean; if (Flag(false)) { 1; } else { 2; }", "2"},
+		{"func Meters double(Meters m) { return m * 2; } type Meters Integer; double(Meters(4));", "Meters(8)"},
+		// A named value converts back to its base type and to other
+		// integer types.
+		{"type Meters Integer; let m = Meters(5); Integer(m) + 1;", "6"},
+		{"type Meters Integer; BigInteger(Meters(5)) * 2n;", "10"},
+		{"type Meters Integer; Int8(Meters(300));", "44"},
+		{"type Level Int8; Integer(Level(-3));", "-3"},
+		{"type Big BigInteger; Integer(Big(7n));", "7"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+
+	testErrorObject(t, testEval(t, "type Meters Integer; type Feet Integer; Meters(1) + Feet(1);"),
+		"type mismatch: METERS + FEET")
+	testErrorObject(t, testEval(t, "type Meters Integer; let x = 1; Meters(1) + x;"),
+		"type mismatch: METERS + INTEGER")
+	testErrorObject(t, testEval(t, "type Name String; Name(1);"), "cannot convert Integer to String")
+}
+
+func TestRecordsAndInterfaces(t *testing.T) {
+	shapes := `
+interface Shape { Integer area(); }
+record Rect {
+	Integer w;
+	Integer h;
+	func Integer area() { return self.w * self.h; }
+}
+record Square {
+	Integer side;
+	func Integer area() { return Rect(self.side, self.side).area(); }
+}
+record Label {
+	String text;
+	func String area() { return self.text; }
+}
+type Area = Integer;
+record Circle {
+	Integer r;
+	func Area area() { return 3 * self.r * self.r; }
+}
+func Integer size(s) {
+	switch (s) {
+	case Square sq { return sq.side; }
+	case Shape { return s.area(); }
+	}
+	return -1;
+}
+`
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Rect(2, 3);", "Rect{w: 2, h: 3}"},
+		{"Rect(2, 3).h;", "3"},
+		{"Rect(2, 3).area();", "6"},
+		{"let f = Square(4).area; f();", "16"},
+		{"let Shape s = Square(2); s.area() + Rect(1, 5).area();", "9"},
+		{"size(Square(7)) * 100 + size(Rect(2, 2));", "704"},
+		{"size(1);", "-1"},
+		// A method with the right name but another signature does not
+		// make a record a Shape; an alias is the type it names.
+		{`size(Label("wide"));`, "-1"},
+		{"size(Circle(2));", "12"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, shapes+tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+
+	testErrorObject(t, testEval(t, shapes+"Rect(1);"), "Rect expects 2 arguments, got 1")
+	testErrorObject(t, testEval(t, shapes+"Rect(1, 2).depth;"), "line 28:12: Rect has no field or method depth")
+}
+
+func TestForInLoops(t *testing.T) {
+	input := `
+let left = 3;
+
+record Countdown {
+	func Integer? next() {
+		if (left == 0) {
+			return null;
+		}
+		left = left - 1;
+		return left + 1;
+	}
+}
+
+func Integer main() {
+	let sum = 0;
+	for (i in 0..10) {
+		sum = sum + i;
+	}
+	for (i in 1..=5) {
+		if (i == 2) {
+			continue;
+		}
+		if (i == 4) {
+			break;
+		}
+		sum = sum + i * 100;
+	}
+	for (n in Countdown()) {
+		sum = sum + n * 1000;
+	}
+	for (i in 5..5) {
+		return -1;
+	}
+	return sum;
+}`
+	testIntegerObject(t, testRun(t, input), 45+400+6000)
+}
+
+func TestForInOverTuples(t *testing.T) {
+	input := `
+func Integer sum(...Integer ns) {
+	let s = 0;
+	for (n in ns) {
+		s = s + n;
+	}
+	return s;
+}
+
+func Generator[Integer] upTo(Integer n) {
+	for (i in 1..=n) {
+		yield i;
+	}
+}
+
+func Integer main() {
+	let s = sum(1, 2, 3);
+	for (d in map(upTo(3), (x) => x * 10)) {
+		s = s + d;
+	}
+	for (x in collect(upTo(4))) {
+		s = s + x * 100;
+	}
+	for (x in filter(collect(1..=4), (x) => x > 2)) {
+		s = s + x * 1000;
+	}
+	return s;
+}`
+	testIntegerObject(t, testRun(t, input), 6+60+1000+7000)
+}
+
+func TestRanges(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"0..10;", "0..10"},
+		{"let n = 3; 1..=n * 2;", "1..=6"},
+		{"let last = 0; for (i in 9223372036854775806..=9223372036854775807) { last = i; } last;", "9223372036854775807"},
+		{"let r = 0..3; let s = 0; for (i in r) { s = s + i; } for (i in r) { s = s + i; } s;", "6"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+
+	testErrorObject(t, testEval(t, `for (c in "abc") { }`), `line 1:1: cannot range over "abc" (type String)`)
+	testErrorObject(t, testEval(t, `0.."a";`), "type mismatch: INTEGER .. STRING")
+}
+
+func TestGenerators(t *testing.T) {
+	input := `
+func Generator[Integer] count(Integer from, Integer to) {
+	for (i in from..to) {
+		yield i;
+	}
+}
+
+func Generator[Integer] evens(Generator[Integer] g) {
+	for (n in g) {
+		if (n % 2 == 0) {
+			yield n;
+		}
+	}
+}
+
+func Integer main() {
+	let total = 0;
+	for (n in evens(count(0, 10))) {
+		total = total + n;
+	}
+	let g = count(100, 103);
+	let a = unwrap(next(g));
+	let rest = collect(g);
+	if (isOk(next(g))) {
+		return -1;
+	}
+	return total + a + len(rest) * 1000;
+}`
+	testIntegerObject(t, testRun(t, input), 20+100+2000)
+}
+
+func TestGeneratorsAreLazy(t *testing.T) {
+	input := `
+let started = 0;
+
+func Generator[Integer] naturals() {
+	started = started + 1;
+	let n = 0;
+	for {
+		yield n;
+		n = n + 1;
+	}
+}
+
+func Integer main() {
+	let g = naturals();
+	if (started != 0) {
+		return -1;
+	}
+	let sum = 0;
+	for (n in g) {
+		if (n > 4) {
+			break;
+		}
+		sum = sum + n;
+	}
+	return sum * 10 + started;
+}`
+	testIntegerObject(t, testRun(t, input), 101)
+}
+
+func TestAbandonedGeneratorsAreClosed(t *testing.T) {
+	input := `
+let closed = 0;
+
+func done() {
+	closed = closed + 1;
+}
+
+func Generator[Integer] count() {
+	defer done();
+	yield 1;
+	yield 2;
+	closed = closed + 100;
+}
+
+func Integer main() {
+	for (n in count()) {
+		break;
+	}
+	let afterBreak = closed;
+
+	let g = count();
+	next(g);
+	return afterBreak;
+}`
+	p := parser.New(lexer.New(input))
+	env := environment.NewEnvironment()
+	testIntegerObject(t, Run(p.ParseProgram(), env), 1)
+
+	// The generator main left suspended is closed when main returns.
+	closed, _ := env.Get("closed")
+	testIntegerObject(t, closed, 2)
+}
+
+func TestNextTellsFinishedGeneratorsFromNull(t *testing.T) {
+	input := "func Generator[Integer?] g() { yield null; } let it = g(); "
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"next(it);", "Ok(null)"},
+		{"next(it); next(it);", "Err(generator finished)"},
+		{"next(it); next(it); next(it);", "Err(generator finished)"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, input+tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestUnreachableGeneratorsAreClosed(t *testing.T) {
+	input := `
+let closed = 0;
+
+func done() {
+	closed = closed + 1;
+}
+
+func Generator[Integer] nat() {
+	defer done();
+	let n = 0;
+	for {
+		yield n;
+		n = n + 1;
+	}
+}
+
+for (i in 0..1000) {
+	let g = nat();
+	next(g);
+}`
+	env := environment.NewEnvironment()
+	Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	// The generators are closed as the garbage collector finds them,
+	// without waiting for the program to end.
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		if closed, _ := env.Get("closed"); closed.(*environment.Integer).Value == 1000 {
+			return
+		}
+	}
+	closed, _ := env.Get("closed")
+	t.Errorf("closed = %s; want 1000", closed.Inspect())
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	input := `
+func Generator[Integer] failing() {
+	yield 1;
+	yield 1 / 0;
+}
+
+`
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"next(1..3);", "argument to `next` not supported, got RANGE"},
+		{"collect(1);", "argument to `collect` not supported, got INTEGER"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(t, input+tt.input), tt.want)
+	}
+	testPanicObject(t, testEval(t, input+"collect(failing());"), "line 4:10: integer divide by zero")
+	testPanicObject(t, testEval(t, input+"let g = failing(); next(g); next(g);"), "line 4:10: integer divide by zero")
+
+	reentrant := []string{
+		"let g = null; func Generator[Integer] self() { yield 1; yield next(g); } g = self(); next(g); next(g);",
+		"let g = null; func Generator[Integer] self() { for (n in g) { yield n; } } g = self(); next(g);",
+		`let a = null; let b = null;
+func Generator[Integer] outer() { yield next(b); }
+func Generator[Integer] inner() { yield next(a); }
+a = outer(); b = inner(); next(a);`,
+	}
+	for _, input := range reentrant {
+		err, ok := testEval(t, input).(*environment.Error)
+		if !ok || !strings.HasSuffix(err.Message, "is already running") {
+			t.Errorf("%s: got %v; want an already running error", input, err)
+		}
+	}
+}
+
+func TestSharedGenerators(t *testing.T) {
+	input := `
+func Generator[Integer] nat() {
+	let n = 0;
+	for {
+		yield n;
+		n = n + 1;
+	}
+}
+
+func take(Generator[Integer] g, chan[Integer] out) {
+	let sum = 0;
+	for (i in 0..100) {
+		sum = sum + unwrap(next(g));
+	}
+	send(out, sum);
+}
+
+func Integer main() {
+	let g = nat();
+	let out = chan[Integer](3);
+	for (i in 0..3) {
+		spawn take(g, out);
+	}
+	wait();
+	close(out);
+	let total = 0;
+	for (s in out) {
+		total = total + s;
+	}
+	return total;
+}`
+	testIntegerObject(t, testRun(t, input), 299*300/2)
+}
+
+func TestSpawnAndChannels(t *testing.T) {
+	input := `
+func square(chan[Integer] jobs, chan[Integer] out) {
+	for (n in jobs) {
+		send(out, n * n);
+	}
+}
+
+func Integer main() {
+	let jobs = chan[Integer](10);
+	let out = chan[Integer](10);
+	for (w in 0..3) {
+		spawn square(jobs, out);
+	}
+	for (i in 1..=4) {
+		send(jobs, i);
+	}
+	close(jobs);
+	wait();
+	close(out);
+
+	let sum = 0;
+	for (n in out) {
+		sum = sum + n;
+	}
+	if (isOk(recv(out))) {
+		return -1;
+	}
+	return sum;
+}`
+	testIntegerObject(t, testRun(t, input), 1+4+9+16)
+}
+
+func TestSelect(t *testing.T) {
+	input := `
+func Integer main() {
+	let ready = chan[Integer](1);
+	let idle = chan[Integer]();
+	let picked = 0;
+	select {
+	case recv(idle) v {
+		picked = 1;
+	}
+	default {
+		picked = 2;
+	}
+	}
+
+	send(ready, 40);
+	select {
+	case recv(idle) v {
+		return -1;
+	}
+	case recv(ready) v {
+		picked = picked + unwrap(v);
+	}
+	}
+
+	close(idle);
+	select {
+	case recv(idle) v {
+		if (isErr(v)) {
+			picked = picked + 100;
+		}
+	}
+	}
+
+	select {
+	case send(ready, 1) {
+		picked = picked + 1000;
+	}
+	}
+	return picked;
+}`
+	testIntegerObject(t, testRun(t, input), 1142)
+}
+
+func TestRecvTellsClosedChannelsFromNull(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"let c = chan[Integer?](1); send(c, null); recv(c);", "Ok(null)"},
+		{"let c = chan[Integer?](1); send(c, null); close(c); recv(c); recv(c);", "Err(channel closed)"},
+		{"let c = chan[Integer](1); close(c); let r = 0; select { case recv(c) v { r = v; } } r;", "Err(channel closed)"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDeadlocksAreErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"recv(chan[Integer]());", "deadlock: every task is blocked"},
+		{"send(chan[Integer](), 1);", "deadlock: every task is blocked"},
+		{"let c = chan[Integer](); select { case recv(c) v { } }", "line 1:26: deadlock: every task is blocked"},
+		{"let c = chan[Integer](1); send(c, 1); for (n in c) { }", "deadlock: every task is blocked"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(t, tt.input), tt.want)
+	}
+
+	// Programs that spawn tasks run to the end, so that the failures of
+	// their tasks are not left for the next program to find.
+	programs := []string{
+		"func f(c) { recv(c); } func main() { spawn f(chan[Integer]()); wait(); }",
+		"let c = chan[Integer](); func f() { send(c, 1); } func main() { spawn f(); spawn f(); recv(c); recv(c); recv(c); }",
+	}
+	for _, input := range programs {
+		testErrorObject(t, testRun(t, input), "deadlock: every task is blocked")
+	}
+
+	input := `
+func pass(chan[Integer] src, chan[Integer] out) {
+	for (n in src) {
+		send(out, n + 1);
+	}
+	close(out);
+}
+
+func Integer main() {
+	let first = chan[Integer]();
+	let c = first;
+	for (i in 0..10) {
+		let next = chan[Integer]();
+		spawn pass(c, next);
+		c = next;
+	}
+	send(first, 0);
+	close(first);
+	return unwrap(recv(c));
+}`
+	testIntegerObject(t, testRun(t, input), 10)
+}
+
+func TestRunWaitsForSpawnedTasks(t *testing.T) {
+	input := `
+let done = chan[Integer](3);
+
+func work(Integer n) {
+	spawn report(n);
+}
+
+func report(Integer n) {
+	send(done, n);
+}
+
+func Integer main() {
+	for (i in 0..3) {
+		spawn work(i);
+	}
+	return 0;
+}`
+	p := parser.New(lexer.New(input))
+	env := environment.NewEnvironment()
+	testIntegerObject(t, Run(p.ParseProgram(), env), 0)
+
+	done, _ := env.Get("done")
+	if n := len(done.(*environment.Channel).Ch); n != 3 {
+		t.Errorf("%d tasks reported when Run returned; want 3", n)
+	}
+}
+
+func TestTaskFailures(t *testing.T) {
+	input := `
+func fail(Integer n) {
+	if (n == 2) {
+		panic("task failed");
+	}
+}
+
+func Integer main() {
+	for (i in 0..4) {
+		spawn fail(i);
+	}
+	wait();
+	return 0;
+}`
+	p, ok := testRun(t, input).(*environment.Panic)
+	if !ok {
+		t.Fatalf("expected a panic")
+	}
+	want := "panic: task failed\n\tpanic (line 4:8)\n\tspawned fail (line 10:3)\n\tmain"
+	if got := p.Inspect(); got != want {
+		t.Errorf("Inspect() = %q; want %q", got, want)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"let c = chan[Integer](); close(c); send(c, 1);", "panic: send on closed channel\n\tsend (line 1:40)"},
+		{"let c = chan[Integer](); close(c); close(c);", "panic: close of closed channel\n\tclose (line 1:41)"},
+		{"send(1, 2);", "ERROR: first argument to `send` must be CHANNEL, got INTEGER"},
+		{"chan[Integer](-1);", "ERROR: line 1:1: negative channel capacity -1"},
+		{"wait(1);", "ERROR: wrong number of arguments to `wait`: got=1, want=0"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSharedVariablesAcrossTasks(t *testing.T) {
+	input := `
+let total = 0;
+let lock = chan[Integer](1);
+
+func add(Integer n) {
+	send(lock, 0);
+	total = total + n;
+	recv(lock);
+}
+
+func Integer main() {
+	for (i in 1..=50) {
+		spawn add(i);
+	}
+	wait();
+	return total;
+}`
+	testIntegerObject(t, testRun(t, input), 1275)
+}
+
+func TestPipelinesAndLambdas(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"let double = (x) => x * 2; double(21);", "42"},
+		{"let add = (Integer a, Integer b) => { return a + b; }; 3 |> add(4);", "7"},
+		{"let k = 10; let scale = (x) => x * k; k = 100; scale(2);", "200"},
+		{"let f = () => 1; f();", "1"},
+		{"let f = (x) => x + 1; f;", "(x) => (x + 1)"},
+		{"func inc(n) { return n + 1; } 1 |> inc |> inc;", "3"},
+		{"0..6 |> filter((n) => n % 2 == 0) |> map((n) => n * n);", "(0, 4, 16)"},
+		{"map(collect(1..=3), (x) => x + 1);", "(2, 3, 4)"},
+		{"let adder = (a) => (b) => a + b; adder(2)(3);", "5"},
+	}
+	for _, tt := range tests {
+		if got := testEval(t, tt.input).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+
+	testErrorObject(t, testEval(t, "filter(0..3, (x) => x);"), "function passed to `filter` must return BOOLEAN, got INTEGER")
+	testErrorObject(t, testEval(t, "map(1, (x) => x);"), "argument to `map` not supported, got INTEGER")
+	testErrorObject(t, testEval(t, "let f = (x) => x; f(1, 2);"), "lambda expects 1 argument, got 2")
+}
+
+func testExpand(t *testing.T, input string) (*ast.Program, []*CompileError) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return ExpandMacros(program)
+}
+
+const macros = `
+macro twice(e) { return quote(unquote(e) + unquote(e)); }
+macro unless(cond, body) { return quote { if (!(unquote(cond))) { unquote(body); } }; }
+macro double(x) { return quote { let tmp = unquote(x); result = tmp * 2; }; }
+macro inc(x) { return quote(unquote(x) + 1); }
+macro incTwice(x) { return quote(inc(inc(unquote(x)))); }
+macro answer() { return quote(unquote(6 * 7)); }
+`
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"twice(1 + 2);", "6"},
+		{"let total = 0; let add = (n) => { total = total + n; }; unless(total > 5, add(10)); unless(total > 5, add(100)); total;", "10"},
+		{"let tmp = 5; let result = 0; double(tmp + 1); result * 100 + tmp;", "1205"},
+		{"incTwice(1);", "3"},
+		{"twice(twice(1));", "4"},
+		{"answer();", "42"},
+		{"func Integer f(Integer n) { return twice(n); } f(4);", "8"},
+		// Only the uses of the quote's own bindings are renamed, not other
+		// uses of the same names.
+		{"const base = 10; let result = 0; macro m(e) { return quote { for (base in 0..1) { } result = base + unquote(e); }; } m(5); result;", "15"},
+		{"let limit = 3; let result = 0; macro m(e) { return quote { let f = (limit) => limit * unquote(e); result = f(limit); }; } m(2); result;", "6"},
+		{"let x = 1; macro m() { return quote { let y = x; if (true) { let x = 2; y = y + x; } x = y; }; } m(); x;", "3"},
+	}
+	for _, tt := range tests {
+		program, errs := testExpand(t, macros+tt.input)
+		if len(errs) > 0 {
+			t.Errorf("%s: expansion errors: %v", tt.input, errs)
+			continue
+		}
+		if got := Eval(program, environment.NewEnvironment()).Inspect(); got != tt.want {
+			t.Errorf("%s = %s; want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMacroExpansion(t *testing.T) {
+	program, errs := testExpand(t, "macro twice(e) { return quote(unquote(e) + unquote(e)); } let y = twice(x * 2);")
+	if len(errs) > 0 {
+		t.Fatalf("expansion errors: %v", errs)
+	}
+	if got, want := program.String(), "let y = ((x * 2) + (x * 2));"; got != want {
+		t.Errorf("expanded program = %q; want %q", got, want)
+	}
+
+	// The binding the macro introduces is renamed, while the spliced
+	// code keeps referring to the user's own tmp.
+	program, _ = testExpand(t, "macro double(x) { return quote { let tmp = unquote(x); tmp * 2; }; } let tmp = 1; double(tmp);")
+	let, ok := program.Statements[1].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] = %s; want a let statement", program.Statements[1])
+	}
+	fresh := let.Assignment.Name.Value
+	if !strings.HasPrefix(fresh, "tmp#") {
+		t.Fatalf("macro binding = %s; want a fresh name", fresh)
+	}
+	if got, want := program.String(), "let tmp = 1;let "+fresh+" = tmp;("+fresh+" * 2);"; got != want {
+		t.Errorf("expanded program = %q; want %q", got, want)
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"macro m(a) { return quote(a); } m(1, 2);", "line 1:34: macro m expects 1 argument, got 2"},
+		{"macro m() { return 1; } m();", "line 1:26: macro m must return quoted code, got INTEGER"},
+		{"macro m() { return quote(1); } macro m() { return quote(2); }", "line 1:38: macro m redeclared (previous declaration at line 1:7)"},
+		{"macro m(x) { return quote(m(unquote(x))); } m(1);", "line 1:28: macro m expands too deeply (more than 100 nested expansions)"},
+		{"macro m() { return quote { 1; }; } let y = m();", "line 1:45: macro m expands to statements, which cannot be used as a value"},
+		{"func f() { macro m() { return quote(1); } }", "line 1:12: macro m must be declared at the top level"},
+		{"macro m() { return quote(unquote(len)); } m();", "line 1:44: in macro m: line 1:33: cannot unquote a value of type BUILTIN"},
+		{"macro m(x) { return quote(unquote(x) + unquote(y)); } m(1);", "line 1:56: in macro m: identifier not found: y"},
+		{"macro m() { let b = quote { 1; }; return quote(1 + unquote(b)); } m();", "line 1:68: in macro m: line 1:59: cannot unquote statements where a value is expected"},
+	}
+	for _, tt := range tests {
+		_, errs := testExpand(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("%s: no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("%s: error = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func testComptime(t *testing.T, input string) (*ast.Program, []*CompileError) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return Comptime(program)
+}
+
+func TestComptime(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"const N = 2 * 3 + 1; const M = N * N;", "const N = 7;const M = 49;"},
+		{`const GREETING = "hello, " + "world"; const LOUD = !false;`, `const GREETING = "hello, world";const LOUD = true;`},
+		{"const BIG = 9223372036854775807n + 1n;", "const BIG = 9223372036854775808n;"},
+		{"func fib(n) { if (n < 2) { return n; } return fib(n - 1) + fib(n - 2); } const F = comptime { return fib(20); };",
+			"func fib(n) {\nif (n < 2) {\nreturn n;\n}\nreturn (fib((n - 1)) + fib((n - 2)));\n}const F = 6765;"},
+		{"const N = 4; let s = comptime { let s = 0; for (i in 0..N) { s = s + i; } s; };", "const N = 4;let s = 6;"},
+		{"func f() { return comptime { 1 + 1; }; }", "func f() {\nreturn 2;\n}"},
+		// Constants that are not constant expressions are evaluated when
+		// the program runs, and are unknown to later constants.
+		{"let x = 1; const Y = x + 1; const Z = Y * 2;", "let x = 1;const Y = (x + 1);const Z = (Y * 2);"},
+		{"const R = 0..3;", "const R = (0 .. 3);"},
+		{"const X = comptime { return Int8(3); };", "const X = Int8(3);"},
+		{"const X = comptime { return Int8(-3) * Int8(2); };", "const X = Int8(-6);"},
+		{"const X = comptime { return UInt64(0) - UInt64(1); };", "const X = UInt64(18446744073709551615n);"},
+		{"type Meters Integer; const D = comptime { return Meters(5); };", "type Meters Integer;const D = Meters(5);"},
+	}
+	for _, tt := range tests {
+		program, errs := testComptime(t, tt.input)
+		if len(errs) > 0 {
+			t.Errorf("%s: comptime errors: %v", tt.input, errs)
+			continue
+		}
+		if got := program.String(); got != tt.want {
+			t.Errorf("%s: folded program = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+
+	program, _ := testComptime(t, "const N = 10; func main() { return comptime { return N * N; } + N; }")
+	if got := Run(program, environment.NewEnvironment()).Inspect(); got != "110" {
+		t.Errorf("main() = %s; want 110", got)
+	}
+}
+
+func TestComptimeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"const A = 1 / 0;", "line 1:7: in constant A: panic: line 1:13: integer divide by zero"},
+		{`const A = "a" - 1;`, "line 1:7: in constant A: type mismatch: STRING - INTEGER"},
+		{"let x = 3; const B = comptime { x; };", "line 1:22: in comptime block: line 1:33: x is not known at compile time"},
+		{"func f() {} const C = comptime { spawn f(); return 1; };", "line 1:23: in comptime block: line 1:34: spawn is not allowed at compile time"},
+		{"const C = comptime { let c = chan[Integer](1); return 1; };", "line 1:11: in comptime block: line 1:30: creating a channel is not allowed at compile time"},
+		{"const C = comptime { wait(); return 1; };", "line 1:11: in comptime block: line 1:26: wait is not allowed at compile time"},
+		{`const C = comptime { import "m"; return 1; };`, "line 1:11: in comptime block: line 1:22: import is not allowed at compile time"},
+		{"const D = comptime { return (a) => a; };", "line 1:11: comptime block evaluates to FUNCTION, which cannot be written as a literal"},
+		{`const E = comptime { panic("no"); };`, "line 1:11: in comptime block: panic: no\n\tpanic (line 1:27)"},
+		{"func spin() { let i = 0; for (i >= 0) { i = i + 1; } } const F = comptime { spin(); };",
+			"line 1:66: in comptime block: compile-time evaluation takes more than 1000000 steps"},
+		{"func down(n) { return down(n - 1); } const G = comptime { return down(0); };",
+			"line 1:48: in comptime block: compile-time calls nest more than 10000 deep"},
+		{"const H = comptime { for (i in 0..2000000) { } };",
+			"line 1:11: in comptime block: compile-time evaluation takes more than 1000000 steps"},
+	}
+	for _, tt := range tests {
+		_, errs := testComptime(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("%s: no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("%s: error = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
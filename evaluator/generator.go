@@ -0,0 +1,274 @@
+package evaluator
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+
+	"compiler/ast"
+	"compiler/environment"
+)
+
+func init() {
+	// These builtins run Blue code, so they cannot be part of the
+	// builtins initializer.
+	builtins["next"] = &environment.Builtin{Name: "next", Fn: builtinNext}
+	builtins["collect"] = &environment.Builtin{Name: "collect", Fn: builtinCollect}
+}
+
+// newGenerator returns the generator for a call of the generator
+// function fl, whose arguments are bound in env. The body runs in a
+// goroutine of its own, but only while the generator's consumer waits
+// for it: resuming hands control to the body, and its next yield hands
+// control back. The two never run at the same time, so they share
+// environments safely.
+func newGenerator(fl *ast.FunctionalLiteral, env *environment.Environment, frame *environment.Frame) *environment.Generator {
+	co := &coroutine{
+		name:   fl.FunctionName.Value,
+		resume: make(chan bool),
+		yield:  make(chan environment.Object),
+		turn:   make(chan struct{}, 1),
+	}
+	co.turn <- struct{}{}
+	frame.Yield = co.suspend
+	frame.Generator = co
+	go co.run(func() environment.Object { return runBody(fl, env, frame) })
+
+	live.add(co)
+	g := &environment.Generator{Name: co.name, Resume: co.next, Stop: co.close}
+	// The body only refers to the coroutine, so once the program drops
+	// the generator it is closed, instead of holding on to its
+	// goroutine until the program ends.
+	runtime.SetFinalizer(g, func(*environment.Generator) { go co.close() })
+	return g
+}
+
+// currentGenerator returns the generator whose body code running in env
+// belongs to, or nil.
+func currentGenerator(env *environment.Environment) interface{} {
+	if frame := env.Frame(); frame != nil {
+		return frame.Generator
+	}
+	return nil
+}
+
+// coroutine is the body of a generator. Consumers take turns resuming
+// it, and its state is only changed by the one whose turn it is.
+type coroutine struct {
+	name   string
+	resume chan bool               // true to run to the next yield, false to stop
+	yield  chan environment.Object // the yielded values, closed when the body ends
+	result environment.Object      // what the body ended with
+
+	turn     chan struct{} // holds a token while no consumer has the turn
+	caller   *coroutine    // while the body runs, the generator whose body resumed it
+	stopping bool
+	finished bool
+}
+
+// run waits to be resumed for the first time and then runs body.
+func (co *coroutine) run(body func() environment.Object) {
+	defer close(co.yield)
+	if !<-co.resume {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			co.result = goPanic(r)
+		}
+	}()
+	co.result = body()
+}
+
+// suspend hands v to the consumer and waits to be resumed. It returns
+// false if the generator is stopped instead.
+func (co *coroutine) suspend(v environment.Object) bool {
+	if co.stopping {
+		return false
+	}
+	co.yield <- v
+	return <-co.resume
+}
+
+// next runs the body until it yields a value or ends, for code running
+// in the body of the generator caller, if any. Consumers in different
+// tasks wait for their turn, but resuming the generator from its own
+// body, directly or through the generators it resumes, is an error. A
+// body that ends with an error or panic yields it as its last value,
+// for the consumer to stop with.
+func (co *coroutine) next(caller interface{}) (environment.Object, bool) {
+	resumer, _ := caller.(*coroutine)
+	for c := resumer; c != nil; c = c.caller {
+		if c == co {
+			return newError("generator %s is already running", co.name), true
+		}
+	}
+	if _, _, _, deadlocked := tasks.wait([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(co.turn)}}); deadlocked {
+		return deadlockError(), true
+	}
+	defer func() { co.turn <- struct{}{} }()
+	if co.finished {
+		return nil, false
+	}
+
+	co.caller = resumer
+	co.resume <- true
+	v, ok := <-co.yield
+	co.caller = nil
+	if ok {
+		return v, true
+	}
+	co.finished = true
+	live.remove(co)
+	if isAbrupt(co.result) {
+		return co.result, true
+	}
+	return nil, false
+}
+
+// close stops a generator that has not finished, once no consumer is
+// resuming it. The yield it is suspended at returns from the body, so
+// its deferred calls run before close returns. Whatever they fail with
+// is dropped, as no one is left to report it to.
+func (co *coroutine) close() {
+	<-co.turn
+	defer func() { co.turn <- struct{}{} }()
+	if co.finished {
+		return
+	}
+	co.finished = true
+	co.stopping = true
+	live.remove(co)
+
+	co.resume <- false
+	for range co.yield {
+	}
+}
+
+// live holds the generators that have been started but have neither
+// finished nor been closed, in the order they were created.
+var live = &generators{started: make(map[*coroutine]int)}
+
+type generators struct {
+	mu      sync.Mutex
+	started map[*coroutine]int
+	count   int
+}
+
+func (g *generators) add(co *coroutine) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.count++
+	g.started[co] = g.count
+}
+
+func (g *generators) remove(co *coroutine) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.started, co)
+}
+
+// closeGenerators closes every generator the program abandoned without
+// running it to the end, the most recently created first, so their
+// deferred calls run before the program exits.
+func closeGenerators() {
+	live.mu.Lock()
+	abandoned := make([]*coroutine, 0, len(live.started))
+	for co := range live.started {
+		abandoned = append(abandoned, co)
+	}
+	sort.Slice(abandoned, func(i, j int) bool {
+		return live.started[abandoned[i]] > live.started[abandoned[j]]
+	})
+	live.mu.Unlock()
+
+	for _, co := range abandoned {
+		co.close()
+	}
+}
+
+func evalYieldStatement(ys *ast.YieldStatement, env *environment.Environment) environment.Object {
+	frame := env.Frame()
+	if frame == nil || frame.Yield == nil {
+		return newError("line %d:%d: yield outside generator", ys.Token.Line, ys.Token.Column)
+	}
+	val := Eval(ys.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+	if !frame.Yield(val) {
+		// The generator was closed: return from it, running its
+		// deferred calls on the way out.
+		return &environment.ReturnValue{Value: NULL}
+	}
+	return NULL
+}
+
+// evalNext evaluates a call of the builtin next, which resumes a
+// generator on behalf of the generator whose body the call is in, if
+// any.
+func evalNext(node *ast.CallExpression, env *environment.Environment) environment.Object {
+	args := []environment.Object{}
+	for _, a := range node.Arguments {
+		arg := Eval(a, env)
+		if isAbrupt(arg) {
+			return arg
+		}
+		args = append(args, arg)
+	}
+	return next(args, currentGenerator(env))
+}
+
+// builtinNext returns the next value of a generator as Ok(value), or
+// Err once it has no more, so that a generator of optional values can
+// yield null.
+func builtinNext(args ...environment.Object) environment.Object {
+	return next(args, nil)
+}
+
+func next(args []environment.Object, caller interface{}) environment.Object {
+	if err := checkArgCount("next", args, 1); err != nil {
+		return err
+	}
+	var v environment.Object
+	var ok bool
+	switch it := args[0].(type) {
+	case *environment.Generator:
+		v, ok = it.Resume(caller)
+	case environment.Iterator:
+		v, ok = it.Next()
+	default:
+		return newError("argument to `next` not supported, got %s", args[0].Type())
+	}
+	if !ok {
+		return &environment.Result{Ok: false, Value: &environment.String{Value: "generator finished"}}
+	}
+	if isAbrupt(v) {
+		return v
+	}
+	return &environment.Result{Ok: true, Value: v}
+}
+
+// builtinCollect returns the remaining elements of any iterable as a
+// tuple.
+func builtinCollect(args ...environment.Object) environment.Object {
+	if err := checkArgCount("collect", args, 1); err != nil {
+		return err
+	}
+	it, ok := iterate(args[0])
+	if !ok {
+		return newError("argument to `collect` not supported, got %s", args[0].Type())
+	}
+	elements := []environment.Object{}
+	for {
+		v, ok := it.Next()
+		if !ok {
+			return &environment.Tuple{Elements: elements}
+		}
+		if isAbrupt(v) {
+			return v
+		}
+		elements = append(elements, v)
+	}
+}
@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"strings"
+
+	"compiler/ast"
+	"compiler/environment"
+)
+
+// instantiate infers the type arguments of a call to a generic function
+// from the runtime types of args, and checks every inferred type against
+// its parameter's constraint. The result maps each type parameter to the
+// name of the type it stands for in this call. Other type names are
+// looked up in env, the environment fl was declared in.
+func instantiate(fl *ast.FunctionalLiteral, args []environment.Object, env *environment.Environment) (map[string]string, *environment.Error) {
+	name := fl.FunctionName.Value
+	bindings := make(map[string]string)
+	for _, tp := range fl.TypeParameters {
+		bindings[tp.Name.Value] = ""
+	}
+
+	for i, param := range fl.Parameters {
+		if param.Type == nil || i >= len(args) {
+			continue
+		}
+		// A variadic parameter's type is that of each remaining argument.
+		rest := args[i : i+1]
+		if param.Variadic {
+			rest = args[i:]
+		}
+		for _, arg := range rest {
+			if err := unify(name, param.Type, arg, bindings, env); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, tp := range fl.TypeParameters {
+		bound := bindings[tp.Name.Value]
+		if bound == "" {
+			return nil, newError("%s: cannot infer type parameter %s", name, tp.Name.Value)
+		}
+		if !satisfies(bound, tp.Constraint) {
+			return nil, newError("%s: %s does not satisfy %s", name, bound, tp.String())
+		}
+	}
+	return bindings, nil
+}
+
+// unify matches the type written as te against the runtime type of obj,
+// binding type parameters that have not been inferred yet. Null matches
+// any optional type without binding anything. A type that is not a type
+// parameter matches as it would in a type switch, so an alias matches
+// its underlying type and an interface the records that implement it.
+func unify(fn string, te *ast.TypeExpression, obj environment.Object, bindings map[string]string, env *environment.Environment) *environment.Error {
+	if _, ok := obj.(*environment.Null); ok && te.Optional {
+		return nil
+	}
+	if te.Name == "" {
+		tuple, ok := obj.(*environment.Tuple)
+		if !ok || len(tuple.Elements) != len(te.Elements) {
+			return newError("%s: cannot use %s as %s", fn, typeName(obj), substitute(te, bindings))
+		}
+		for i, el := range te.Elements {
+			if err := unify(fn, el, tuple.Elements[i], bindings, env); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The values a generator yields or a channel carries are not known
+	// until they arrive; their types are left to the type checker.
+	if _, ok := obj.(*environment.Generator); ok && te.Name == "Generator" {
+		return nil
+	}
+	if _, ok := obj.(*environment.Channel); ok && te.Name == "chan" {
+		return nil
+	}
+	if len(te.Arguments) > 0 {
+		return unifyResult(fn, te, obj, bindings, env)
+	}
+
+	actual := typeName(obj)
+	bound, isParam := bindings[te.Name]
+	switch {
+	case isParam && bound == "":
+		bindings[te.Name] = actual
+	case isParam && bound != actual:
+		return newError("%s: type parameter %s inferred as both %s and %s", fn, te.Name, bound, actual)
+	case !isParam && !hasType(obj, te, env):
+		return newError("%s: cannot use %s as %s", fn, actual, te.Name)
+	}
+	return nil
+}
+
+// unifyResult matches Result[T] against obj. Only an Ok result carries
+// a value of type T; an Err result matches any Result.
+func unifyResult(fn string, te *ast.TypeExpression, obj environment.Object, bindings map[string]string, env *environment.Environment) *environment.Error {
+	result, ok := obj.(*environment.Result)
+	if te.Name != "Result" || len(te.Arguments) != 1 || !ok {
+		return newError("%s: cannot use %s as %s", fn, typeName(obj), substitute(te, bindings))
+	}
+	if !result.Ok {
+		return nil
+	}
+	return unify(fn, te.Arguments[0], result.Value, bindings, env)
+}
+
+func satisfies(typ string, constraint []*ast.TypeExpression) bool {
+	if len(constraint) == 0 {
+		return true
+	}
+	for _, allowed := range constraint {
+		if allowed.String() == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// substitute spells te with its type parameters replaced by the types
+// they are bound to.
+func substitute(te *ast.TypeExpression, bindings map[string]string) string {
+	if te.Optional {
+		plain := *te
+		plain.Optional = false
+		return substitute(&plain, bindings) + "?"
+	}
+	if te.Name != "" && len(te.Arguments) > 0 {
+		args := make([]string, len(te.Arguments))
+		for i, arg := range te.Arguments {
+			args[i] = substitute(arg, bindings)
+		}
+		return te.Name + "[" + strings.Join(args, ", ") + "]"
+	}
+	if te.Name != "" {
+		if bound := bindings[te.Name]; bound != "" {
+			return bound
+		}
+		return te.Name
+	}
+	parts := make([]string, len(te.Elements))
+	for i, el := range te.Elements {
+		parts[i] = substitute(el, bindings)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// typeName is the Blue spelling of the type of obj.
+func typeName(obj environment.Object) string {
+	switch obj := obj.(type) {
+	case *environment.Integer:
+		return "Integer"
+	case *environment.BigInteger:
+		return "BigInteger"
+	case *environment.SizedInteger:
+		return obj.Kind.Name
+	case *environment.String:
+		return "String"
+	case *environment.Boolean:
+		return "Boolean"
+	case *environment.Function, *environment.Builtin, *environment.BoundMethod:
+		return "Function"
+	case *environment.Result:
+		if obj.Ok {
+			return "Result[" + typeName(obj.Value) + "]"
+		}
+		return "Result"
+	case *environment.NamedValue:
+		return obj.TypeName
+	case *environment.Record:
+		return obj.Def.Name
+	case *environment.Range:
+		return "Range"
+	case *environment.Generator:
+		return "Generator"
+	case *environment.Channel:
+		return obj.Inspect()
+	case *environment.Module:
+		return "Module"
+	case *environment.Tuple:
+		parts := make([]string, len(obj.Elements))
+		for i, el := range obj.Elements {
+			parts[i] = typeName(el)
+		}
+		return "(" + strings.Join(parts, ", ") + ")"
+	case nil, *environment.Null:
+		return "Null"
+	default:
+		return string(obj.Type())
+	}
+}
@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"compiler/ast"
+	"compiler/environment"
+)
+
+// evalForInStatement binds the loop variable to each element of the
+// iterable in turn, in a scope of its own for every iteration.
+func evalForInStatement(fs *ast.ForStatement, env *environment.Environment) environment.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	it, ok := iterate(iterable)
+	if !ok {
+		return newError("line %d:%d: cannot range over %s (type %s)",
+			fs.Token.Line, fs.Token.Column, fs.Iterable.String(), typeName(iterable))
+	}
+	if g, ok := iterable.(*environment.Generator); ok {
+		it = &generatorIterator{g: g, caller: currentGenerator(env)}
+	}
+
+	for {
+		if err := step(env); err != nil {
+			if c, ok := it.(environment.Closer); ok {
+				c.Close()
+			}
+			return err
+		}
+		el, ok := it.Next()
+		if !ok {
+			return NULL
+		}
+		if isAbrupt(el) {
+			return el
+		}
+		scope := environment.NewEnclosedEnvironment(env)
+		scope.Set(fs.Variable.Value, el)
+		if stop := evalLoopBody(fs.Body, scope); stop != nil {
+			// Leaving the loop early abandons the iterator.
+			if c, ok := it.(environment.Closer); ok {
+				c.Close()
+			}
+			return stop
+		}
+	}
+}
+
+// iterate returns an iterator over the elements of obj. Besides the
+// builtin collections, a channel yields the values received from it
+// until it is closed, and a record with a next method is its own
+// iterator: each call of next yields an element, until it returns null.
+func iterate(obj environment.Object) (environment.Iterator, bool) {
+	switch obj := obj.(type) {
+	case *environment.Channel:
+		return channelIterator{obj}, true
+	case environment.Iterable:
+		return obj.Iterator(), true
+	case *environment.Record:
+		if _, ok := obj.Def.Methods["next"]; ok {
+			return &methodIterator{next: &environment.BoundMethod{Receiver: obj, Name: "next"}}, true
+		}
+	}
+	return nil, false
+}
+
+// generatorIterator resumes a generator on behalf of the generator
+// whose body the loop is in, if any.
+type generatorIterator struct {
+	g      *environment.Generator
+	caller interface{}
+}
+
+func (it *generatorIterator) Next() (environment.Object, bool) { return it.g.Resume(it.caller) }
+func (it *generatorIterator) Close()                           { it.g.Close() }
+
+// methodIterator iterates by calling a record's next method. An error
+// or panic raised by next is yielded as an element for the loop to
+// stop with.
+type methodIterator struct {
+	next *environment.BoundMethod
+}
+
+func (it *methodIterator) Next() (environment.Object, bool) {
+	el := applyFunction(it.next)
+	if el == NULL {
+		return nil, false
+	}
+	return el, true
+}
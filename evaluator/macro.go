@@ -0,0 +1,361 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"compiler/ast"
+	"compiler/environment"
+	"compiler/resolver"
+	"compiler/token"
+)
+
+// maxExpansionDepth bounds how deeply the code a macro returns may
+// itself call macros, so that a macro that keeps expanding into itself
+// is reported rather than expanded forever.
+const maxExpansionDepth = 100
+
+// CompileError is an error found while compiling a program: while
+// expanding its macros or evaluating code at compile time.
+type CompileError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("line %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ExpandMacros returns a copy of program without its macro declarations,
+// in which each call of a macro is replaced by the code the macro's
+// body returns for it. It runs before the program is resolved, checked
+// and evaluated, so those passes only see the expanded program.
+//
+// Macros are declared at the top level, and their names take precedence
+// over any other binding. A macro's body runs with its parameters bound
+// to the call's arguments as quoted code, after the macro calls inside
+// the arguments have been expanded, and must return quoted code. That
+// code is expanded in turn. A call used as a statement may expand into
+// statements, which take its place.
+func ExpandMacros(program *ast.Program) (*ast.Program, []*CompileError) {
+	x := &expander{env: environment.NewEnvironment()}
+	stmts := []ast.Statement{}
+	for _, s := range program.Statements {
+		if ms, ok := s.(*ast.MacroStatement); ok {
+			x.define(ms)
+			continue
+		}
+		stmts = append(stmts, s)
+	}
+	expanded := x.expand(&ast.Program{Statements: stmts}, 0).(*ast.Program)
+	return expanded, x.errors
+}
+
+type expander struct {
+	env    *environment.Environment // holds the macros, and is where their bodies run
+	errors []*CompileError
+}
+
+func (x *expander) errorf(tok token.Token, format string, args ...interface{}) {
+	x.errors = append(x.errors, &CompileError{Line: tok.Line, Column: tok.Column, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (x *expander) define(ms *ast.MacroStatement) {
+	if prev, ok := x.macro(ms.Name.Value); ok {
+		pos := prev.Statement.Name.Token
+		x.errorf(ms.Name.Token, "macro %s redeclared (previous declaration at line %d:%d)",
+			ms.Name.Value, pos.Line, pos.Column)
+		return
+	}
+	x.env.Set(ms.Name.Value, &environment.Macro{Statement: ms, Env: x.env})
+}
+
+func (x *expander) macro(name string) (*environment.Macro, bool) {
+	obj, ok := x.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	m, ok := obj.(*environment.Macro)
+	return m, ok
+}
+
+// expand returns a copy of node with the macro calls in it expanded.
+// depth is the number of expansions node itself is the result of.
+func (x *expander) expand(node ast.Node, depth int) ast.Node {
+	// A call that expands into statements stands in for an expression
+	// until its parent turns out to be an expression statement.
+	type statementCall struct {
+		name string
+		tok  token.Token
+	}
+	pending := make(map[*ast.BlockStatement]statementCall)
+	var order []*ast.BlockStatement
+
+	expanded := ast.Modify(node, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.MacroStatement:
+			x.errorf(n.Token, "macro %s must be declared at the top level", n.Name.Value)
+			return &ast.BlockStatement{Token: n.Token}
+
+		case *ast.CallExpression:
+			code := x.call(n, depth)
+			if b, ok := code.(*ast.BlockStatement); ok {
+				pending[b] = statementCall{n.Function.String(), n.Token}
+				order = append(order, b)
+			}
+			return code
+
+		case *ast.ExpressionStatement:
+			if b, ok := n.Expression.(*ast.BlockStatement); ok {
+				delete(pending, b)
+				return b
+			}
+		}
+		return n
+	})
+
+	for _, b := range order {
+		if call, ok := pending[b]; ok && b != expanded {
+			x.errorf(call.tok, "macro %s expands to statements, which cannot be used as a value", call.name)
+		}
+	}
+	return expanded
+}
+
+// call returns the expansion of call if it calls a macro, and call
+// itself otherwise or if the expansion fails.
+func (x *expander) call(call *ast.CallExpression, depth int) ast.Node {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return call
+	}
+	m, ok := x.macro(ident.Value)
+	if !ok {
+		return call
+	}
+	name := ident.Value
+	params := m.Statement.Parameters
+	switch {
+	case depth >= maxExpansionDepth:
+		x.errorf(call.Token, "macro %s expands too deeply (more than %d nested expansions)", name, maxExpansionDepth)
+		return call
+	case len(call.Arguments) != len(params):
+		x.errorf(call.Token, "macro %s", arityError(name, len(params), len(call.Arguments), false).Message)
+		return call
+	}
+
+	frame := &environment.Frame{}
+	env := environment.NewCallEnvironment(m.Env, frame)
+	for i, p := range params {
+		env.Set(p.Value, &environment.Quote{Node: call.Arguments[i]})
+	}
+	result := runDeferred(frame, strayBranch(evalFunctionBody(m.Statement.Body, env)))
+	if rv, ok := result.(*environment.ReturnValue); ok {
+		result = rv.Value
+	}
+
+	switch result := result.(type) {
+	case *environment.Quote:
+		return x.expand(result.Node, depth+1)
+	case *environment.Error:
+		x.errorf(call.Token, "in macro %s: %s", name, result.Message)
+	case *environment.Panic:
+		x.errorf(call.Token, "in macro %s: %s", name, result.Inspect())
+	default:
+		x.errorf(call.Token, "macro %s must return quoted code, got %s", name, result.Type())
+	}
+	return call
+}
+
+// evalQuote returns the code qe quotes, in which each unquote(e) is
+// replaced by the value of e as code. The names the quoted code itself
+// declares are renamed to fresh names that no other code can spell,
+// so that they neither capture nor are captured by the variables of
+// the code the quote is spliced into.
+func evalQuote(qe *ast.QuoteExpression, env *environment.Environment) environment.Object {
+	// The unquoted expressions are set aside first, so that renaming
+	// leaves them alone: they refer to the bindings where the quote is
+	// evaluated.
+	var unquoted []ast.Expression
+	var failure environment.Object
+	template := ast.Modify(qe.Node, func(n ast.Node) ast.Node {
+		call, ok := n.(*ast.CallExpression)
+		if !ok || !isUnquote(call) {
+			return n
+		}
+		if len(call.Arguments) != 1 && failure == nil {
+			failure = newError("line %d:%d: unquote expects 1 argument, got %d",
+				call.Token.Line, call.Token.Column, len(call.Arguments))
+		}
+		unquoted = append(unquoted, call.Arguments...)
+		placeholder := &ast.IntegerLiteral{Token: call.Token, Value: int64(len(unquoted) - 1)}
+		return &ast.CallExpression{Token: call.Token, Function: call.Function, Arguments: []ast.Expression{placeholder}}
+	})
+	if failure != nil {
+		return failure
+	}
+
+	// The template is a copy of the quoted code, so it can be renamed in
+	// place.
+	freshNames(template)
+	spliced := make(map[*ast.BlockStatement]token.Token)
+	code := ast.Modify(template, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.CallExpression:
+			if !isUnquote(n) || failure != nil {
+				return n
+			}
+			i := n.Arguments[0].(*ast.IntegerLiteral).Value
+			node, err := unquote(Eval(unquoted[i], env), n.Token)
+			if err != nil {
+				failure = err
+				return n
+			}
+			if b, ok := node.(*ast.BlockStatement); ok {
+				spliced[b] = n.Token
+			}
+			return node
+		case *ast.ExpressionStatement:
+			if b, ok := n.Expression.(*ast.BlockStatement); ok {
+				delete(spliced, b)
+				return b
+			}
+		}
+		return n
+	})
+	if failure != nil {
+		return failure
+	}
+	for b, tok := range spliced {
+		if b != code {
+			return newError("line %d:%d: cannot unquote statements where a value is expected", tok.Line, tok.Column)
+		}
+	}
+	return &environment.Quote{Node: code}
+}
+
+func isUnquote(call *ast.CallExpression) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "unquote"
+}
+
+// unquote returns the code for the value obj of an unquoted expression
+// at tok: the code itself for a quote, and a literal for a value that
+// can be written as one.
+func unquote(obj environment.Object, tok token.Token) (ast.Node, environment.Object) {
+	if q, ok := obj.(*environment.Quote); ok {
+		return q.Node, nil
+	}
+	if lit, ok := literal(obj, tok); ok {
+		return lit, nil
+	}
+	if isAbrupt(obj) {
+		return nil, obj
+	}
+	return nil, newError("line %d:%d: cannot unquote a value of type %s", tok.Line, tok.Column, obj.Type())
+}
+
+// literal returns a literal at tok for obj, if obj is a value that can
+// be written as one. A sized integer or a value of a named type is
+// written as the conversion of a literal to its type, such as Int8(3).
+func literal(obj environment.Object, tok token.Token) (ast.Expression, bool) {
+	switch obj := obj.(type) {
+	case *environment.Integer:
+		return &ast.IntegerLiteral{Token: literalToken(tok, strconv.FormatInt(obj.Value, 10)), Value: obj.Value}, true
+	case *environment.SizedInteger:
+		// A UInt64 beyond the range of Integer is converted from a
+		// BigInteger.
+		var value environment.Object = &environment.BigInteger{Value: obj.Kind.Big(obj.Value)}
+		if v := obj.Kind.Big(obj.Value); v.IsInt64() {
+			value = &environment.Integer{Value: v.Int64()}
+		}
+		return conversionLiteral(obj.Kind.Name, value, tok)
+	case *environment.NamedValue:
+		return conversionLiteral(obj.TypeName, obj.Value, tok)
+	case *environment.BigInteger:
+		return &ast.BigIntegerLiteral{Token: literalToken(tok, obj.Value.String()+"n"), Value: obj.Value}, true
+	case *environment.Boolean:
+		return &ast.Boolean{Token: literalToken(tok, strconv.FormatBool(obj.Value)), Value: obj.Value}, true
+	case *environment.String:
+		return &ast.StringLiteral{Token: literalToken(tok, obj.Value), Value: obj.Value}, true
+	case *environment.Null:
+		return &ast.NullLiteral{Token: literalToken(tok, "null")}, true
+	}
+	return nil, false
+}
+
+// conversionLiteral returns the call at tok that converts the literal for value
+// to the type called name.
+func conversionLiteral(name string, value environment.Object, tok token.Token) (ast.Expression, bool) {
+	arg, ok := literal(value, tok)
+	if !ok {
+		return nil, false
+	}
+	function := &ast.Identifier{Token: token.Token{Type: token.TokenIdentifier, Lexeme: name, Line: tok.Line, Column: tok.Column}, Value: name}
+	return &ast.CallExpression{Token: literalToken(tok, "("), Function: function, Arguments: []ast.Expression{arg}}, true
+}
+
+func literalToken(at token.Token, lexeme string) token.Token {
+	return token.Token{Type: at.Type, Lexeme: lexeme, Line: at.Line, Column: at.Column}
+}
+
+// gensyms counts the fresh names made for quoted code.
+var gensyms atomic.Int64
+
+// freshNames renames the variables, constants and parameters that code
+// declares, and the identifiers that refer to them, to fresh names. A
+// name the code uses but does not itself bind in that scope is left
+// alone, even where the code declares the same name elsewhere. The
+// fresh names contain a '#', so no identifier in the source can refer
+// to them. code must not share its identifiers with other code.
+func freshNames(code ast.Node) {
+	program := &ast.Program{}
+	switch n := code.(type) {
+	case *ast.BlockStatement:
+		program.Statements = n.Statements
+	case ast.Expression:
+		program.Statements = []ast.Statement{&ast.ExpressionStatement{Expression: n}}
+	}
+	// The code is resolved on its own, so the names it uses from where
+	// it is spliced in are reported as undefined, which is expected.
+	table, _ := resolver.Resolve(program)
+
+	decls := make([]*ast.Identifier, 0, len(table.Defs))
+	for id, sym := range table.Defs {
+		if renamable(sym) {
+			decls = append(decls, id)
+		}
+	}
+	sort.Slice(decls, func(i, j int) bool {
+		a, b := decls[i].Token, decls[j].Token
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	fresh := make(map[*resolver.Symbol]string)
+	for _, id := range decls {
+		fresh[table.Defs[id]] = fmt.Sprintf("%s#%d", id.Value, gensyms.Add(1))
+	}
+	for _, id := range decls {
+		id.Value = fresh[table.Defs[id]]
+	}
+	for id, sym := range table.Uses {
+		if name, ok := fresh[sym]; ok {
+			id.Value = name
+		}
+	}
+}
+
+// renamable reports whether freshNames renames sym. Functions and types
+// keep their names, which code outside of the quote may call, and so
+// does self, which a method call binds by name.
+func renamable(sym *resolver.Symbol) bool {
+	switch sym.Kind {
+	case resolver.Var, resolver.Const:
+		return true
+	case resolver.Param:
+		return sym.Name != "self"
+	}
+	return false
+}
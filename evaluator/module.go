@@ -0,0 +1,351 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"compiler/ast"
+	"compiler/environment"
+	"compiler/flow"
+	"compiler/lexer"
+	"compiler/parser"
+	"compiler/resolver"
+	"compiler/types"
+)
+
+// SourceExt is the extension of Blue source files.
+const SourceExt = ".blue"
+
+// Loader resolves import paths to files, evaluates each file once in its
+// own environment and caches the resulting module.
+type Loader struct {
+	// SearchPath lists the directories searched, in order, for imports
+	// that are not relative paths such as "math".
+	SearchPath []string
+
+	mu      sync.Mutex
+	modules map[string]*loadedModule         // keyed by absolute path
+	members map[string]map[string]types.Type // the exports of checked modules, keyed the same way
+}
+
+// loadedModule is a module that is loaded, or being loaded. Tasks that
+// import it while it is loading wait until done is closed.
+type loadedModule struct {
+	done chan struct{}
+	mod  *environment.Module
+	err  error
+}
+
+func NewLoader(searchPath ...string) *Loader {
+	return &Loader{
+		SearchPath: searchPath,
+		modules:    make(map[string]*loadedModule),
+		members:    make(map[string]map[string]types.Type),
+	}
+}
+
+// Modules is the loader used for import statements.
+var Modules = NewLoader()
+
+// RunFile runs program, parsed from the file at path, as the entry
+// module: relative imports are resolved against its directory and an
+// import of the entry file itself is reported as a cycle.
+func (l *Loader) RunFile(path string, program *ast.Program, env *environment.Environment) environment.Object {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return newError("%s", err)
+	}
+	env.SetImports([]string{abs})
+	return Run(program, env)
+}
+
+func evalImportStatement(is *ast.ImportStatement, env *environment.Environment) environment.Object {
+	if err := notAtCompileTime(env, is.Token, "import"); err != nil {
+		return err
+	}
+	mod, err := Modules.importFrom(is.Path, env.Imports())
+	if err != nil {
+		return newError("line %d:%d: %s", is.Token.Line, is.Token.Column, err)
+	}
+	return env.Set(is.Name.Value, mod)
+}
+
+// Import returns the module for path, evaluating it the first time it
+// is imported. Relative paths are resolved against the working
+// directory.
+func (l *Loader) Import(path string) (*environment.Module, error) {
+	return l.importFrom(path, nil)
+}
+
+// importFrom imports path for code in the last file of chain, the files
+// whose imports led to it. Relative paths are resolved against that
+// file's directory. A module is loaded once: tasks that import it while
+// another task loads it wait for that load to finish, and an import of
+// a file in chain is a cycle.
+func (l *Loader) importFrom(path string, chain []string) (*environment.Module, error) {
+	file, err := l.resolve(path, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	entry, ok := l.modules[file]
+	if ok {
+		l.mu.Unlock()
+		select {
+		case <-entry.done:
+			return entry.mod, entry.err
+		default:
+		}
+		for i, loading := range chain {
+			if loading == file {
+				cycle := append(append([]string{}, chain[i:]...), file)
+				return nil, fmt.Errorf("import cycle: %s", formatCycle(cycle))
+			}
+		}
+		if _, _, _, deadlocked := tasks.wait([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(entry.done)}}); deadlocked {
+			return nil, errors.New(deadlockError().Message)
+		}
+		return entry.mod, entry.err
+	}
+	entry = &loadedModule{done: make(chan struct{})}
+	l.modules[file] = entry
+	l.mu.Unlock()
+
+	entry.mod, entry.err = l.load(path, file, append(chain[:len(chain):len(chain)], file))
+	close(entry.done)
+	return entry.mod, entry.err
+}
+
+func (l *Loader) load(path, file string, chain []string) (*environment.Module, error) {
+	program, err := parse(path, file)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.check(file, program, chain); err != nil {
+		return nil, err
+	}
+	program, comptimeErrs := Comptime(program)
+	if len(comptimeErrs) > 0 {
+		return nil, fmt.Errorf("%s: %s", file, joinErrors(comptimeErrs))
+	}
+	if err := l.check(file, program, chain); err != nil {
+		return nil, err
+	}
+
+	env := environment.NewEnvironment()
+	env.SetImports(chain)
+	switch result := Eval(program, env).(type) {
+	case *environment.Error:
+		return nil, fmt.Errorf("%s: %s", file, result.Message)
+	case *environment.Panic:
+		return nil, fmt.Errorf("%s: %s", file, result.Inspect())
+	}
+
+	mod := &environment.Module{
+		Name:    parser.ModuleName(file),
+		Path:    file,
+		Exports: make(map[string]environment.Object),
+	}
+	for _, name := range exportedNames(program) {
+		if val, ok := env.Get(name); ok {
+			mod.Exports[name] = val
+		}
+	}
+	return mod, nil
+}
+
+// parse reads the module at path, found in file, and returns it with its
+// macros expanded and its names resolved.
+func parse(path, file string) (*ast.Program, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %q: %v", path, err)
+	}
+
+	p := parser.New(lexer.New(string(data)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %s", file, strings.Join(errs, "; "))
+	}
+	program, macroErrs := ExpandMacros(program)
+	if len(macroErrs) > 0 {
+		return nil, fmt.Errorf("%s: %s", file, joinErrors(macroErrs))
+	}
+	if _, errs := resolver.Resolve(program); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %s", file, joinErrors(errs))
+	}
+	return program, nil
+}
+
+// Importer returns the importer with which the type checker checks the
+// uses that code in file makes of the modules it imports.
+func (l *Loader) Importer(file string) types.Importer {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	return l.importer([]string{file})
+}
+
+func (l *Loader) importer(chain []string) types.Importer {
+	return func(path string) map[string]types.Type { return l.exports(path, chain) }
+}
+
+// exports returns the types of the names that the module at path
+// exports, for code in the last file of chain that imports it. They are
+// not known, and exports returns nil, if the module has errors or is in
+// chain; importing it reports why.
+func (l *Loader) exports(path string, chain []string) map[string]types.Type {
+	file, err := l.resolve(path, chain)
+	if err != nil {
+		return nil
+	}
+	for _, loading := range chain {
+		if loading == file {
+			return nil
+		}
+	}
+	l.mu.Lock()
+	members, ok := l.members[file]
+	l.mu.Unlock()
+	if ok {
+		return members
+	}
+
+	if program, err := parse(path, file); err == nil {
+		info := types.NewInfo()
+		importer := l.importer(append(chain[:len(chain):len(chain)], file))
+		if errs := types.CheckImports(program, info, importer); len(errs) == 0 {
+			members = make(map[string]types.Type)
+			for _, name := range exportedNames(program) {
+				switch v := info.Scope.Lookup(name); {
+				case v == nil:
+				case v.IsType:
+					// Types cannot be named through their module, so
+					// they are only known to exist.
+					members[name] = types.Unknown
+				default:
+					members[name] = v.Type
+				}
+			}
+		}
+	}
+	l.mu.Lock()
+	l.members[file] = members
+	l.mu.Unlock()
+	return members
+}
+
+// resolve maps an import path, imported by code in the last file of
+// chain, to an absolute file name.
+func (l *Loader) resolve(path string, chain []string) (string, error) {
+	name := path
+	if filepath.Ext(name) != SourceExt {
+		name += SourceExt
+	}
+
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name), nil
+	}
+	if strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") {
+		return filepath.Join(currentDir(chain), name), nil
+	}
+
+	for _, dir := range l.SearchPath {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return filepath.Abs(candidate)
+		}
+	}
+	return "", fmt.Errorf("cannot find module %q in search path %v", path, l.SearchPath)
+}
+
+// currentDir is the directory of the last file of chain, or the
+// working directory when chain is empty.
+func currentDir(chain []string) string {
+	if len(chain) == 0 {
+		wd, _ := os.Getwd()
+		return wd
+	}
+	return filepath.Dir(chain[len(chain)-1])
+}
+
+// exportedNames lists the top-level names of program that other modules
+// may use: those declared with `pub` and those starting with a capital
+// letter.
+func exportedNames(program *ast.Program) []string {
+	var names []string
+	for _, stmt := range program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.FunctionStatement:
+			if name := stmt.Literal.FunctionName.Value; stmt.Public || isCapitalized(name) {
+				names = append(names, name)
+			}
+		case *ast.LetStatement:
+			if name := stmt.Assignment.Name.Value; stmt.Public || isCapitalized(name) {
+				names = append(names, name)
+			}
+		case *ast.ConstStatement:
+			if name := stmt.Name.Value; stmt.Public || isCapitalized(name) {
+				names = append(names, name)
+			}
+		case *ast.TypeStatement:
+			if name := stmt.Name.Value; stmt.Public || isCapitalized(name) {
+				names = append(names, name)
+			}
+		case *ast.RecordStatement:
+			if name := stmt.Name.Value; stmt.Public || isCapitalized(name) {
+				names = append(names, name)
+			}
+		case *ast.InterfaceStatement:
+			if name := stmt.Name.Value; stmt.Public || isCapitalized(name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func isCapitalized(name string) bool {
+	for _, r := range name {
+		return unicode.IsUpper(r)
+	}
+	return false
+}
+
+// check returns the type or control-flow errors in program, the
+// contents of file, if there are any. Its imports are checked as
+// imported by the last file of chain. The code in
+// comptime blocks is checked before it runs, and the program again once
+// the blocks are replaced by their values.
+func (l *Loader) check(file string, program *ast.Program, chain []string) error {
+	if errs := types.CheckImports(program, nil, l.importer(chain)); len(errs) > 0 {
+		return fmt.Errorf("%s: %s", file, joinErrors(errs))
+	}
+	if errs := flow.Check(program); len(errs) > 0 {
+		return fmt.Errorf("%s: %s", file, joinErrors(errs))
+	}
+	return nil
+}
+
+func joinErrors[E error](errs []E) string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func formatCycle(files []string) string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.Base(f)
+	}
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,189 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"compiler/environment"
+	"compiler/lexer"
+	"compiler/parser"
+	"compiler/types"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func runFile(t *testing.T, loader *Loader, path string) environment.Object {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New(lexer.New(string(data)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+
+	saved := Modules
+	Modules = loader
+	defer func() { Modules = saved }()
+	return loader.RunFile(path, program, environment.NewEnvironment())
+}
+
+func TestImportFromSearchPath(t *testing.T) {
+	lib := writeFiles(t, map[string]string{
+		"math.blue": `
+pub func Integer square(n) { return n * n; }
+func Integer Cube(n) { return n * square(n); }
+`,
+	})
+	app := writeFiles(t, map[string]string{
+		"main.blue": `
+import "math";
+func Integer main() { return math.square(3) + math.Cube(2); }
+`,
+	})
+	result := runFile(t, NewLoader(lib), filepath.Join(app, "main.blue"))
+	testIntegerObject(t, result, 17)
+}
+
+func TestImportRelativePath(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.blue":      `import "./lib/util.blue"; func Integer main() { return util.Answer; }`,
+		"lib/util.blue":  `import "./inner"; let Answer = inner.value();`,
+		"lib/inner.blue": `pub func Integer value() { return 42; }`,
+	})
+	result := runFile(t, NewLoader(), filepath.Join(dir, "main.blue"))
+	testIntegerObject(t, result, 42)
+}
+
+func TestUnexportedNamesAreHidden(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.blue": `import "./util"; func Integer main() { return util.helper(); }`,
+		"util.blue": `func Integer helper() { return 1; }`,
+	})
+	result := runFile(t, NewLoader(), filepath.Join(dir, "main.blue"))
+	testErrorObject(t, result, "module util has no exported member helper")
+}
+
+func TestModulesAreCached(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"util.blue": `pub let x = 1;`,
+	})
+	loader := NewLoader(dir)
+	first, err := loader.Import("util")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := loader.Import("util")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("module was evaluated twice")
+	}
+}
+
+func TestImportCycleIsReported(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.blue": `import "./a"; func Integer main() { return 0; }`,
+		"a.blue":    `import "./b";`,
+		"b.blue":    `import "./a";`,
+	})
+	result := runFile(t, NewLoader(), filepath.Join(dir, "main.blue"))
+	errObj, ok := result.(*environment.Error)
+	if !ok {
+		t.Fatalf("expected an error, got %T (%+v)", result, result)
+	}
+	if !strings.Contains(errObj.Message, "import cycle: a.blue -> b.blue -> a.blue") {
+		t.Errorf("unexpected error message: %q", errObj.Message)
+	}
+}
+
+func TestModuleIsCheckedBeforeComptime(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"util.blue": `func Integer f(Integer x) { return x; } pub const K = comptime { return f("s"); };`,
+	})
+	_, err := NewLoader(dir).Import("util")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), `line 1:75: cannot use "s" (type String) as Integer in argument to f`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestImportedMembersAreChecked(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"util.blue":  `import "./inner"; pub func Integer twice(Integer n) { return n * inner.two(); } func helper() { }`,
+		"inner.blue": `pub func Integer two() { return 2; }`,
+		"bad.blue":   `import "./inner"; pub let x = inner.two("extra");`,
+	})
+	p := parser.New(lexer.New(`import "./util"; let String s = util.twice("x"); util.helper();`))
+	program := p.ParseProgram()
+	errs := types.CheckImports(program, nil, NewLoader().Importer(filepath.Join(dir, "main.blue")))
+	want := []string{
+		`line 1:44: cannot use "x" (type String) as Integer in argument to util.twice`,
+		"line 1:29: cannot use util.twice(\"x\") (type Integer) as String in let s",
+		"line 1:55: module util has no exported member helper",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %v; want %q", errs, want)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("errors[%d] = %q; want %q", i, err, want[i])
+		}
+	}
+
+	// Modules check the modules they import in turn.
+	_, err := NewLoader(dir).Import("bad")
+	if err == nil || !strings.Contains(err.Error(), "line 1:40: inner.two expects 0 arguments, got 1") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConcurrentImportsLoadOnce(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.blue": `
+func worker(ch) {
+	import "./slow.blue";
+	send(ch, slow.Loaded);
+}
+
+func Integer main() {
+	let ch = chan[Integer](3);
+	for (i in 0..3) {
+		spawn worker(ch);
+	}
+	wait();
+	return unwrap(recv(ch)) + unwrap(recv(ch)) + unwrap(recv(ch));
+}
+`,
+		"slow.blue": `
+func Integer count() { let n = 0; for (i in 0..20000) { n = n + 1; } return n; }
+pub let Loaded = count() / 20000;
+`,
+	})
+	loader := NewLoader()
+	result := runFile(t, loader, filepath.Join(dir, "main.blue"))
+	testIntegerObject(t, result, 3)
+	if n := len(loader.modules); n != 1 {
+		t.Errorf("%d modules loaded; want 1", n)
+	}
+}
@@ -0,0 +1,122 @@
+package evaluator
+
+import (
+	"compiler/ast"
+	"compiler/environment"
+)
+
+func declareType(ts *ast.TypeStatement, env *environment.Environment) environment.Object {
+	t := &environment.TypeName{Name: ts.Name.Value, Underlying: ts.Type, Alias: ts.Alias, Env: env}
+	return env.Set(ts.Name.Value, t)
+}
+
+// convert converts the single argument to the type t, as t(x) does.
+func convert(t *environment.TypeName, args []environment.Object) environment.Object {
+	if err := checkArgCount(t.Name, args, 1); err != nil {
+		return err
+	}
+	val := convertTo(t.Underlying, t.Env, args[0])
+	if isError(val) || t.Alias {
+		return val
+	}
+	return &environment.NamedValue{TypeName: t.Name, Value: val}
+}
+
+// convertTo converts obj to the type te, written in the scope env. A
+// value of a named type converts as its underlying value, and integers
+// convert between integer types.
+func convertTo(te *ast.TypeExpression, env *environment.Environment, obj environment.Object) environment.Object {
+	obj = underlyingValue(obj)
+	if te.Optional {
+		if obj == NULL {
+			return obj
+		}
+		plain := *te
+		plain.Optional = false
+		te = &plain
+	}
+
+	if te.Name != "" && len(te.Arguments) == 0 {
+		if isConversion(te.Name) {
+			return applyFunction(builtins[te.Name], obj)
+		}
+		if def, ok := env.Get(te.Name); ok {
+			if t, ok := def.(*environment.TypeName); ok {
+				val := convert(t, []environment.Object{obj})
+				if named, ok := val.(*environment.NamedValue); ok {
+					val = named.Value
+				}
+				return val
+			}
+		}
+	}
+	if actual := typeName(obj); actual != te.String() {
+		return newError("cannot convert %s to %s", actual, te)
+	}
+	return obj
+}
+
+// underlyingValue returns the value of obj without its type name, if it
+// is of a named type, so that t(x) converts it as a value of its
+// underlying type.
+func underlyingValue(obj environment.Object) environment.Object {
+	if named, ok := obj.(*environment.NamedValue); ok {
+		return named.Value
+	}
+	return obj
+}
+
+// isConversion reports whether the builtin name converts integers to
+// the integer type of that name.
+func isConversion(name string) bool {
+	_, sized := environment.IntKinds[name]
+	return sized || name == "Integer" || name == "BigInteger"
+}
+
+// evalNamedInfixExpression applies node to operands of a named type. It
+// computes with their underlying values; results other than comparisons
+// have the named type again. An integer literal takes the type of the
+// other operand, and a shift count may be of any integer type. The
+// result is false if the operands cannot be combined this way.
+func evalNamedInfixExpression(node *ast.InfixExpression, left, right environment.Object, env *environment.Environment) (environment.Object, bool) {
+	ln, lok := left.(*environment.NamedValue)
+	rn, rok := right.(*environment.NamedValue)
+	if !lok && !rok {
+		return nil, false
+	}
+
+	name := ""
+	switch {
+	case node.Operator == "<<" || node.Operator == ">>":
+		if rok {
+			right = rn.Value
+		}
+		if lok {
+			left, name = ln.Value, ln.TypeName
+		}
+	case lok && rok && ln.TypeName == rn.TypeName:
+		left, right, name = ln.Value, rn.Value, ln.TypeName
+	case lok && isIntegerLiteral(node.Right):
+		left, name = ln.Value, ln.TypeName
+	case rok && isIntegerLiteral(node.Left):
+		right, name = rn.Value, rn.TypeName
+	default:
+		return nil, false
+	}
+	return withTypeName(name, evalInfixExpression(node, left, right, env)), true
+}
+
+// withTypeName gives a value computed from values of the named type
+// name that type. Booleans and errors are left alone, as is everything
+// when name is empty.
+func withTypeName(name string, obj environment.Object) environment.Object {
+	if _, ok := obj.(*environment.Boolean); ok || name == "" || isAbrupt(obj) {
+		return obj
+	}
+	return &environment.NamedValue{TypeName: name, Value: obj}
+}
+
+func isIntegerLiteral(e ast.Expression) bool {
+	_, ok := e.(*ast.IntegerLiteral)
+	return ok
+}
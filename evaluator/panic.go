@@ -0,0 +1,66 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"compiler/ast"
+	"compiler/environment"
+	"compiler/token"
+)
+
+// goPanic turns a Go runtime panic raised while evaluating Blue code into
+// a Blue panic, so it unwinds and is reported like one.
+func goPanic(r interface{}) *environment.Panic {
+	return &environment.Panic{Value: &environment.String{Value: fmt.Sprint(r)}}
+}
+
+// runtimePanic returns the panic raised for a failure at tok that the
+// program could not prevent up front, such as a division by zero, so
+// that recover can catch it like a panic the program raised itself.
+func runtimePanic(tok token.Token, format string, args ...interface{}) *environment.Panic {
+	msg := fmt.Sprintf("line %d:%d: ", tok.Line, tok.Column) + fmt.Sprintf(format, args...)
+	return &environment.Panic{Value: &environment.String{Value: msg}}
+}
+
+// isBuiltinCall reports whether node calls the builtin called name. The
+// recover builtin is evaluated specially because it must see a panic in
+// its argument instead of having the panic unwind past it, and wait
+// because it needs to know which task calls it.
+func isBuiltinCall(node *ast.CallExpression, env *environment.Environment, name string) bool {
+	ident, ok := node.Function.(*ast.Identifier)
+	if !ok || ident.Value != name {
+		return false
+	}
+	_, shadowed := env.Get(ident.Value)
+	return !shadowed
+}
+
+// evalRecover evaluates recover(expr): the result is Ok with the value of
+// expr, or Err with the panic value if evaluating expr panicked. Called
+// without an argument from a deferred call, recover stops the panic
+// unwinding the function that deferred it and returns the panic value;
+// otherwise it returns null.
+func evalRecover(node *ast.CallExpression, env *environment.Environment) environment.Object {
+	switch len(node.Arguments) {
+	case 0:
+		frame := env.Frame()
+		if frame == nil || frame.DeferredBy == nil || frame.DeferredBy.Panic == nil {
+			return NULL
+		}
+		p := frame.DeferredBy.Panic
+		frame.DeferredBy.Panic = nil
+		return p.Value
+	case 1:
+	default:
+		return newError("wrong number of arguments to `recover`: got=%d, want=0 or 1", len(node.Arguments))
+	}
+
+	val := Eval(node.Arguments[0], env)
+	if p, ok := val.(*environment.Panic); ok {
+		return &environment.Result{Ok: false, Value: p.Value}
+	}
+	if isAbrupt(val) {
+		return val
+	}
+	return &environment.Result{Ok: true, Value: val}
+}
@@ -0,0 +1,196 @@
+package evaluator
+
+import (
+	"strings"
+
+	"compiler/ast"
+	"compiler/environment"
+)
+
+func declareRecord(rs *ast.RecordStatement, env *environment.Environment) environment.Object {
+	rt := &environment.RecordType{
+		Name:    rs.Name.Value,
+		Methods: make(map[string]*ast.FunctionalLiteral),
+		Env:     env,
+	}
+	for _, f := range rs.Fields {
+		rt.Fields = append(rt.Fields, f.Name.Value)
+	}
+	for _, m := range rs.Methods {
+		rt.Methods[m.FunctionName.Value] = m
+	}
+	return env.Set(rt.Name, rt)
+}
+
+func declareInterface(is *ast.InterfaceStatement, env *environment.Environment) environment.Object {
+	it := &environment.InterfaceType{
+		Name:    is.Name.Value,
+		Methods: make(map[string]*ast.FunctionalLiteral),
+		Env:     env,
+	}
+	for _, m := range is.Methods {
+		it.Methods[m.FunctionName.Value] = m
+	}
+	return env.Set(it.Name, it)
+}
+
+// construct builds a record of type rt from the values of its fields.
+func construct(rt *environment.RecordType, args []environment.Object) environment.Object {
+	if len(args) != len(rt.Fields) {
+		return arityError(rt.Name, len(rt.Fields), len(args), false)
+	}
+	return &environment.Record{Def: rt, Fields: append([]environment.Object{}, args...)}
+}
+
+// dispatch returns the method a bound method calls, with self bound to
+// its receiver. The method is looked up in the record type of the
+// receiver when the call is made, so a call through an interface runs
+// the method of whichever record the interface value holds.
+func dispatch(bm *environment.BoundMethod) environment.Object {
+	def := bm.Receiver.Def
+	fl, ok := def.Methods[bm.Name]
+	if !ok {
+		return newError("%s has no method %s", def.Name, bm.Name)
+	}
+	env := environment.NewEnclosedEnvironment(def.Env)
+	env.Set("self", bm.Receiver)
+	return &environment.Function{Literal: fl, Env: env}
+}
+
+func evalRecordMember(r *environment.Record, member *ast.Identifier) environment.Object {
+	if val, ok := r.Field(member.Value); ok {
+		return val
+	}
+	if _, ok := r.Def.Methods[member.Value]; ok {
+		return &environment.BoundMethod{Receiver: r, Name: member.Value}
+	}
+	return newError("line %d:%d: %s has no field or method %s",
+		member.Token.Line, member.Token.Column, r.Def.Name, member.Value)
+}
+
+func evalSwitchStatement(ss *ast.SwitchStatement, env *environment.Environment) environment.Object {
+	subject := Eval(ss.Subject, env)
+	if isAbrupt(subject) {
+		return subject
+	}
+
+	for _, tc := range ss.Cases {
+		if !hasType(subject, tc.Type, env) {
+			continue
+		}
+		caseEnv := environment.NewEnclosedEnvironment(env)
+		if tc.Name != nil {
+			caseEnv.Set(tc.Name.Value, subject)
+		}
+		return evalStatements(tc.Body.Statements, caseEnv)
+	}
+	if ss.Default != nil {
+		return Eval(ss.Default, env)
+	}
+	return NULL
+}
+
+// hasType reports whether obj is a value of the type te, written in the
+// scope env. A record has the type of each interface whose methods it
+// has, with the same signatures.
+func hasType(obj environment.Object, te *ast.TypeExpression, env *environment.Environment) bool {
+	if te.Optional {
+		if obj == NULL {
+			return true
+		}
+		plain := *te
+		plain.Optional = false
+		te = &plain
+	}
+
+	if te.Name != "" && len(te.Arguments) == 0 {
+		if def, ok := env.Get(te.Name); ok {
+			switch def := def.(type) {
+			case *environment.RecordType:
+				r, ok := obj.(*environment.Record)
+				return ok && r.Def == def
+			case *environment.InterfaceType:
+				return implements(obj, def)
+			case *environment.TypeName:
+				if def.Alias {
+					return hasType(obj, def.Underlying, def.Env)
+				}
+				n, ok := obj.(*environment.NamedValue)
+				return ok && n.TypeName == def.Name
+			}
+		}
+	}
+	return typeName(obj) == te.String()
+}
+
+func implements(obj environment.Object, it *environment.InterfaceType) bool {
+	r, ok := obj.(*environment.Record)
+	if !ok {
+		return false
+	}
+	for name, want := range it.Methods {
+		have, ok := r.Def.Methods[name]
+		if !ok || signature(have, r.Def.Env) != signature(want, it.Env) {
+			return false
+		}
+	}
+	return true
+}
+
+// signature describes the parameter and result types of fl, written in
+// the scope env, the way the type checker compares method signatures:
+// aliases stand for the types they name, and untyped parameters and
+// results only match untyped ones.
+func signature(fl *ast.FunctionalLiteral, env *environment.Environment) string {
+	var out strings.Builder
+	out.WriteString("func(")
+	for i, p := range fl.Parameters {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		if p.Variadic {
+			out.WriteString("...")
+		}
+		out.WriteString(typeString(p.Type, env))
+	}
+	out.WriteString(") ")
+	out.WriteString(typeString(fl.ReturnType, env))
+	return out.String()
+}
+
+// typeString writes te, written in the scope env, with its aliases
+// replaced by the types they name.
+func typeString(te *ast.TypeExpression, env *environment.Environment) string {
+	if te == nil {
+		return "?"
+	}
+	suffix := ""
+	if te.Optional {
+		suffix = "?"
+	}
+	if te.Name == "" {
+		elems := make([]string, len(te.Elements))
+		for i, el := range te.Elements {
+			elems[i] = typeString(el, env)
+		}
+		return "(" + strings.Join(elems, ", ") + ")" + suffix
+	}
+	if len(te.Arguments) == 0 {
+		if def, ok := env.Get(te.Name); ok {
+			if t, ok := def.(*environment.TypeName); ok && t.Alias {
+				named := typeString(t.Underlying, t.Env)
+				if strings.HasSuffix(named, "?") {
+					// T? is the same type as T when T is optional.
+					return named
+				}
+				return named + suffix
+			}
+		}
+		return te.Name + suffix
+	}
+	args := make([]string, len(te.Arguments))
+	for i, arg := range te.Arguments {
+		args[i] = typeString(arg, env)
+	}
+	return te.Name + "[" + strings.Join(args, ", ") + "]" + suffix
+}
@@ -0,0 +1,83 @@
+package evaluator
+
+import "compiler/environment"
+
+func init() {
+	// These builtins run Blue code, so they cannot be part of the
+	// builtins initializer.
+	builtins["map"] = &environment.Builtin{Name: "map", Fn: builtinMap}
+	builtins["filter"] = &environment.Builtin{Name: "filter", Fn: builtinFilter}
+}
+
+// builtinMap calls a function on each element of a tuple or iterable
+// and returns the results as a tuple.
+func builtinMap(args ...environment.Object) environment.Object {
+	if err := checkArgCount("map", args, 2); err != nil {
+		return err
+	}
+	elements := []environment.Object{}
+	err := forEach("map", args[0], func(el environment.Object) environment.Object {
+		v := applyFunction(args[1], el)
+		if isAbrupt(v) {
+			return v
+		}
+		elements = append(elements, v)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return &environment.Tuple{Elements: elements}
+}
+
+// builtinFilter returns the elements of a tuple or iterable for which a
+// function returns true, as a tuple.
+func builtinFilter(args ...environment.Object) environment.Object {
+	if err := checkArgCount("filter", args, 2); err != nil {
+		return err
+	}
+	elements := []environment.Object{}
+	err := forEach("filter", args[0], func(el environment.Object) environment.Object {
+		v := applyFunction(args[1], el)
+		if isAbrupt(v) {
+			return v
+		}
+		keep, ok := v.(*environment.Boolean)
+		if !ok {
+			return newError("function passed to `filter` must return BOOLEAN, got %s", v.Type())
+		}
+		if keep.Value {
+			elements = append(elements, el)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return &environment.Tuple{Elements: elements}
+}
+
+// forEach calls fn on each element of seq, a tuple or an iterable, and
+// stops at the first error or panic, either fn's or the iterator's.
+func forEach(name string, seq environment.Object, fn func(environment.Object) environment.Object) environment.Object {
+	it, ok := iterate(seq)
+	if !ok {
+		return newError("argument to `%s` not supported, got %s", name, seq.Type())
+	}
+	for {
+		el, ok := it.Next()
+		if !ok {
+			return nil
+		}
+		stop := el
+		if !isAbrupt(el) {
+			stop = fn(el)
+		}
+		if stop != nil {
+			if c, ok := it.(environment.Closer); ok {
+				c.Close()
+			}
+			return stop
+		}
+	}
+}
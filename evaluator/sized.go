@@ -0,0 +1,169 @@
+package evaluator
+
+import (
+	"math/big"
+
+	"compiler/ast"
+	"compiler/environment"
+)
+
+// sizedLiterals gives an integer literal the type of the fixed-width
+// operand on the other side of node, so Int32(x) + 1 needs no
+// conversion of the 1. A literal that does not fit that type is an
+// error.
+func sizedLiterals(node *ast.InfixExpression, left, right environment.Object) (environment.Object, environment.Object, *environment.Error) {
+	if sized, ok := left.(*environment.SizedInteger); ok {
+		if lit, ok := node.Right.(*ast.IntegerLiteral); ok {
+			converted, err := literalOf(lit, sized.Kind)
+			return left, converted, err
+		}
+	}
+	if sized, ok := right.(*environment.SizedInteger); ok {
+		if lit, ok := node.Left.(*ast.IntegerLiteral); ok {
+			converted, err := literalOf(lit, sized.Kind)
+			return converted, right, err
+		}
+	}
+	return left, right, nil
+}
+
+func literalOf(lit *ast.IntegerLiteral, kind *environment.IntKind) (environment.Object, *environment.Error) {
+	v, fits := kind.Wrap(big.NewInt(lit.Value))
+	if !fits {
+		return nil, newError("line %d:%d: constant %d overflows %s", lit.Token.Line, lit.Token.Column, lit.Value, kind.Name)
+	}
+	return &environment.SizedInteger{Kind: kind, Value: v}, nil
+}
+
+func evalSizedInfixExpression(node *ast.InfixExpression, left, right *environment.SizedInteger, checked bool) environment.Object {
+	kind := left.Kind
+	l, r := kind.Big(left.Value), kind.Big(right.Value)
+
+	exact := new(big.Int)
+	switch node.Operator {
+	case "+":
+		exact.Add(l, r)
+	case "-":
+		exact.Sub(l, r)
+	case "*":
+		exact.Mul(l, r)
+	case "/", "%":
+		if r.Sign() == 0 {
+			return runtimePanic(node.Token, "integer divide by zero")
+		}
+		if node.Operator == "/" {
+			exact.Quo(l, r)
+		} else {
+			exact.Rem(l, r)
+		}
+	case "&":
+		exact.And(l, r)
+	case "|":
+		exact.Or(l, r)
+	case "^":
+		exact.Xor(l, r)
+	case "==":
+		return nativeBoolToBooleanObject(l.Cmp(r) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(l.Cmp(r) != 0)
+	case "<":
+		return nativeBoolToBooleanObject(l.Cmp(r) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(l.Cmp(r) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(l.Cmp(r) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(l.Cmp(r) >= 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), node.Operator, right.Type())
+	}
+
+	v, fits := kind.Wrap(exact)
+	if !fits && checked {
+		return runtimePanic(node.Token, "%s overflow: %s %s %s",
+			kind.Name, left.Inspect(), node.Operator, right.Inspect())
+	}
+	return &environment.SizedInteger{Kind: kind, Value: v}
+}
+
+func evalSizedNegation(node *ast.PrefixExpression, right *environment.SizedInteger, checked bool) environment.Object {
+	v, fits := right.Kind.Wrap(new(big.Int).Neg(right.Kind.Big(right.Value)))
+	if !fits && checked {
+		return runtimePanic(node.Token, "%s overflow: -(%s)", right.Kind.Name, right.Inspect())
+	}
+	return &environment.SizedInteger{Kind: right.Kind, Value: v}
+}
+
+// isShift reports whether node shifts an integer of any type by an
+// integer count of any type.
+func isShift(node *ast.InfixExpression, left, right environment.Object) bool {
+	if node.Operator != "<<" && node.Operator != ">>" {
+		return false
+	}
+	_, lok := bigValue(left)
+	_, rok := bigValue(right)
+	return lok && rok
+}
+
+// evalShiftExpression shifts left by right bits. The result has the type
+// of left; bits shifted out of a fixed-width integer are dropped rather
+// than reported as overflow.
+func evalShiftExpression(node *ast.InfixExpression, left, right environment.Object) environment.Object {
+	count, _ := bigValue(right)
+	if count.Sign() < 0 {
+		return newError("line %d:%d: negative shift count %s", node.Token.Line, node.Token.Column, count)
+	}
+	if !count.IsUint64() || count.Uint64() > 1<<16 {
+		return newError("line %d:%d: shift count %s too large", node.Token.Line, node.Token.Column, count)
+	}
+	n := uint(count.Uint64())
+
+	l, _ := bigValue(left)
+	shifted := new(big.Int)
+	if node.Operator == "<<" {
+		shifted.Lsh(l, n)
+	} else {
+		shifted.Rsh(l, n)
+	}
+
+	switch left := left.(type) {
+	case *environment.Integer:
+		v, _ := environment.Int64.Wrap(shifted)
+		return &environment.Integer{Value: v}
+	case *environment.SizedInteger:
+		v, _ := left.Kind.Wrap(shifted)
+		return &environment.SizedInteger{Kind: left.Kind, Value: v}
+	default:
+		return &environment.BigInteger{Value: shifted}
+	}
+}
+
+// bigValue returns the value of an integer of any type.
+func bigValue(obj environment.Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *environment.Integer:
+		return big.NewInt(obj.Value), true
+	case *environment.SizedInteger:
+		return obj.Kind.Big(obj.Value), true
+	case *environment.BigInteger:
+		return obj.Value, true
+	}
+	return nil, false
+}
+
+// conversion returns the builtin converting integers of any type to the
+// fixed-width type name. Values out of range wrap around.
+func conversion(name string) *environment.Builtin {
+	kind := environment.IntKinds[name]
+	return &environment.Builtin{Name: name, Fn: func(args ...environment.Object) environment.Object {
+		if err := checkArgCount(name, args, 1); err != nil {
+			return err
+		}
+		n, ok := bigValue(underlyingValue(args[0]))
+		if !ok {
+			return newError("cannot convert %s to %s", args[0].Type(), name)
+		}
+		v, _ := kind.Wrap(n)
+		return &environment.SizedInteger{Kind: kind, Value: v}
+	}}
+}
@@ -0,0 +1,372 @@
+package evaluator
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"compiler/ast"
+	"compiler/environment"
+)
+
+// mainTask stands for the main program, which spawned tasks outside of
+// any other task belong to.
+var mainTask = &environment.Task{}
+
+// tasks keeps count of the tasks that are running and of those blocked
+// on a channel or on the tasks they spawned, so that a program whose
+// every task waits for another fails instead of hanging.
+var tasks = &scheduler{running: 1, stuck: make(chan struct{})}
+
+// deadlockGrace is how long every task must stay blocked before the
+// program is taken to be deadlocked. A task counts as blocked a moment
+// before it starts waiting, so a shorter spell may still end.
+const deadlockGrace = 50 * time.Millisecond
+
+type scheduler struct {
+	mu       sync.Mutex
+	running  int           // the main program and the spawned tasks that have not finished
+	blocked  int           // the running tasks that are waiting
+	progress int           // the number of waits that have ended
+	stuck    chan struct{} // closed when the program is deadlocked
+}
+
+// wait runs reflect.Select on cases, which must not have a default, and
+// reports whether it gave up because no case can ever proceed.
+func (s *scheduler) wait(cases []reflect.SelectCase) (chosen int, received reflect.Value, ok bool, deadlocked bool) {
+	poll := append(cases[:len(cases):len(cases)], reflect.SelectCase{Dir: reflect.SelectDefault})
+	if chosen, received, ok = reflect.Select(poll); chosen < len(cases) {
+		return chosen, received, ok, false
+	}
+
+	s.mu.Lock()
+	s.blocked++
+	stuck := s.stuck
+	s.watch()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.blocked--
+		s.progress++
+		s.mu.Unlock()
+	}()
+
+	blocking := append(cases[:len(cases):len(cases)], reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stuck)})
+	if chosen, received, ok = reflect.Select(blocking); chosen == len(cases) {
+		return 0, reflect.Value{}, false, true
+	}
+	return chosen, received, ok, false
+}
+
+// finish records that a spawned task has finished.
+func (s *scheduler) finish() {
+	s.mu.Lock()
+	s.running--
+	s.watch()
+	s.mu.Unlock()
+}
+
+// watch declares the program deadlocked if every task is blocked now
+// and still is, with no wait having ended, after deadlockGrace. It must
+// be called with s.mu held.
+func (s *scheduler) watch() {
+	if s.blocked == 0 || s.blocked < s.running {
+		return
+	}
+	progress := s.progress
+	time.AfterFunc(deadlockGrace, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.blocked > 0 && s.blocked >= s.running && s.progress == progress {
+			close(s.stuck)
+			s.stuck = make(chan struct{})
+		}
+	})
+}
+
+func deadlockError() *environment.Error {
+	return newError("deadlock: every task is blocked")
+}
+
+// receive receives a value from ch for recv, as Ok(value), or Err once
+// the channel is closed and drained.
+func receive(ch *environment.Channel) environment.Object {
+	_, v, ok, deadlocked := tasks.wait([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.Ch)}})
+	if deadlocked {
+		return deadlockError()
+	}
+	return received(v, ok)
+}
+
+// received is the result of a receive that got v, or found the channel
+// closed if ok is false.
+func received(v reflect.Value, ok bool) environment.Object {
+	if !ok {
+		return &environment.Result{Ok: false, Value: &environment.String{Value: "channel closed"}}
+	}
+	return &environment.Result{Ok: true, Value: v.Interface().(environment.Object)}
+}
+
+// currentTask returns the task code running in env belongs to.
+func currentTask(env *environment.Environment) *environment.Task {
+	if frame := env.Frame(); frame != nil && frame.Task != nil {
+		return frame.Task
+	}
+	return mainTask
+}
+
+// evalSpawnStatement evaluates the function and arguments of the call
+// right away, like defer, and runs the call on a goroutine of its own. A
+// task does not finish until the tasks it spawned have finished, and
+// its failure is reported to the task that spawned it.
+func evalSpawnStatement(ss *ast.SpawnStatement, env *environment.Environment) environment.Object {
+	if err := notAtCompileTime(env, ss.Token, "spawn"); err != nil {
+		return err
+	}
+	function := Eval(ss.Call.Function, env)
+	if isAbrupt(function) {
+		return function
+	}
+	args := []environment.Object{}
+	for _, a := range ss.Call.Arguments {
+		arg := Eval(a, env)
+		if isAbrupt(arg) {
+			return arg
+		}
+		args = append(args, arg)
+	}
+
+	parent := currentTask(env)
+	task := &environment.Task{}
+	parent.Spawned()
+	tasks.mu.Lock()
+	tasks.running++
+	tasks.mu.Unlock()
+	go func() {
+		defer tasks.finish()
+		defer parent.Finished()
+		result := callFunction(function, args, &environment.Frame{Task: task})
+		if failure := waitForTasks(task); failure != nil && !isAbrupt(result) {
+			result = failure
+		}
+		if p, ok := result.(*environment.Panic); ok {
+			p.Trace = append(p.Trace, fmt.Sprintf("spawned %s (line %d:%d)",
+				ss.Call.Function.String(), ss.Token.Line, ss.Token.Column))
+		}
+		if isAbrupt(result) {
+			parent.Fail(result)
+		}
+	}()
+	return NULL
+}
+
+// waitForTasks waits until the tasks spawned from task, or from the
+// main program if task is nil, have finished. It returns the error or
+// panic the first of them to fail ended with, or nil.
+func waitForTasks(task *environment.Task) environment.Object {
+	if task == nil {
+		task = mainTask
+	}
+	if _, _, _, deadlocked := tasks.wait([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(task.Idle())}}); deadlocked {
+		return deadlockError()
+	}
+	return task.Failure()
+}
+
+// evalWait evaluates wait(), which waits for the tasks spawned from the
+// calling task and fails if one of them did.
+func evalWait(node *ast.CallExpression, env *environment.Environment) environment.Object {
+	if err := notAtCompileTime(env, node.Token, "wait"); err != nil {
+		return err
+	}
+	if len(node.Arguments) != 0 {
+		return newError("wrong number of arguments to `wait`: got=%d, want=0", len(node.Arguments))
+	}
+	if failure := waitForTasks(currentTask(env)); failure != nil {
+		return failure
+	}
+	return NULL
+}
+
+func evalChannelExpression(ce *ast.ChannelExpression, env *environment.Environment) environment.Object {
+	if err := notAtCompileTime(env, ce.Token, "creating a channel"); err != nil {
+		return err
+	}
+	var capacity int64
+	if ce.Capacity != nil {
+		val := Eval(ce.Capacity, env)
+		if isAbrupt(val) {
+			return val
+		}
+		n, ok := val.(*environment.Integer)
+		if !ok {
+			return newError("line %d:%d: channel capacity must be INTEGER, got %s", ce.Token.Line, ce.Token.Column, val.Type())
+		}
+		if n.Value < 0 {
+			return newError("line %d:%d: negative channel capacity %d", ce.Token.Line, ce.Token.Column, n.Value)
+		}
+		capacity = n.Value
+	}
+	elem := ""
+	if len(ce.Type.Arguments) > 0 {
+		elem = ce.Type.Arguments[0].String()
+	}
+	return &environment.Channel{Elem: elem, Ch: make(chan environment.Object, capacity)}
+}
+
+// evalSelectStatement evaluates the channels and values of every case,
+// in order, and then runs the first case that can proceed. Without a
+// default case it waits until one can.
+func evalSelectStatement(ss *ast.SelectStatement, env *environment.Environment) environment.Object {
+	if err := notAtCompileTime(env, ss.Token, "select"); err != nil {
+		return err
+	}
+	cases := make([]reflect.SelectCase, 0, len(ss.Cases)+1)
+	for _, sc := range ss.Cases {
+		c, err := evalSelectCase(sc, env)
+		if err != nil {
+			return err
+		}
+		cases = append(cases, c)
+	}
+	if ss.Default != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+
+	chosen, v, ok, p := selectCase(cases, ss.Default != nil)
+	if p != nil {
+		return p
+	}
+	if chosen < 0 {
+		return newError("line %d:%d: %s", ss.Token.Line, ss.Token.Column, deadlockError().Message)
+	}
+	if chosen == len(ss.Cases) {
+		return Eval(ss.Default, env)
+	}
+
+	sc := ss.Cases[chosen]
+	caseEnv := environment.NewEnclosedEnvironment(env)
+	if sc.Name != nil {
+		caseEnv.Set(sc.Name.Value, received(v, ok))
+	}
+	return evalStatements(sc.Body.Statements, caseEnv)
+}
+
+// selectCase chooses one of cases, waiting until one can proceed unless
+// the last of them is the default, and turns the Go panic of a send on
+// a closed channel into a Blue panic. The chosen case is -1 if none can
+// ever proceed.
+func selectCase(cases []reflect.SelectCase, hasDefault bool) (chosen int, received reflect.Value, ok bool, p *environment.Panic) {
+	defer func() {
+		if r := recover(); r != nil {
+			p = goPanic(r)
+		}
+	}()
+	if hasDefault {
+		chosen, received, ok = reflect.Select(cases)
+		return chosen, received, ok, nil
+	}
+	chosen, received, ok, deadlocked := tasks.wait(cases)
+	if deadlocked {
+		return -1, received, ok, nil
+	}
+	return chosen, received, ok, nil
+}
+
+func evalSelectCase(sc *ast.SelectCase, env *environment.Environment) (reflect.SelectCase, environment.Object) {
+	name, want := "recv", 1
+	if sc.IsSend() {
+		name, want = "send", 2
+	}
+	if len(sc.Call.Arguments) != want {
+		return reflect.SelectCase{}, arityError(name, want, len(sc.Call.Arguments), false)
+	}
+
+	args := []environment.Object{}
+	for _, a := range sc.Call.Arguments {
+		arg := Eval(a, env)
+		if isAbrupt(arg) {
+			return reflect.SelectCase{}, arg
+		}
+		args = append(args, arg)
+	}
+	ch, ok := args[0].(*environment.Channel)
+	if !ok {
+		return reflect.SelectCase{}, newError("line %d:%d: first argument to `%s` must be CHANNEL, got %s",
+			sc.Token.Line, sc.Token.Column, name, args[0].Type())
+	}
+
+	if sc.IsSend() {
+		return reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(ch.Ch), Send: reflect.ValueOf(&args[1]).Elem()}, nil
+	}
+	return reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.Ch)}, nil
+}
+
+func channelArg(name string, args []environment.Object, want int) (*environment.Channel, *environment.Error) {
+	if err := checkArgCount(name, args, want); err != nil {
+		return nil, err
+	}
+	ch, ok := args[0].(*environment.Channel)
+	if !ok {
+		return nil, newError("first argument to `%s` must be CHANNEL, got %s", name, args[0].Type())
+	}
+	return ch, nil
+}
+
+// builtinSend sends a value on a channel, waiting until there is room
+// for it. Sending on a closed channel panics.
+func builtinSend(args ...environment.Object) environment.Object {
+	ch, err := channelArg("send", args, 2)
+	if err != nil {
+		return err
+	}
+	send := reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(ch.Ch), Send: reflect.ValueOf(&args[1]).Elem()}
+	if _, _, _, deadlocked := tasks.wait([]reflect.SelectCase{send}); deadlocked {
+		return deadlockError()
+	}
+	return NULL
+}
+
+// builtinRecv receives a value from a channel, waiting until there is
+// one. It returns Ok(value), or an Err once the channel is closed and
+// drained, so that a null sent on the channel is told apart from the
+// end of its values.
+func builtinRecv(args ...environment.Object) environment.Object {
+	ch, err := channelArg("recv", args, 1)
+	if err != nil {
+		return err
+	}
+	return receive(ch)
+}
+
+// channelIterator receives from a channel for a for-in loop, until the
+// channel is closed.
+type channelIterator struct {
+	ch *environment.Channel
+}
+
+func (it channelIterator) Next() (environment.Object, bool) {
+	r := receive(it.ch)
+	if result, ok := r.(*environment.Result); ok {
+		return result.Value, result.Ok
+	}
+	return r, true
+}
+
+// builtinClose closes a channel, or a generator that is no longer
+// needed.
+func builtinClose(args ...environment.Object) environment.Object {
+	if err := checkArgCount("close", args, 1); err != nil {
+		return err
+	}
+	switch arg := args[0].(type) {
+	case *environment.Channel:
+		close(arg.Ch)
+	case environment.Closer:
+		arg.Close()
+	default:
+		return newError("argument to `close` not supported, got %s", args[0].Type())
+	}
+	return NULL
+}
@@ -0,0 +1,281 @@
+// Package flow builds control-flow graphs of Blue function bodies and
+// uses them to find missing returns, unreachable code and loops that
+// never exit.
+package flow
+
+import (
+	"fmt"
+	"strings"
+
+	"compiler/ast"
+)
+
+// Block is a basic block: statements that run one after the other,
+// followed by a jump to one of Succs. A statement that branches, such
+// as an if or a loop header, is the last statement of its block.
+type Block struct {
+	Index int
+	Kind  string // what made the block, e.g. "if.then" or "for.body"
+	Stmts []ast.Statement
+	Succs []*Block
+	Preds []*Block
+
+	// Live is set on the blocks reachable from the graph's entry.
+	Live bool
+}
+
+// Graph is the control-flow graph of a block of statements.
+type Graph struct {
+	Blocks []*Block
+	Entry  *Block
+
+	// Exit is where control goes when it leaves the body: by a return,
+	// by a panic or by running off its end.
+	Exit *Block
+
+	// End is the block control reaches by running off the end of the
+	// body. If it is live, the body can finish without a return.
+	End *Block
+
+	loops []loop
+	stray []*ast.BranchStatement // break or continue outside any loop
+}
+
+type loop struct {
+	stmt   *ast.ForStatement
+	header *Block
+	done   *Block
+}
+
+// New builds the control-flow graph of body. Nested function
+// declarations are not followed; each has a graph of its own.
+func New(body *ast.BlockStatement) *Graph {
+	b := &builder{g: &Graph{}}
+	b.g.Entry = b.newBlock("entry")
+	b.g.Exit = b.newBlock("exit")
+	b.cur = b.g.Entry
+
+	b.stmts(body.Statements)
+	b.g.End = b.cur
+	b.jump(b.g.Exit)
+
+	markLive(b.g.Entry)
+	return b.g
+}
+
+func (g *Graph) String() string {
+	var out strings.Builder
+	for _, blk := range g.Blocks {
+		fmt.Fprintf(&out, "%d %s:", blk.Index, blk.Kind)
+		for _, s := range blk.Succs {
+			fmt.Fprintf(&out, " %d", s.Index)
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// reaches reports whether to can be reached from from.
+func reaches(from, to *Block) bool {
+	seen := make(map[*Block]bool)
+	var visit func(b *Block) bool
+	visit = func(b *Block) bool {
+		if b == to {
+			return true
+		}
+		if seen[b] {
+			return false
+		}
+		seen[b] = true
+		for _, s := range b.Succs {
+			if visit(s) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(from)
+}
+
+func markLive(b *Block) {
+	if b.Live {
+		return
+	}
+	b.Live = true
+	for _, s := range b.Succs {
+		markLive(s)
+	}
+}
+
+type builder struct {
+	g       *Graph
+	cur     *Block
+	targets *targets
+}
+
+// targets are where break and continue go in the innermost loop.
+type targets struct {
+	breakTo    *Block
+	continueTo *Block
+	outer      *targets
+}
+
+func (b *builder) newBlock(kind string) *Block {
+	blk := &Block{Index: len(b.g.Blocks), Kind: kind}
+	b.g.Blocks = append(b.g.Blocks, blk)
+	return blk
+}
+
+func (b *builder) add(s ast.Statement) {
+	b.cur.Stmts = append(b.cur.Stmts, s)
+}
+
+// jump ends the current block with an edge to target.
+func (b *builder) jump(target *Block) {
+	edge(b.cur, target)
+}
+
+func edge(from, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// dead starts a new block after an unconditional jump. Statements put
+// in it cannot run.
+func (b *builder) dead() {
+	b.cur = b.newBlock("unreachable")
+}
+
+func (b *builder) stmts(stmts []ast.Statement) {
+	for _, s := range stmts {
+		b.stmt(s)
+	}
+}
+
+func (b *builder) stmt(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.ReturnStatement:
+		b.add(s)
+		b.jump(b.g.Exit)
+		b.dead()
+
+	case *ast.ExpressionStatement:
+		b.add(s)
+		if isPanic(s.Expression) {
+			b.jump(b.g.Exit)
+			b.dead()
+		}
+
+	case *ast.BranchStatement:
+		b.add(s)
+		switch {
+		case b.targets == nil:
+			b.g.stray = append(b.g.stray, s)
+		case s.Token.Lexeme == "break":
+			b.jump(b.targets.breakTo)
+		default:
+			b.jump(b.targets.continueTo)
+		}
+		b.dead()
+
+	case *ast.IfStatement:
+		b.add(s)
+		cond := b.cur
+		then := b.newBlock("if.then")
+		done := b.newBlock("if.done")
+		edge(cond, then)
+		b.cur = then
+		b.stmts(s.Consequence.Statements)
+		b.jump(done)
+		if s.Alternative != nil {
+			els := b.newBlock("if.else")
+			edge(cond, els)
+			b.cur = els
+			b.stmts(s.Alternative.Statements)
+			b.jump(done)
+		} else {
+			edge(cond, done)
+		}
+		b.cur = done
+
+	case *ast.SwitchStatement:
+		b.add(s)
+		head := b.cur
+		done := b.newBlock("switch.done")
+		for _, tc := range s.Cases {
+			b.branch(head, "switch.case", tc.Body, done)
+		}
+		if s.Default != nil {
+			b.branch(head, "switch.default", s.Default, done)
+		} else {
+			edge(head, done)
+		}
+		b.cur = done
+
+	case *ast.SelectStatement:
+		// Without a default, select waits until one of its cases runs,
+		// so an empty select never finishes.
+		b.add(s)
+		head := b.cur
+		done := b.newBlock("select.done")
+		for _, sc := range s.Cases {
+			b.branch(head, "select.case", sc.Body, done)
+		}
+		if s.Default != nil {
+			b.branch(head, "select.default", s.Default, done)
+		}
+		b.cur = done
+
+	case *ast.ForStatement:
+		header := b.newBlock("for.loop")
+		body := b.newBlock("for.body")
+		done := b.newBlock("for.done")
+		b.jump(header)
+		header.Stmts = append(header.Stmts, s)
+		edge(header, body)
+		if s.Iterable != nil || !alwaysTrue(s.Condition) {
+			edge(header, done)
+		}
+
+		b.targets = &targets{breakTo: done, continueTo: header, outer: b.targets}
+		b.cur = body
+		b.stmts(s.Body.Statements)
+		b.jump(header)
+		b.targets = b.targets.outer
+
+		b.g.loops = append(b.g.loops, loop{stmt: s, header: header, done: done})
+		b.cur = done
+
+	default:
+		b.add(s)
+	}
+}
+
+// branch adds body as a block of the given kind that from may run
+// before continuing at done.
+func (b *builder) branch(from *Block, kind string, body *ast.BlockStatement, done *Block) {
+	blk := b.newBlock(kind)
+	edge(from, blk)
+	b.cur = blk
+	b.stmts(body.Statements)
+	b.jump(done)
+}
+
+// isPanic reports whether e is a call of the panic builtin, which never
+// returns.
+func isPanic(e ast.Expression) bool {
+	call, ok := e.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "panic"
+}
+
+func alwaysTrue(cond ast.Expression) bool {
+	if cond == nil {
+		return true
+	}
+	b, ok := cond.(*ast.Boolean)
+	return ok && b.Value
+}
@@ -0,0 +1,217 @@
+package flow
+
+import (
+	"fmt"
+
+	"compiler/ast"
+	"compiler/token"
+)
+
+// Error is a control-flow error at a position in the source.
+type Error struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Check analyses the top level of program, every function declared in
+// it, every lambda and every comptime block. It reports functions with a return type
+// that can finish without returning, code that can never run, break and
+// continue outside of a loop, and loops that can never be left.
+func Check(program *ast.Program) []*Error {
+	c := &checker{}
+	c.body(&ast.BlockStatement{Statements: program.Statements}, nil)
+	ast.Modify(program, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.ComptimeExpression:
+			c.body(n.Block, nil)
+		case *ast.FunctionalLiteral:
+			// Declared functions and methods are checked with the
+			// statements that declare them.
+			if n.Lambda {
+				c.body(n.Body, n)
+			}
+		}
+		return n
+	})
+	return c.errors
+}
+
+type checker struct {
+	errors []*Error
+}
+
+func (c *checker) errorf(tok token.Token, format string, args ...interface{}) {
+	c.errors = append(c.errors, &Error{Line: tok.Line, Column: tok.Column, Msg: fmt.Sprintf(format, args...)})
+}
+
+// body checks the statements of a function, or of the program when fl
+// is nil.
+func (c *checker) body(body *ast.BlockStatement, fl *ast.FunctionalLiteral) {
+	g := New(body)
+
+	// Each dead region is reported once, at its first statement, even
+	// when several dead blocks lead into it.
+	reported := make(map[ast.Statement]bool)
+	for _, blk := range g.Blocks {
+		if !blk.Live && len(blk.Preds) == 0 {
+			if s := firstStatement(blk, make(map[*Block]bool)); s != nil && !reported[s] {
+				reported[s] = true
+				c.errorf(position(s), "unreachable code")
+			}
+		}
+	}
+
+	for _, s := range g.stray {
+		c.errorf(s.Token, "%s is not in a loop", s.Token.Lexeme)
+	}
+
+	// A generator's loop also hands control back to its consumer at
+	// each yield, so it may go on for as long as the consumer asks.
+	generator := fl != nil && fl.Generator
+	for _, l := range g.loops {
+		if generator && yields(l.header) {
+			continue
+		}
+		if l.header.Live && !reaches(l.header, l.done) && !reaches(l.header, g.Exit) {
+			c.errorf(l.stmt.Token, "infinite loop without exit")
+		}
+	}
+
+	// A generator returns its generator when it is called, not when
+	// its body ends.
+	if fl != nil && fl.ReturnType != nil && !fl.Generator && g.End.Live {
+		c.errorf(fl.FunctionName.Token, "missing return in %s", fl.FunctionName.Value)
+	}
+
+	c.nested(body.Statements)
+}
+
+// firstStatement returns the first statement that can run from blk
+// on, following dead blocks only. Function and type declarations are
+// skipped: they are hoisted, so they are not dead wherever they appear.
+func firstStatement(blk *Block, seen map[*Block]bool) ast.Statement {
+	if blk.Live || seen[blk] {
+		return nil
+	}
+	seen[blk] = true
+	for _, s := range blk.Stmts {
+		if !isHoisted(s) {
+			return s
+		}
+	}
+	for _, succ := range blk.Succs {
+		if s := firstStatement(succ, seen); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// yields reports whether a yield statement can run from blk on.
+func yields(blk *Block) bool {
+	seen := make(map[*Block]bool)
+	var visit func(b *Block) bool
+	visit = func(b *Block) bool {
+		if seen[b] {
+			return false
+		}
+		seen[b] = true
+		for _, s := range b.Stmts {
+			if _, ok := s.(*ast.YieldStatement); ok {
+				return true
+			}
+		}
+		for _, succ := range b.Succs {
+			if visit(succ) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(blk)
+}
+
+func isHoisted(s ast.Statement) bool {
+	switch s.(type) {
+	case *ast.FunctionStatement, *ast.TypeStatement, *ast.RecordStatement, *ast.InterfaceStatement:
+		return true
+	}
+	return false
+}
+
+// nested checks the functions and methods declared anywhere in stmts.
+func (c *checker) nested(stmts []ast.Statement) {
+	for _, s := range stmts {
+		switch s := s.(type) {
+		case *ast.FunctionStatement:
+			c.body(s.Literal.Body, s.Literal)
+		case *ast.IfStatement:
+			c.nested(s.Consequence.Statements)
+			if s.Alternative != nil {
+				c.nested(s.Alternative.Statements)
+			}
+		case *ast.ForStatement:
+			c.nested(s.Body.Statements)
+		case *ast.SwitchStatement:
+			for _, tc := range s.Cases {
+				c.nested(tc.Body.Statements)
+			}
+			if s.Default != nil {
+				c.nested(s.Default.Statements)
+			}
+		case *ast.SelectStatement:
+			for _, sc := range s.Cases {
+				c.nested(sc.Body.Statements)
+			}
+			if s.Default != nil {
+				c.nested(s.Default.Statements)
+			}
+		case *ast.RecordStatement:
+			for _, m := range s.Methods {
+				c.body(m.Body, m)
+			}
+		}
+	}
+}
+
+// position returns the token an error about s should point at.
+func position(s ast.Statement) token.Token {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		return s.Token
+	case *ast.ConstStatement:
+		return s.Token
+	case *ast.AssignmentStatement:
+		return s.Name.Token
+	case *ast.ReturnStatement:
+		return s.Token
+	case *ast.ExpressionStatement:
+		return s.Token
+	case *ast.IfStatement:
+		return s.Token
+	case *ast.ImportStatement:
+		return s.Token
+	case *ast.DestructureStatement:
+		return s.Token
+	case *ast.DeferStatement:
+		return s.Token
+	case *ast.YieldStatement:
+		return s.Token
+	case *ast.SpawnStatement:
+		return s.Token
+	case *ast.SelectStatement:
+		return s.Token
+	case *ast.ForStatement:
+		return s.Token
+	case *ast.BranchStatement:
+		return s.Token
+	case *ast.SwitchStatement:
+		return s.Token
+	}
+	return token.Token{}
+}
@@ -0,0 +1,117 @@
+package flow_test
+
+import (
+	"reflect"
+	"testing"
+
+	"compiler/ast"
+	"compiler/flow"
+	"compiler/lexer"
+	"compiler/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+func TestGraphOfLoop(t *testing.T) {
+	program := parse(t, `for (x < 10) { if (x == 5) { break; } x = x + 1; }`)
+	g := flow.New(&ast.BlockStatement{Statements: program.Statements})
+
+	want := `0 entry: 2
+1 exit:
+2 for.loop: 3 4
+3 for.body: 5 6
+4 for.done: 1
+5 if.then: 4
+6 if.done: 2
+7 unreachable: 6
+`
+	if got := g.String(); got != want {
+		t.Errorf("graph =\n%s\nwant\n%s", got, want)
+	}
+	if g.End.Index != 4 || !g.End.Live {
+		t.Errorf("End = %d (live %t); want the live for.done block", g.End.Index, g.End.Live)
+	}
+	if g.Blocks[7].Live {
+		t.Errorf("block after break is live")
+	}
+}
+
+func TestWellFormedFunctions(t *testing.T) {
+	tests := []string{
+		`func Integer f(x) { if (x) { return 1; } else { return 2; } }`,
+		`func Integer f(x) { if (x) { return 1; } return 2; }`,
+		`func Integer f(x) { for { if (x) { return 1; } } }`,
+		`func Integer f(x) { panic("no"); }`,
+		`func g() { }`,
+		`func Integer f() { return 1; func Integer g() { return 2; } }`,
+		`func h(x) { for (x) { if (x) { continue; } break; } }`,
+		`func Integer f(s) { switch (s) { case A a { return 1; } default { return 2; } } }`,
+		`record R { func Integer get() { return 1; } }`,
+		`func f(xs) { for (x in xs) { f(x); } }`,
+		`func Generator[Integer] g() { yield 1; }`,
+		`func Generator[Integer] nat() { let i = 0; for { yield i; i = i + 1; } }`,
+		`let f = (x) => x * 2; let g = (x) => { if (x) { return 1; } return 2; };`,
+		`func Generator[Integer] g(x) { for { if (x) { yield 1; } } }`,
+		`func Integer f(c) { select { case recv(c) v { return 1; } case send(c, 1) { return 2; } } }`,
+		`func f(c) { spawn f(c); select { case recv(c) v { } default { } } f(c); }`,
+	}
+	for _, input := range tests {
+		if errs := flow.Check(parse(t, input)); len(errs) > 0 {
+			t.Errorf("Check(%q) = %v; want no errors", input, errs)
+		}
+	}
+}
+
+func TestFlowErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{`func Integer f() { }`, []string{"line 1:14: missing return in f"}},
+		{`func Integer f(x) { if (x) { return 1; } }`, []string{"line 1:14: missing return in f"}},
+		{`func f() { return; f(); }`, []string{"line 1:20: unreachable code"}},
+		{`func f() { for { break; f(); } }`, []string{"line 1:25: unreachable code"}},
+		{`func f() { return; for { } }`, []string{"line 1:20: unreachable code"}},
+		{`func f() { for { } f(); }`, []string{"line 1:20: unreachable code", "line 1:12: infinite loop without exit"}},
+		{`func f(x) { for (true) { x = 1; } }`, []string{"line 1:13: infinite loop without exit"}},
+		{`break;`, []string{"line 1:1: break is not in a loop"}},
+		{`func f() { func Integer g() { } }`, []string{"line 1:25: missing return in g"}},
+		{`func Integer f(s) { switch (s) { case A a { return 1; } } }`, []string{"line 1:14: missing return in f"}},
+		{`func f(s) { switch (s) { default { return; f(s); } } }`, []string{"line 1:44: unreachable code"}},
+		{`record R { func Integer get() { } }`, []string{"line 1:25: missing return in get"}},
+		{`func Integer f(xs) { for (x in xs) { return x; } }`, []string{"line 1:14: missing return in f"}},
+		{`func Generator[Integer] g() { return; yield 1; }`, []string{"line 1:39: unreachable code"}},
+		{`func Generator[Integer] g() { yield 1; for { } }`, []string{"line 1:40: infinite loop without exit"}},
+		{`func Generator[Integer] g() { for { yield 1; } g(); }`, []string{"line 1:48: unreachable code"}},
+		{`func f() { select { } f(); }`, []string{"line 1:23: unreachable code"}},
+		{`func Integer f(c) { select { case recv(c) v { return 1; } default { } } }`, []string{"line 1:14: missing return in f"}},
+		{`func Integer f(c) { if (c) { return 1; } else { return 2; } return 3; }`, []string{"line 1:61: unreachable code"}},
+		{`func f(c) { select { case recv(c) v { return; } default { return; } } f(c); }`, []string{"line 1:71: unreachable code"}},
+		{`func f() { return; f(); for { } }`, []string{"line 1:20: unreachable code"}},
+		{`func Integer f() { } func Integer g() { }`, []string{"line 1:14: missing return in f", "line 1:35: missing return in g"}},
+		{`const K = comptime { for { } };`, []string{"line 1:22: infinite loop without exit"}},
+		{`const K = comptime { return 1; K; };`, []string{"line 1:32: unreachable code"}},
+		{`func f() { let k = comptime { break; }; }`, []string{"line 1:31: break is not in a loop"}},
+		{`let f = (x) => { return x; let y = 1; };`, []string{"line 1:28: unreachable code"}},
+		{`let f = () => { for { } };`, []string{"line 1:17: infinite loop without exit"}},
+		{`func g() { let f = (x) => (y) => { break; }; }`, []string{"line 1:36: break is not in a loop"}},
+		{`const K = comptime { let f = () => { return; f(); }; return 1; };`, []string{"line 1:46: unreachable code"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, err := range flow.Check(parse(t, tt.input)) {
+			got = append(got, err.Error())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
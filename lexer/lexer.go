@@ -3,6 +3,7 @@ package lexer
 import (
 	"compiler/token"
 	"fmt"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -73,24 +74,89 @@ func (l *Lexer) readIdentifier() string {
 	return l.Input[start:l.Position]
 }
 
+// readNumber reads the digits of a number, together with the n suffix
+// that marks a BigInteger literal.
 func (l *Lexer) readNumber() string {
 	start := l.Position
 	for isDigit(l.Ch) {
 		l.readChar()
 	}
+	if l.Ch == 'n' && !isLetter(l.peekChar()) && !isDigit(l.peekChar()) {
+		l.readChar()
+	}
 	return l.Input[start:l.Position]
 }
 
+// readString reads a double-quoted string literal and returns its
+// contents with escape sequences resolved, and whether it is closed. The
+// closing quote, or the end of the input, is left as the current
+// character.
+func (l *Lexer) readString() (string, bool) {
+	var out []rune
+	for {
+		l.readChar()
+		switch l.Ch {
+		case '"':
+			return string(out), true
+		case 0:
+			return string(out), false
+		case '\\':
+			l.readChar()
+			switch l.Ch {
+			case 'n':
+				out = append(out, '\n')
+			case 't':
+				out = append(out, '\t')
+			default:
+				out = append(out, l.Ch)
+			}
+		default:
+			out = append(out, l.Ch)
+		}
+	}
+}
+
 func lookupIdentifier(ident string) token.TokenType {
 	keywords := map[string]token.TokenType{
-		"let":     token.TokenKeyword,
-		"if":      token.TokenKeyword,
-		"else":    token.TokenKeyword,
-		"for":     token.TokenKeyword,
-		"func":    token.TokenKeyword,
-		"return":  token.TokenKeyword,
-		"Integer": token.TokenKeyword,
-		"String":  token.TokenKeyword,
+		"let":       token.TokenKeyword,
+		"const":     token.TokenKeyword,
+		"if":        token.TokenKeyword,
+		"else":      token.TokenKeyword,
+		"for":       token.TokenKeyword,
+		"in":        token.TokenKeyword,
+		"break":     token.TokenKeyword,
+		"continue":  token.TokenKeyword,
+		"func":      token.TokenKeyword,
+		"return":    token.TokenKeyword,
+		"yield":     token.TokenKeyword,
+		"defer":     token.TokenKeyword,
+		"spawn":     token.TokenKeyword,
+		"select":    token.TokenKeyword,
+		"chan":      token.TokenKeyword,
+		"macro":     token.TokenKeyword,
+		"quote":     token.TokenKeyword,
+		"comptime":  token.TokenKeyword,
+		"import":    token.TokenKeyword,
+		"pub":       token.TokenKeyword,
+		"type":      token.TokenKeyword,
+		"interface": token.TokenKeyword,
+		"switch":    token.TokenKeyword,
+		"case":      token.TokenKeyword,
+		"default":   token.TokenKeyword,
+		"true":      token.TokenKeyword,
+		"false":     token.TokenKeyword,
+		"null":      token.TokenKeyword,
+		"Integer":   token.TokenKeyword,
+		"String":    token.TokenKeyword,
+		"Int8":      token.TokenKeyword,
+		"Int16":     token.TokenKeyword,
+		"Int32":     token.TokenKeyword,
+		"Int64":     token.TokenKeyword,
+		"UInt8":     token.TokenKeyword,
+		"UInt16":    token.TokenKeyword,
+		"UInt32":    token.TokenKeyword,
+		"UInt64":    token.TokenKeyword,
+		"Byte":      token.TokenKeyword,
 	}
 	if typ, ok := keywords[ident]; ok {
 		return typ
@@ -119,8 +185,17 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	switch l.Ch {
-	case '=':
-		if l.peekChar() == '=' {
+	case '=', '!', '<', '>':
+		if l.Ch == '=' && l.peekChar() == '>' {
+			l.readChar()
+			tok.Type = token.TokenArrow
+			tok.Lexeme = "=>"
+		} else if (l.Ch == '<' || l.Ch == '>') && l.peekChar() == l.Ch {
+			ch := l.Ch
+			l.readChar()
+			tok.Lexeme = string(ch) + string(l.Ch)
+			tok.Type = token.TokenOperator
+		} else if l.peekChar() == '=' {
 			ch := l.Ch
 			l.readChar()
 			tok.Lexeme = string(ch) + string(l.Ch)
@@ -129,7 +204,14 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.TokenOperator
 			tok.Lexeme = string(l.Ch)
 		}
-	case '+':
+	case '|':
+		tok.Type = token.TokenOperator
+		tok.Lexeme = "|"
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok.Lexeme = "|>"
+		}
+	case '+', '-', '*', '/', '%', '&', '^', '~':
 		tok.Type = token.TokenOperator
 		tok.Lexeme = string(l.Ch)
 	case '{':
@@ -138,6 +220,31 @@ func (l *Lexer) NextToken() token.Token {
 	case '}':
 		tok.Type = token.TokenRBrace
 		tok.Lexeme = "}"
+	case '@':
+		tok.Type = token.TokenAt
+		tok.Lexeme = "@"
+	case '?':
+		switch l.peekChar() {
+		case '?':
+			l.readChar()
+			tok.Type = token.TokenOperator
+			tok.Lexeme = "??"
+		case '.':
+			// Safe navigation: a member access that yields null when
+			// the object is null.
+			l.readChar()
+			tok.Type = token.TokenDot
+			tok.Lexeme = "?."
+		default:
+			tok.Type = token.TokenQuestion
+			tok.Lexeme = "?"
+		}
+	case '[':
+		tok.Type = token.TokenLBracket
+		tok.Lexeme = "["
+	case ']':
+		tok.Type = token.TokenRBracket
+		tok.Lexeme = "]"
 	case '(':
 		tok.Type = token.TokenLParen
 		tok.Lexeme = "("
@@ -150,6 +257,34 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok.Type = token.TokenComma
 		tok.Lexeme = string(l.Ch)
+	case '.':
+		rest := l.Input[l.Position:]
+		if strings.HasPrefix(rest, "...") {
+			l.readChar()
+			l.readChar()
+			tok.Type = token.TokenEllipsis
+			tok.Lexeme = "..."
+		} else if strings.HasPrefix(rest, "..=") {
+			l.readChar()
+			l.readChar()
+			tok.Type = token.TokenOperator
+			tok.Lexeme = "..="
+		} else if strings.HasPrefix(rest, "..") {
+			l.readChar()
+			tok.Type = token.TokenOperator
+			tok.Lexeme = ".."
+		} else {
+			tok.Type = token.TokenDot
+			tok.Lexeme = string(l.Ch)
+		}
+	case '"':
+		s, closed := l.readString()
+		tok.Type = token.TokenString
+		tok.Lexeme = s
+		if !closed {
+			tok.Type = token.TokenIllegal
+			tok.Lexeme = `"` + s
+		}
 	case 0:
 		tok.Type = token.TokenEOF
 		tok.Lexeme = ""
@@ -2,6 +2,8 @@ package lexer
 
 import (
 	"testing"
+
+	"compiler/token"
 )
 
 func TestIsLetter(t *testing.T) {
@@ -144,3 +146,59 @@ func TestNextToken(t *testing.T) {
 		t.Errorf("Token expected: 'varName', Token recieved: %s", output.Lexeme)
 	}
 }
+
+func TestNextTokenOperatorsAndLiterals(t *testing.T) {
+	input := `"a\tb\"c" 0..3 1..=2 ...xs a?.b a ?? b xs |> f (x) => x 12n`
+	tests := []struct {
+		typ    token.TokenType
+		lexeme string
+	}{
+		{token.TokenString, "a\tb\"c"},
+		{token.TokenNumber, "0"},
+		{token.TokenOperator, ".."},
+		{token.TokenNumber, "3"},
+		{token.TokenNumber, "1"},
+		{token.TokenOperator, "..="},
+		{token.TokenNumber, "2"},
+		{token.TokenEllipsis, "..."},
+		{token.TokenIdentifier, "xs"},
+		{token.TokenIdentifier, "a"},
+		{token.TokenDot, "?."},
+		{token.TokenIdentifier, "b"},
+		{token.TokenIdentifier, "a"},
+		{token.TokenOperator, "??"},
+		{token.TokenIdentifier, "b"},
+		{token.TokenIdentifier, "xs"},
+		{token.TokenOperator, "|>"},
+		{token.TokenIdentifier, "f"},
+		{token.TokenLParen, "("},
+		{token.TokenIdentifier, "x"},
+		{token.TokenRParen, ")"},
+		{token.TokenArrow, "=>"},
+		{token.TokenIdentifier, "x"},
+		{token.TokenNumber, "12n"},
+		{token.TokenEOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.typ || tok.Lexeme != tt.lexeme {
+			t.Fatalf("token %d = %s %q; want %s %q", i, tok.Type, tok.Lexeme, tt.typ, tt.lexeme)
+		}
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	l := New("let s = \"abc;\nreturn s;")
+	for i := 0; i < 3; i++ {
+		l.NextToken()
+	}
+	tok := l.NextToken()
+	if tok.Type != token.TokenIllegal || tok.Line != 1 || tok.Column != 9 {
+		t.Errorf("token = %s %q at line %d:%d; want an illegal token at line 1:9", tok.Type, tok.Lexeme, tok.Line, tok.Column)
+	}
+	if tok := l.NextToken(); tok.Type != token.TokenEOF {
+		t.Errorf("token after the string = %s %q; want EOF", tok.Type, tok.Lexeme)
+	}
+}
@@ -6,23 +6,51 @@ import (
 	"compiler/token"
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 const (
 	_ int = iota
 	LOWEST
-	SUM     // + or -
-	PRODUCT // * or /
-	PREFIX  // -X or !X
-	// CALL  // func(X)
+	PIPE        // |>
+	EQUALS      // == or !=
+	LESSGREATER // < > <= >=
+	RANGE       // .. or ..=
+	COALESCE    // ??
+	SUM         // +, -, | or ^
+	PRODUCT     // *, /, %, <<, >> or &
+	PREFIX      // -X, !X or ~X
+	CALL        // func(X)
 )
 
 var precedences = map[string]int{
-	"+": SUM,
-	"-": SUM,
-	"*": PRODUCT,
-	"/": PRODUCT,
+	"|>":  PIPE,
+	"==":  EQUALS,
+	"!=":  EQUALS,
+	"<":   LESSGREATER,
+	">":   LESSGREATER,
+	"<=":  LESSGREATER,
+	">=":  LESSGREATER,
+	"..":  RANGE,
+	"..=": RANGE,
+	"??":  COALESCE,
+	"+":   SUM,
+	"-":   SUM,
+	"*":   PRODUCT,
+	"/":   PRODUCT,
+	"%":   PRODUCT,
+	"<<":  PRODUCT,
+	">>":  PRODUCT,
+	"&":   PRODUCT,
+	"|":   SUM,
+	"^":   SUM,
+	"(":   CALL,
+	".":   CALL,
+	"?.":  CALL,
+	"?":   CALL,
 }
 
 type (
@@ -35,6 +63,12 @@ type Parser struct {
 	CurToken  token.Token  `json:"curToken"`
 	PeekToken token.Token  `json:"peekToken"`
 
+	errors []string
+
+	// function is the function whose body is being parsed, nil at top
+	// level.
+	function *ast.FunctionalLiteral
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -49,8 +83,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.TokenIdentifier, p.parseIdentifier)
 	p.registerPrefix(token.TokenNumber, p.parseIntegerLiteral)
 	p.registerPrefix(token.TokenOperator, p.parsePrefixExpression)
+	p.registerPrefix(token.TokenString, p.parseStringLiteral)
+	p.registerPrefix(token.TokenKeyword, p.parseKeywordExpression)
+	p.registerPrefix(token.TokenLParen, p.parseGroupedExpression)
 
 	p.registerInfix(token.TokenOperator, p.parseInfixExpression)
+	p.registerInfix(token.TokenLParen, p.parseCallExpression)
+	p.registerInfix(token.TokenDot, p.parseMemberExpression)
+	p.registerInfix(token.TokenQuestion, p.parseTryExpression)
 	p.nextToken()
 	p.nextToken()
 	return p
@@ -67,11 +107,36 @@ func (p *Parser) registerInfix(tt token.TokenType, fn infixParseFn) {
 func (p *Parser) nextToken() {
 	p.CurToken = p.PeekToken
 	p.PeekToken = p.L.NextToken()
+	if p.PeekToken.Type == token.TokenIllegal {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d: unterminated string",
+			p.PeekToken.Line, p.PeekToken.Column))
+	}
+}
+
+// Errors returns the syntax errors collected while parsing.
+func (p *Parser) Errors() []string {
+	return p.errors
+}
+
+func (p *Parser) peekError(t token.TokenType) {
+	if p.PeekToken.Type == token.TokenIllegal {
+		return // reported when it was read
+	}
+	msg := fmt.Sprintf("line %d:%d: expected next token to be %s, got %q",
+		p.PeekToken.Line, p.PeekToken.Column, t, p.PeekToken.Lexeme)
+	p.errors = append(p.errors, msg)
+}
+
+func (p *Parser) noPrefixParseFnError(tok token.Token) {
+	if tok.Type == token.TokenIllegal {
+		return // reported when it was read
+	}
+	msg := fmt.Sprintf("line %d:%d: unexpected %q", tok.Line, tok.Column, tok.Lexeme)
+	p.errors = append(p.errors, msg)
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
-	fmt.Printf("lexeme: %s", p.CurToken.Lexeme)
 	for p.CurToken.Type != token.TokenEOF {
 		stmt := p.parseStatement()
 		if stmt != nil {
@@ -88,26 +153,382 @@ func (p *Parser) parseStatement() ast.Statement {
 		if p.PeekToken.Lexeme == "=" {
 			return p.parseAssignmentStatement()
 		}
+		// record is not reserved, so it only starts a declaration when
+		// followed by the record's name.
+		if p.CurToken.Lexeme == "record" && p.PeekToken.Type == token.TokenIdentifier {
+			if stmt := p.parseRecordStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		}
 	case token.TokenKeyword:
 		switch p.CurToken.Lexeme {
 		case "let":
 			return p.parseLetStatement()
+		case "const":
+			if stmt := p.parseConstStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
 		case "return":
-			println("i am in return")
 			return p.parseReturnStatement()
 		case "func":
-			return p.parseFunctionDeclaration()
+			fl := p.parseFunctionDeclaration()
+			if fl == nil {
+				return nil
+			}
+			return &ast.FunctionStatement{Literal: fl}
+		case "if":
+			if stmt := p.parseIfStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "for":
+			if stmt := p.parseForStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "break", "continue":
+			stmt := &ast.BranchStatement{Token: p.CurToken}
+			if p.PeekToken.Lexeme == ";" {
+				p.nextToken()
+			}
+			return stmt
+		case "yield":
+			if stmt := p.parseYieldStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "defer":
+			if stmt := p.parseDeferStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "import":
+			if stmt := p.parseImportStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "type":
+			if stmt := p.parseTypeStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "interface":
+			if stmt := p.parseInterfaceStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "switch":
+			if stmt := p.parseSwitchStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "select":
+			if stmt := p.parseSelectStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "spawn":
+			if stmt := p.parseSpawnStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "macro":
+			if stmt := p.parseMacroStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		case "pub":
+			return p.parsePublicDeclaration()
 		}
-	case token.TokenRBrace:
-		print("help i am here")
+	case token.TokenAt:
+		return p.parseAttributedDeclaration()
+	case token.TokenRBrace, token.TokenSemicolon:
+		return nil
+	}
+	return p.parseExpressionStatement()
+}
+
+func (p *Parser) parseExpressionStatement() ast.Statement {
+	stmt := &ast.ExpressionStatement{Token: p.CurToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil {
+		return nil
+	}
+	if p.PeekToken.Lexeme == ";" {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseDeferStatement() *ast.DeferStatement {
+	stmt := &ast.DeferStatement{Token: p.CurToken}
+	p.nextToken()
+
+	call, ok := p.parseExpression(LOWEST).(*ast.CallExpression)
+	if !ok {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d: defer requires a function call",
+			stmt.Token.Line, stmt.Token.Column))
+		return nil
+	}
+	stmt.Call = call
+
+	if p.PeekToken.Lexeme == ";" {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseYieldStatement parses yield value; and marks the enclosing
+// function as a generator.
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	stmt := &ast.YieldStatement{Token: p.CurToken}
+	if p.function == nil {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d: yield outside function",
+			stmt.Token.Line, stmt.Token.Column))
 		return nil
 	}
+	p.function.Generator = true
+
+	p.nextToken()
+	if stmt.Value = p.parseExpression(LOWEST); stmt.Value == nil {
+		return nil
+	}
+	if p.PeekToken.Lexeme == ";" {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseSpawnStatement() *ast.SpawnStatement {
+	stmt := &ast.SpawnStatement{Token: p.CurToken}
+	p.nextToken()
+
+	call, ok := p.parseExpression(LOWEST).(*ast.CallExpression)
+	if !ok {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d: spawn requires a function call",
+			stmt.Token.Line, stmt.Token.Column))
+		return nil
+	}
+	stmt.Call = call
+
+	if p.PeekToken.Lexeme == ";" {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.CurToken}
+	if !p.expectPeek(token.TokenString) {
+		return nil
+	}
+	stmt.Path = p.CurToken.Lexeme
+	stmt.Name = &ast.Identifier{Token: p.CurToken, Value: ModuleName(stmt.Path)}
+	if p.PeekToken.Lexeme == ";" {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// ModuleName returns the name an import binds: the last element of the
+// path without its extension, so "./lib/util.blue" becomes "util".
+func ModuleName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// parsePublicDeclaration parses a declaration prefixed with `pub`.
+func (p *Parser) parsePublicDeclaration() ast.Statement {
+	pubToken := p.CurToken
+	p.nextToken()
+	switch p.CurToken.Lexeme {
+	case "func":
+		fl := p.parseFunctionDeclaration()
+		if fl == nil {
+			return nil
+		}
+		return &ast.FunctionStatement{Literal: fl, Public: true}
+	case "let":
+		stmt := p.parseLetStatement()
+		if ls, ok := stmt.(*ast.LetStatement); ok {
+			ls.Public = true
+		}
+		return stmt
+	case "const":
+		stmt := p.parseConstStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Public = true
+		return stmt
+	case "type":
+		stmt := p.parseTypeStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Public = true
+		return stmt
+	case "record":
+		stmt := p.parseRecordStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Public = true
+		return stmt
+	case "interface":
+		stmt := p.parseInterfaceStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Public = true
+		return stmt
+	}
+	p.errors = append(p.errors, fmt.Sprintf("line %d:%d: pub must be followed by a declaration, got %q",
+		pubToken.Line, pubToken.Column, p.CurToken.Lexeme))
 	return nil
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+// Attributes lists the attributes a function declaration may carry.
+var Attributes = map[string]bool{
+	"checked": true, // trap on integer overflow
+}
+
+// parseAttributedDeclaration parses attributes such as `@checked`
+// followed by the function declaration they apply to.
+func (p *Parser) parseAttributedDeclaration() ast.Statement {
+	first := p.CurToken
+	var attrs []string
+	for p.CurToken.Type == token.TokenAt {
+		at := p.CurToken
+		if !p.expectPeek(token.TokenIdentifier) {
+			return nil
+		}
+		if !Attributes[p.CurToken.Lexeme] {
+			p.errors = append(p.errors, fmt.Sprintf("line %d:%d: unknown attribute @%s",
+				at.Line, at.Column, p.CurToken.Lexeme))
+			return nil
+		}
+		attrs = append(attrs, p.CurToken.Lexeme)
+		p.nextToken()
+	}
+
+	stmt := p.parseStatement()
+	fs, ok := stmt.(*ast.FunctionStatement)
+	if !ok {
+		if stmt != nil {
+			p.errors = append(p.errors, fmt.Sprintf("line %d:%d: attributes must be followed by a function declaration",
+				first.Line, first.Column))
+		}
+		return nil
+	}
+	fs.Literal.Attributes = attrs
+	return fs
+}
+
+func (p *Parser) parseIfStatement() *ast.IfStatement {
+	stmt := &ast.IfStatement{Token: p.CurToken}
+
 	p.nextToken()
-	name := &ast.Identifier{Value: p.CurToken.Lexeme}
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.TokenLBrace) {
+		return nil
+	}
+	stmt.Consequence = p.parseBlockStatement()
+
+	if p.PeekToken.Lexeme != "else" {
+		return stmt
+	}
+	p.nextToken()
+
+	// `else if` is sugar for an else block holding a single if statement.
+	if p.PeekToken.Lexeme == "if" {
+		p.nextToken()
+		alt := &ast.BlockStatement{Token: p.CurToken}
+		if nested := p.parseIfStatement(); nested != nil {
+			alt.Statements = []ast.Statement{nested}
+		}
+		stmt.Alternative = alt
+		return stmt
+	}
+
+	if !p.expectPeek(token.TokenLBrace) {
+		return nil
+	}
+	stmt.Alternative = p.parseBlockStatement()
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.CurToken}
+
+	if p.PeekToken.Type == token.TokenLParen {
+		p.nextToken()
+		if !p.parseForHeader(stmt) {
+			return nil
+		}
+	} else if p.PeekToken.Type != token.TokenLBrace {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.TokenLBrace) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+// parseForHeader parses the parenthesized header of a for statement,
+// starting at the '('. The header is either `(x in xs)` or a condition
+// that begins with a parenthesized expression.
+func (p *Parser) parseForHeader(stmt *ast.ForStatement) bool {
+	if p.PeekToken.Type != token.TokenIdentifier {
+		stmt.Condition = p.parseExpression(LOWEST)
+		return stmt.Condition != nil
+	}
+	p.nextToken()
+	if p.PeekToken.Type == token.TokenKeyword && p.PeekToken.Lexeme == "in" {
+		stmt.Variable = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+		p.nextToken()
+		p.nextToken()
+		stmt.Iterable = p.parseExpression(LOWEST)
+		return stmt.Iterable != nil && p.expectPeek(token.TokenRParen)
+	}
+
+	// Not a for-in after all: finish the parenthesized expression and
+	// whatever follows it.
+	inner := p.parseExpression(LOWEST)
+	if inner == nil || !p.expectPeek(token.TokenRParen) {
+		return false
+	}
+	stmt.Condition = p.parseInfixes(inner, LOWEST)
+	return stmt.Condition != nil
+}
+
+func (p *Parser) parseLetStatement() ast.Statement {
+	letToken := p.CurToken
+	p.nextToken()
+
+	// An optional type comes before the name: let Integer x = 1;
+	var typ *ast.TypeExpression
+	if p.CurToken.Type == token.TokenLParen || p.PeekToken.Type == token.TokenIdentifier ||
+		p.PeekToken.Type == token.TokenLBracket || p.PeekToken.Type == token.TokenQuestion {
+		if typ = p.parseType(); typ == nil {
+			return nil
+		}
+		p.nextToken()
+	}
+	name := &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+
+	if p.PeekToken.Type == token.TokenComma && typ == nil {
+		if stmt := p.parseDestructureStatement(letToken, name); stmt != nil {
+			return stmt
+		}
+		return nil
+	}
 
 	p.nextToken()
 	p.nextToken()
@@ -119,6 +540,8 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 
 	return &ast.LetStatement{
+		Token: letToken,
+		Type:  typ,
 		Assignment: ast.AssignmentStatement{
 			Name:  name,
 			Value: value,
@@ -126,10 +549,298 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 }
 
+// parseDestructureStatement parses the rest of `let a, b = value;` once
+// the first name has been read.
+func (p *Parser) parseDestructureStatement(letToken token.Token, first *ast.Identifier) *ast.DestructureStatement {
+	stmt := &ast.DestructureStatement{Token: letToken, Names: []*ast.Identifier{first}}
+	for p.PeekToken.Type == token.TokenComma {
+		p.nextToken()
+		if !p.expectPeek(token.TokenIdentifier) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme})
+	}
+
+	if p.PeekToken.Lexeme != "=" {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d: expected = after names, got %q",
+			p.PeekToken.Line, p.PeekToken.Column, p.PeekToken.Lexeme))
+		return nil
+	}
+	p.nextToken()
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.PeekToken.Lexeme == ";" {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	stmt := &ast.ConstStatement{Token: p.CurToken}
+	if !p.expectPeek(token.TokenIdentifier) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+
+	if p.PeekToken.Lexeme != "=" {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d: const %s must be initialized",
+			stmt.Token.Line, stmt.Token.Column, stmt.Name.Value))
+		return nil
+	}
+	p.nextToken()
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.PeekToken.Lexeme == ";" {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseTypeStatement parses `type Name = Type;`, which declares an
+// alias, or `type Name Type;`, which defines a distinct type.
+func (p *Parser) parseTypeStatement() *ast.TypeStatement {
+	stmt := &ast.TypeStatement{Token: p.CurToken}
+	if !p.expectPeek(token.TokenIdentifier) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+
+	if p.PeekToken.Lexeme == "=" {
+		stmt.Alias = true
+		p.nextToken()
+	}
+	p.nextToken()
+	if stmt.Type = p.parseType(); stmt.Type == nil {
+		return nil
+	}
+
+	if p.PeekToken.Lexeme == ";" {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseRecordStatement parses a record declaration: its fields, each a
+// type and a name, and its methods, in any order.
+func (p *Parser) parseRecordStatement() *ast.RecordStatement {
+	stmt := &ast.RecordStatement{Token: p.CurToken}
+	if !p.expectPeek(token.TokenIdentifier) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+	if !p.expectPeek(token.TokenLBrace) {
+		return nil
+	}
+	p.nextToken()
+
+	for p.CurToken.Type != token.TokenRBrace {
+		switch {
+		case p.CurToken.Type == token.TokenEOF:
+			p.peekError(token.TokenRBrace)
+			return nil
+		case p.CurToken.Lexeme == "func":
+			fl := p.parseFunctionDeclaration()
+			if fl == nil {
+				return nil
+			}
+			stmt.Methods = append(stmt.Methods, fl)
+		default:
+			field := &ast.Field{Type: p.parseType()}
+			if field.Type == nil || !p.expectPeek(token.TokenIdentifier) {
+				return nil
+			}
+			field.Name = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+			stmt.Fields = append(stmt.Fields, field)
+			if p.PeekToken.Lexeme == ";" {
+				p.nextToken()
+			}
+		}
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseInterfaceStatement parses an interface declaration, a list of
+// method signatures each ending in a semicolon.
+func (p *Parser) parseInterfaceStatement() *ast.InterfaceStatement {
+	stmt := &ast.InterfaceStatement{Token: p.CurToken}
+	if !p.expectPeek(token.TokenIdentifier) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+	if !p.expectPeek(token.TokenLBrace) {
+		return nil
+	}
+	p.nextToken()
+
+	for p.CurToken.Type != token.TokenRBrace {
+		if p.CurToken.Type == token.TokenEOF {
+			p.peekError(token.TokenRBrace)
+			return nil
+		}
+		fl := &ast.FunctionalLiteral{Token: p.CurToken}
+		if !p.parseSignature(fl) || !p.expectPeek(token.TokenSemicolon) {
+			return nil
+		}
+		stmt.Methods = append(stmt.Methods, fl)
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseSwitchStatement parses a type switch:
+// switch (x) { case T name { ... } default { ... } }.
+func (p *Parser) parseSwitchStatement() *ast.SwitchStatement {
+	stmt := &ast.SwitchStatement{Token: p.CurToken}
+	p.nextToken()
+	stmt.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.TokenLBrace) {
+		return nil
+	}
+	p.nextToken()
+
+	for p.CurToken.Type != token.TokenRBrace {
+		switch p.CurToken.Lexeme {
+		case "case":
+			tc := &ast.TypeCase{Token: p.CurToken}
+			p.nextToken()
+			if tc.Type = p.parseType(); tc.Type == nil {
+				return nil
+			}
+			if p.PeekToken.Type == token.TokenIdentifier {
+				p.nextToken()
+				tc.Name = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+			}
+			if !p.expectPeek(token.TokenLBrace) {
+				return nil
+			}
+			tc.Body = p.parseBlockStatement()
+			stmt.Cases = append(stmt.Cases, tc)
+		case "default":
+			if stmt.Default != nil {
+				p.errors = append(p.errors, fmt.Sprintf("line %d:%d: multiple defaults in switch",
+					p.CurToken.Line, p.CurToken.Column))
+				return nil
+			}
+			if !p.expectPeek(token.TokenLBrace) {
+				return nil
+			}
+			stmt.Default = p.parseBlockStatement()
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("line %d:%d: expected case or default, got %q",
+				p.CurToken.Line, p.CurToken.Column, p.CurToken.Lexeme))
+			return nil
+		}
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseSelectStatement() *ast.SelectStatement {
+	stmt := &ast.SelectStatement{Token: p.CurToken}
+	if !p.expectPeek(token.TokenLBrace) {
+		return nil
+	}
+	p.nextToken()
+
+	for p.CurToken.Type != token.TokenRBrace {
+		switch p.CurToken.Lexeme {
+		case "case":
+			sc := &ast.SelectCase{Token: p.CurToken}
+			p.nextToken()
+			call, ok := p.parseExpression(LOWEST).(*ast.CallExpression)
+			if !ok || (call.Function.String() != "send" && call.Function.String() != "recv") {
+				p.errors = append(p.errors, fmt.Sprintf("line %d:%d: select case must be a send or recv call",
+					sc.Token.Line, sc.Token.Column))
+				return nil
+			}
+			sc.Call = call
+			if p.PeekToken.Type == token.TokenIdentifier {
+				p.nextToken()
+				sc.Name = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+				if sc.IsSend() {
+					p.errors = append(p.errors, fmt.Sprintf("line %d:%d: a send case cannot name a value",
+						sc.Name.Token.Line, sc.Name.Token.Column))
+					return nil
+				}
+			}
+			if !p.expectPeek(token.TokenLBrace) {
+				return nil
+			}
+			sc.Body = p.parseBlockStatement()
+			stmt.Cases = append(stmt.Cases, sc)
+		case "default":
+			if stmt.Default != nil {
+				p.errors = append(p.errors, fmt.Sprintf("line %d:%d: multiple defaults in select",
+					p.CurToken.Line, p.CurToken.Column))
+				return nil
+			}
+			if !p.expectPeek(token.TokenLBrace) {
+				return nil
+			}
+			stmt.Default = p.parseBlockStatement()
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("line %d:%d: expected case or default, got %q",
+				p.CurToken.Line, p.CurToken.Column, p.CurToken.Lexeme))
+			return nil
+		}
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseMacroStatement parses macro name(a, b) { ... }. The parameters
+// are untyped, as they stand for code rather than values.
+func (p *Parser) parseMacroStatement() *ast.MacroStatement {
+	stmt := &ast.MacroStatement{Token: p.CurToken}
+	if !p.expectPeek(token.TokenIdentifier) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+	if !p.expectPeek(token.TokenLParen) {
+		return nil
+	}
+	stmt.Parameters = []*ast.Identifier{}
+	for p.PeekToken.Type != token.TokenRParen {
+		if len(stmt.Parameters) > 0 && !p.expectPeek(token.TokenComma) {
+			return nil
+		}
+		if !p.expectPeek(token.TokenIdentifier) {
+			return nil
+		}
+		stmt.Parameters = append(stmt.Parameters, &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme})
+	}
+	p.nextToken()
+	if !p.expectPeek(token.TokenLBrace) {
+		return nil
+	}
+	// A macro's body runs before the program does, not as part of any
+	// function.
+	outer := p.function
+	p.function = nil
+	stmt.Body = p.parseBlockStatement()
+	p.function = outer
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.CurToken}
+	if p.PeekToken.Lexeme == ";" || p.PeekToken.Type == token.TokenRBrace {
+		p.nextToken()
+		return stmt
+	}
+
 	p.nextToken() // move past 'return'
-	stmt.ReturnValue = p.parseExpression(LOWEST)
+	stmt.ReturnValues = append(stmt.ReturnValues, p.parseExpression(LOWEST))
+	for p.PeekToken.Type == token.TokenComma {
+		p.nextToken()
+		p.nextToken()
+		stmt.ReturnValues = append(stmt.ReturnValues, p.parseExpression(LOWEST))
+	}
 	if p.PeekToken.Lexeme == ";" {
 		p.nextToken()
 	}
@@ -140,45 +851,223 @@ func (p *Parser) parseFunctionDeclaration() *ast.FunctionalLiteral {
 	fl := &ast.FunctionalLiteral{Token: p.CurToken}
 
 	p.nextToken()
-	fl.ReturnType = p.CurToken.Lexeme
-
-	p.nextToken()
-	fl.FunctionName = &ast.Identifier{Value: p.CurToken.Lexeme}
-
-	if !p.expectPeek(token.TokenLParen) {
+	if !p.parseSignature(fl) {
 		return nil
 	}
-	fl.Parameters = p.parseFunctionParameters()
 
 	if !p.expectPeek(token.TokenLBrace) {
 		return nil
 	}
+	outer := p.function
+	p.function = fl
 	fl.Body = p.parseBlockStatement()
+	p.function = outer
 
 	return fl
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseSignature parses the part of a function declaration between
+// `func` and the body into fl, starting at the current token and
+// ending at the ')' closing the parameters.
+func (p *Parser) parseSignature(fl *ast.FunctionalLiteral) bool {
+	// The return type is optional: `func name()` declares a function
+	// that returns nothing.
+	if p.CurToken.Type == token.TokenLParen || !p.atFunctionName() {
+		fl.ReturnType = p.parseType()
+		if fl.ReturnType == nil {
+			return false
+		}
+		p.nextToken()
+	}
+	fl.FunctionName = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+
+	if p.PeekToken.Type == token.TokenLBracket {
+		p.nextToken()
+		fl.TypeParameters = p.parseTypeParameters()
+		if fl.TypeParameters == nil {
+			return false
+		}
+	}
+
+	if !p.expectPeek(token.TokenLParen) {
+		return false
+	}
+	fl.Parameters = p.parseFunctionParameters()
+	return fl.Parameters != nil
+}
+
+// atFunctionName reports whether the current token of a function
+// declaration is its name rather than its return type: a name is
+// followed by the parameter list, possibly after type parameters in
+// brackets, while a return type such as Result[Integer] is followed by
+// the name.
+func (p *Parser) atFunctionName() bool {
+	switch p.PeekToken.Type {
+	case token.TokenLParen:
+		return true
+	case token.TokenLBracket:
+		// Scan a copy of the lexer past the matching ']'.
+		l := *p.L
+		depth := 1
+		for depth > 0 {
+			tok := l.NextToken()
+			switch tok.Type {
+			case token.TokenLBracket:
+				depth++
+			case token.TokenRBracket:
+				depth--
+			case token.TokenEOF:
+				return false
+			}
+		}
+		return l.NextToken().Type == token.TokenLParen
+	}
+	return false
+}
+
+// parseType parses the type starting at the current token: a type name
+// with optional type arguments in brackets, or a parenthesized,
+// comma-separated list of types. Either may be followed by `?` to make
+// it optional.
+func (p *Parser) parseType() *ast.TypeExpression {
+	te := p.parseNonOptionalType()
+	if te != nil && p.PeekToken.Type == token.TokenQuestion {
+		p.nextToken()
+		te.Optional = true
+	}
+	return te
+}
+
+func (p *Parser) parseNonOptionalType() *ast.TypeExpression {
+	te := &ast.TypeExpression{Token: p.CurToken}
+	if p.CurToken.Type != token.TokenLParen {
+		if p.CurToken.Type != token.TokenKeyword && p.CurToken.Type != token.TokenIdentifier {
+			p.errors = append(p.errors, fmt.Sprintf("line %d:%d: expected a type, got %q",
+				p.CurToken.Line, p.CurToken.Column, p.CurToken.Lexeme))
+			return nil
+		}
+		te.Name = p.CurToken.Lexeme
+		if p.PeekToken.Type != token.TokenLBracket {
+			return te
+		}
+		p.nextToken()
+		for {
+			p.nextToken()
+			arg := p.parseType()
+			if arg == nil {
+				return nil
+			}
+			te.Arguments = append(te.Arguments, arg)
+			if p.PeekToken.Type != token.TokenComma {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(token.TokenRBracket) {
+			return nil
+		}
+		return te
+	}
+
+	for {
+		p.nextToken()
+		el := p.parseType()
+		if el == nil {
+			return nil
+		}
+		te.Elements = append(te.Elements, el)
+		if p.PeekToken.Type != token.TokenComma {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(token.TokenRParen) {
+		return nil
+	}
+	return te
+}
+
+// parseTypeParameters parses `[T Integer | String, U]` starting at the
+// '[' token.
+func (p *Parser) parseTypeParameters() []*ast.TypeParameter {
+	params := []*ast.TypeParameter{}
+	for {
+		if !p.expectPeek(token.TokenIdentifier) {
+			return nil
+		}
+		tp := &ast.TypeParameter{Name: &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}}
+
+		if p.PeekToken.Type != token.TokenComma && p.PeekToken.Type != token.TokenRBracket {
+			for {
+				p.nextToken()
+				t := p.parseType()
+				if t == nil {
+					return nil
+				}
+				tp.Constraint = append(tp.Constraint, t)
+				if p.PeekToken.Lexeme != "|" {
+					break
+				}
+				p.nextToken()
+			}
+		}
+		params = append(params, tp)
+
+		if p.PeekToken.Type != token.TokenComma {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.TokenRBracket) {
+		return nil
+	}
+	return params
+}
+
+// parseFunctionParameters parses the parameter list after '('. Each
+// parameter is a name, optionally preceded by its type. The last one may
+// be variadic: ...Integer nums.
+func (p *Parser) parseFunctionParameters() []*ast.Parameter {
+	params := []*ast.Parameter{}
 	p.nextToken()
 	if p.CurToken.Type == token.TokenRParen {
-		return identifiers
+		return params
 	}
 
 	for {
-		ident := &ast.Identifier{Value: p.CurToken.Lexeme}
-		identifiers = append(identifiers, ident)
+		param := &ast.Parameter{}
+		if p.CurToken.Type == token.TokenEllipsis {
+			param.Variadic = true
+			p.nextToken()
+		}
+		if p.CurToken.Type == token.TokenLParen || p.PeekToken.Type == token.TokenIdentifier ||
+			p.PeekToken.Type == token.TokenLBracket || p.PeekToken.Type == token.TokenQuestion {
+			param.Type = p.parseType()
+			if param.Type == nil {
+				return nil
+			}
+			p.nextToken()
+		}
+		param.Name = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+		params = append(params, param)
+
 		if p.PeekToken.Type != token.TokenComma {
 			break
 		}
+		if param.Variadic {
+			p.errors = append(p.errors, fmt.Sprintf("line %d:%d: only the last parameter can be variadic",
+				param.Name.Token.Line, param.Name.Token.Column))
+			return nil
+		}
 		p.nextToken() // ,
-		p.nextToken() // next identifier
+		p.nextToken() // next parameter
 	}
 
 	if !p.expectPeek(token.TokenRParen) {
 		return nil
 	}
-	return identifiers
+	return params
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -203,18 +1092,23 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 		p.nextToken()
 		return true
 	}
+	p.peekError(t)
 	return false
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.CurToken.Type]
 	if prefix == nil {
+		p.noPrefixParseFnError(p.CurToken)
 		return nil
 	}
-	leftExp := prefix()
+	return p.parseInfixes(prefix(), precedence)
+}
 
+// parseInfixes extends leftExp with the infix operators that follow it
+// and bind tighter than precedence.
+func (p *Parser) parseInfixes(leftExp ast.Expression, precedence int) ast.Expression {
 	for p.PeekToken.Lexeme != ";" && precedence < p.peekPrecedence() {
-		// p.PeekToken.PrintToken()
 		infix := p.infixParseFns[p.PeekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -240,7 +1134,7 @@ func (p *Parser) curPrecedence() int {
 }
 
 func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
-	name := &ast.Identifier{Value: p.CurToken.Lexeme}
+	name := &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
 
 	p.nextToken()
 	p.nextToken()
@@ -258,22 +1152,196 @@ func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Value: p.CurToken.Lexeme}
+	return &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.CurToken, Value: p.CurToken.Lexeme}
+}
+
+// parseKeywordExpression handles keywords that may start an expression.
+func (p *Parser) parseKeywordExpression() ast.Expression {
+	switch p.CurToken.Lexeme {
+	case "true", "false":
+		return &ast.Boolean{Token: p.CurToken, Value: p.CurToken.Lexeme == "true"}
+	case "null":
+		return &ast.NullLiteral{Token: p.CurToken}
+	case "Integer", "Int8", "Int16", "Int32", "Int64",
+		"UInt8", "UInt16", "UInt32", "UInt64", "Byte":
+		// A type name used as a function converts its argument.
+		return &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+	case "chan":
+		return p.parseChannelExpression()
+	case "quote":
+		return p.parseQuoteExpression()
+	case "comptime":
+		return p.parseComptimeExpression()
+	}
+	p.noPrefixParseFnError(p.CurToken)
+	return nil
+}
+
+// parseChannelExpression parses chan[T](capacity), with an optional
+// capacity.
+func (p *Parser) parseChannelExpression() ast.Expression {
+	expr := &ast.ChannelExpression{Token: p.CurToken}
+	if expr.Type = p.parseNonOptionalType(); expr.Type == nil {
+		return nil
+	}
+	if !p.expectPeek(token.TokenLParen) {
+		return nil
+	}
+	if p.PeekToken.Type == token.TokenRParen {
+		p.nextToken()
+		return expr
+	}
+	p.nextToken()
+	if expr.Capacity = p.parseExpression(LOWEST); expr.Capacity == nil {
+		return nil
+	}
+	if !p.expectPeek(token.TokenRParen) {
+		return nil
+	}
+	return expr
+}
+
+// parseQuoteExpression parses quote(expression), or quote { ... } to
+// quote statements.
+func (p *Parser) parseQuoteExpression() ast.Expression {
+	expr := &ast.QuoteExpression{Token: p.CurToken}
+	if p.PeekToken.Type == token.TokenLBrace {
+		p.nextToken()
+		expr.Node = p.parseBlockStatement()
+		return expr
+	}
+	if !p.expectPeek(token.TokenLParen) {
+		return nil
+	}
+	p.nextToken()
+	quoted := p.parseExpression(LOWEST)
+	if quoted == nil || !p.expectPeek(token.TokenRParen) {
+		return nil
+	}
+	expr.Node = quoted
+	return expr
+}
+
+// parseComptimeExpression parses comptime { ... }.
+func (p *Parser) parseComptimeExpression() ast.Expression {
+	expr := &ast.ComptimeExpression{Token: p.CurToken}
+	if !p.expectPeek(token.TokenLBrace) {
+		return nil
+	}
+	// The block runs while the program is compiled, not as part of the
+	// function it appears in.
+	outer := p.function
+	p.function = nil
+	expr.Block = p.parseBlockStatement()
+	p.function = outer
+	return expr
+}
+
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	if p.atLambda() {
+		return p.parseLambda()
+	}
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+	if !p.expectPeek(token.TokenRParen) {
+		return nil
+	}
+	return exp
+}
+
+// atLambda reports whether the '(' at the current token opens the
+// parameters of a lambda rather than a parenthesized expression, that
+// is, whether the matching ')' is followed by =>.
+func (p *Parser) atLambda() bool {
+	depth := 1
+	switch p.PeekToken.Type {
+	case token.TokenLParen:
+		depth++
+	case token.TokenRParen:
+		depth--
+	}
+	// Scan a copy of the lexer past the matching ')'.
+	l := *p.L
+	for depth > 0 {
+		switch l.NextToken().Type {
+		case token.TokenLParen:
+			depth++
+		case token.TokenRParen:
+			depth--
+		case token.TokenEOF:
+			return false
+		}
+	}
+	return l.NextToken().Type == token.TokenArrow
+}
+
+// parseLambda parses (params) => body into an anonymous function. The
+// body is either a block or an expression, which the function returns.
+func (p *Parser) parseLambda() ast.Expression {
+	fl := &ast.FunctionalLiteral{Token: p.CurToken, Lambda: true}
+	fl.FunctionName = &ast.Identifier{Token: p.CurToken, Value: "lambda"}
+	if fl.Parameters = p.parseFunctionParameters(); fl.Parameters == nil {
+		return nil
+	}
+	if !p.expectPeek(token.TokenArrow) {
+		return nil
+	}
+	arrow := p.CurToken
+
+	outer := p.function
+	p.function = fl
+	defer func() { p.function = outer }()
+
+	if p.PeekToken.Type == token.TokenLBrace {
+		p.nextToken()
+		fl.Body = p.parseBlockStatement()
+		return fl
+	}
+	p.nextToken()
+	value := p.parseExpression(LOWEST)
+	if value == nil {
+		return nil
+	}
+	fl.Body = &ast.BlockStatement{Token: arrow, Statements: []ast.Statement{
+		&ast.ReturnStatement{Token: arrow, ReturnValues: []ast.Expression{value}},
+	}}
+	return fl
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	lit := &ast.IntegerLiteral{}
-	val, err := strconv.ParseInt(p.CurToken.Lexeme, 10, 64)
+	tok := p.CurToken
+	if digits, ok := strings.CutSuffix(tok.Lexeme, "n"); ok {
+		val, ok := new(big.Int).SetString(digits, 10)
+		if !ok {
+			p.errors = append(p.errors, fmt.Sprintf("line %d:%d: invalid BigInteger literal %s", tok.Line, tok.Column, tok.Lexeme))
+			return nil
+		}
+		return &ast.BigIntegerLiteral{Token: tok, Value: val}
+	}
+
+	val, err := strconv.ParseInt(tok.Lexeme, 10, 64)
 	if err != nil {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d: integer literal %s overflows Integer; use %sn for a BigInteger",
+			tok.Line, tok.Column, tok.Lexeme, tok.Lexeme))
 		return nil
 	}
-	lit.Value = val
-	return lit
+	return &ast.IntegerLiteral{Token: tok, Value: val}
 }
 
+// prefixOperators are the operators that may start an expression.
+var prefixOperators = map[string]bool{"!": true, "-": true, "~": true}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	println("I am here")
+	if !prefixOperators[p.CurToken.Lexeme] {
+		p.noPrefixParseFnError(p.CurToken)
+		return nil
+	}
 	expr := &ast.PrefixExpression{
+		Token:    p.CurToken,
 		Operator: p.CurToken.Lexeme,
 	}
 	p.nextToken()
@@ -283,15 +1351,79 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	exp := &ast.InfixExpression{
+		Token:    p.CurToken,
 		Left:     left,
 		Operator: p.CurToken.Lexeme,
 	}
+	if exp.Operator == "|>" {
+		return p.parsePipeExpression(exp.Token, left)
+	}
 	prec := p.curPrecedence()
+	if exp.Operator == "??" {
+		// a ?? b ?? c groups as a ?? (b ?? c).
+		prec--
+	}
 	p.nextToken()
 	exp.Right = p.parseExpression(prec)
 	return exp
 }
 
+// parsePipeExpression parses the right side of x |> f(y), and returns
+// the call it stands for, f(x, y). A right side that is not a call is
+// called with x alone, so x |> f is f(x).
+func (p *Parser) parsePipeExpression(tok token.Token, left ast.Expression) ast.Expression {
+	p.nextToken()
+	right := p.parseExpression(PIPE)
+	if right == nil {
+		return nil
+	}
+	if call, ok := right.(*ast.CallExpression); ok {
+		call.Arguments = append([]ast.Expression{left}, call.Arguments...)
+		return call
+	}
+	return &ast.CallExpression{Token: tok, Function: right, Arguments: []ast.Expression{left}}
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.CurToken, Function: function}
+	exp.Arguments = p.parseCallArguments()
+	return exp
+}
+
+func (p *Parser) parseCallArguments() []ast.Expression {
+	args := []ast.Expression{}
+	if p.PeekToken.Type == token.TokenRParen {
+		p.nextToken()
+		return args
+	}
+
+	p.nextToken()
+	args = append(args, p.parseExpression(LOWEST))
+	for p.PeekToken.Type == token.TokenComma {
+		p.nextToken() // ,
+		p.nextToken() // next argument
+		args = append(args, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.TokenRParen) {
+		return nil
+	}
+	return args
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.CurToken, Object: object}
+	if !p.expectPeek(token.TokenIdentifier) {
+		return nil
+	}
+	exp.Member = &ast.Identifier{Token: p.CurToken, Value: p.CurToken.Lexeme}
+	return exp
+}
+
+func (p *Parser) parseTryExpression(exp ast.Expression) ast.Expression {
+	return &ast.TryExpression{Token: p.CurToken, Expression: exp}
+}
+
 func (p *Parser) peekTokenIs(t token.TokenType) bool {
 	return p.PeekToken.Type == t
 }
@@ -1 +1,481 @@
 package parser_test
+
+import (
+	"testing"
+
+	"compiler/ast"
+	"compiler/lexer"
+	"compiler/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+func TestFunctionDeclaration(t *testing.T) {
+	program := parse(t, "func Integer add(a, b) { return a + b; }")
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+	}
+	fs, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+	if fs.Literal.ReturnType.String() != "Integer" {
+		t.Errorf("ReturnType = %q; want %q", fs.Literal.ReturnType.String(), "Integer")
+	}
+	if fs.Literal.FunctionName.Value != "add" {
+		t.Errorf("FunctionName = %q; want %q", fs.Literal.FunctionName.Value, "add")
+	}
+	if len(fs.Literal.Parameters) != 2 {
+		t.Errorf("expected 2 parameters, got %d", len(fs.Literal.Parameters))
+	}
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1 + 2 * 3;", "(1 + (2 * 3));"},
+		{"a - b < c;", "((a - b) < c);"},
+		{"f(a + b, 2) == 3;", "(f((a + b), 2) == 3);"},
+		{"-(1 + 2);", "(-(1 + 2));"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMissingParenIsReported(t *testing.T) {
+	p := parser.New(lexer.New("func Integer f( { }"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected a parser error")
+	}
+}
+
+func TestUnterminatedStringIsReported(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"let s = \"abc;\nreturn s;", "line 1:9: unterminated string"},
+		{"import \"util", "line 1:8: unterminated string"},
+	}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.want {
+			t.Errorf("%q: errors = %q; want %q first", tt.input, errs, tt.want)
+		}
+	}
+}
+
+func TestInvalidPrefixOperators(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"let x = *5;", `line 1:9: unexpected "*"`},
+		{"< 5;", `line 1:1: unexpected "<"`},
+		{"r.w = 5;", `line 1:5: unexpected "="`},
+	}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.want {
+			t.Errorf("parse(%q) errors = %q; want %q", tt.input, errs, tt.want)
+		}
+	}
+}
+
+func TestTupleReturnType(t *testing.T) {
+	program := parse(t, "func (Integer, String) pair() { return 1, \"one\"; }")
+	fs := program.Statements[0].(*ast.FunctionStatement)
+	if got := fs.Literal.ReturnType.String(); got != "(Integer, String)" {
+		t.Errorf("ReturnType = %q; want %q", got, "(Integer, String)")
+	}
+	ret := fs.Literal.Body.Statements[0].(*ast.ReturnStatement)
+	if len(ret.ReturnValues) != 2 {
+		t.Errorf("expected 2 return values, got %d", len(ret.ReturnValues))
+	}
+}
+
+func TestDestructuringLet(t *testing.T) {
+	program := parse(t, "let q, r = divmod(7, 2);")
+	ds, ok := program.Statements[0].(*ast.DestructureStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.DestructureStatement. got=%T", program.Statements[0])
+	}
+	if len(ds.Names) != 2 || ds.Names[0].Value != "q" || ds.Names[1].Value != "r" {
+		t.Errorf("unexpected names: %v", ds.Names)
+	}
+}
+
+func TestGenericFunctionDeclaration(t *testing.T) {
+	program := parse(t, "func T max[T Integer | String, U](T a, T b, c) { return a; }")
+	fl := program.Statements[0].(*ast.FunctionStatement).Literal
+	if got, want := fl.String(), "func T max[T Integer | String, U](T a, T b, c) {\nreturn a;\n}"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+	if len(fl.TypeParameters) != 2 || len(fl.TypeParameters[0].Constraint) != 2 {
+		t.Errorf("unexpected type parameters: %v", fl.TypeParameters)
+	}
+	if fl.Parameters[2].Type != nil {
+		t.Errorf("expected c to be untyped")
+	}
+}
+
+func TestResultReturnTypeAndTry(t *testing.T) {
+	program := parse(t, "func Result[Integer] f(s) { return Ok(g(s)? + 1); }")
+	fl := program.Statements[0].(*ast.FunctionStatement).Literal
+	if got := fl.ReturnType.String(); got != "Result[Integer]" {
+		t.Errorf("ReturnType = %q; want %q", got, "Result[Integer]")
+	}
+	if fl.FunctionName.Value != "f" {
+		t.Errorf("FunctionName = %q; want %q", fl.FunctionName.Value, "f")
+	}
+	if got, want := fl.Body.Statements[0].String(), "return Ok((g(s)? + 1));"; got != want {
+		t.Errorf("body = %q; want %q", got, want)
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	program := parse(t, "for (i < 3) { i = i + 1; continue; } for { break; }")
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(program.Statements))
+	}
+	withCond := program.Statements[0].(*ast.ForStatement)
+	if got := withCond.Condition.String(); got != "(i < 3)" {
+		t.Errorf("Condition = %q; want %q", got, "(i < 3)")
+	}
+	if _, ok := withCond.Body.Statements[1].(*ast.BranchStatement); !ok {
+		t.Errorf("expected continue, got %T", withCond.Body.Statements[1])
+	}
+	forever := program.Statements[1].(*ast.ForStatement)
+	if forever.Condition != nil {
+		t.Errorf("expected no condition, got %s", forever.Condition)
+	}
+	if got := forever.String(); got != "for {\nbreak;\n}" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestVariadicParameter(t *testing.T) {
+	program := parse(t, "func Integer sum(String label, ...Integer nums) { return 0; }")
+	fl := program.Statements[0].(*ast.FunctionStatement).Literal
+	if !fl.Variadic() || fl.Parameters[0].Variadic {
+		t.Errorf("expected only the last parameter to be variadic")
+	}
+	if got := fl.Parameters[1].String(); got != "...Integer nums" {
+		t.Errorf("parameter = %q; want %q", got, "...Integer nums")
+	}
+
+	p := parser.New(lexer.New("func f(...a, b) { }"))
+	p.ParseProgram()
+	if errs := p.Errors(); len(errs) == 0 || errs[0] != "line 1:11: only the last parameter can be variadic" {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+func TestCheckedAttribute(t *testing.T) {
+	program := parse(t, "@checked pub func Integer f(n) { return n % 2 * 3; }")
+	fs := program.Statements[0].(*ast.FunctionStatement)
+	if !fs.Public || !fs.Literal.HasAttribute("checked") {
+		t.Errorf("expected a public @checked function, got %s", fs.Literal)
+	}
+	if got, want := fs.Literal.Body.Statements[0].String(), "return ((n % 2) * 3);"; got != want {
+		t.Errorf("body = %q; want %q", got, want)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"@fast func f() { }", "line 1:1: unknown attribute @fast"},
+		{"@checked let x = 1;", "line 1:1: attributes must be followed by a function declaration"},
+	}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.want {
+			t.Errorf("parse(%q) errors = %v; want %q", tt.input, errs, tt.want)
+		}
+	}
+}
+
+func TestBigIntegerLiterals(t *testing.T) {
+	program := parse(t, "let x = 123456789012345678901234567890n + Integer(y);")
+	if got, want := program.String(), "let x = (123456789012345678901234567890n + Integer(y));"; got != want {
+		t.Errorf("parse = %q; want %q", got, want)
+	}
+
+	p := parser.New(lexer.New("9223372036854775808;"))
+	p.ParseProgram()
+	want := "line 1:1: integer literal 9223372036854775808 overflows Integer; use 9223372036854775808n for a BigInteger"
+	if errs := p.Errors(); len(errs) == 0 || errs[0] != want {
+		t.Errorf("errors = %v; want %q", errs, want)
+	}
+}
+
+func TestBitwisePrecedence(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a | b & c;", "(a | (b & c));"},
+		{"a + b << 2;", "(a + (b << 2));"},
+		{"a ^ b == c;", "((a ^ b) == c);"},
+		{"~a & Int32(b);", "((~a) & Int32(b));"},
+		{"let Byte x = Byte(y >> 8);", "let Byte x = Byte((y >> 8));"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNullableSyntax(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"let Integer? x = null;", "let Integer? x = null;"},
+		{"a ?? b + 1;", "(a ?? (b + 1));"},
+		{"a ?? b ?? c;", "(a ?? (b ?? c));"},
+		{"a ?? b == c;", "((a ?? b) == c);"},
+		{"user?.name ?? \"anonymous\";", "(user?.name ?? \"anonymous\");"},
+		{"f()?;", "f()?;"},
+		{"func Result[Integer]? f(String? s, ...Integer? rest) { }", "func Result[Integer]? f(String? s, ...Integer? rest) {\n}"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestTypeStatements(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"type UserID = Integer;", "type UserID = Integer;"},
+		{"type Meters Integer", "type Meters Integer;"},
+		{"pub type Answer Result[Integer]?;", "pub type Answer Result[Integer]?;"},
+		{"type Pair (Integer, String);", "type Pair (Integer, String);"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRecordsAndInterfaces(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"record Point { Integer x; Integer y; }", "record Point { Integer x; Integer y; }"},
+		{"pub record Box { Integer? v; func Integer get() { return self.v ?? 0; } }",
+			"pub record Box { Integer? v; func Integer get() {\nreturn (self.v ?? 0);\n} }"},
+		{"interface Shape { Integer area(); String name(); scale(Integer by); }",
+			"interface Shape { Integer area(); String name(); scale(Integer by); }"},
+		{"switch (s) { case Circle c { 1; } case Rect { 2; } default { 3; } }",
+			"switch (s) { case Circle c {\n1;\n} case Rect {\n2;\n} default {\n3;\n} }"},
+		{"record(1);", "record(1);"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRangesAndForIn(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"0..n + 1;", "(0 .. (n + 1));"},
+		{"a..=b == r;", "((a ..= b) == r);"},
+		{"x ?? 0..10;", "((x ?? 0) .. 10);"},
+		{"for (i in 0..10) { f(i); }", "for (i in (0 .. 10)) {\nf(i);\n}"},
+		{"for (x in xs) { }", "for (x in xs) {\n}"},
+		{"for (i) < 10 { }", "for (i < 10) {\n}"},
+		{"for (i < 10) { }", "for (i < 10) {\n}"},
+		{"for (true) { }", "for true {\n}"},
+		{"func f(...Integer rest) { user?.name; }", "func f(...Integer rest) {\nuser?.name;\n}"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratorFunctions(t *testing.T) {
+	program := parse(t, "func Generator[Integer] count(Integer n) { for (i in 0..n) { yield i * 2; } } func Integer f() { return 1; }")
+	if got, want := program.String(), "func Generator[Integer] count(Integer n) {\nfor (i in (0 .. n)) {\nyield (i * 2);\n}\n}func Integer f() {\nreturn 1;\n}"; got != want {
+		t.Errorf("program = %q; want %q", got, want)
+	}
+	count := program.Statements[0].(*ast.FunctionStatement).Literal
+	f := program.Statements[1].(*ast.FunctionStatement).Literal
+	if !count.Generator || f.Generator {
+		t.Errorf("Generator = %t, %t; want true, false", count.Generator, f.Generator)
+	}
+
+	p := parser.New(lexer.New("func outer() { func inner() { yield 1; } } yield 2;"))
+	program = p.ParseProgram()
+	outer := program.Statements[0].(*ast.FunctionStatement).Literal
+	inner := outer.Body.Statements[0].(*ast.FunctionStatement).Literal
+	if outer.Generator || !inner.Generator {
+		t.Errorf("Generator = %t, %t; want false, true", outer.Generator, inner.Generator)
+	}
+	if errs := p.Errors(); len(errs) != 1 || errs[0] != "line 1:44: yield outside function" {
+		t.Errorf("errors = %q; want the yield outside function", errs)
+	}
+}
+
+func TestConcurrencySyntax(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"spawn fetch(url, 3);", "spawn fetch(url, 3);"},
+		{"let chan[Integer] c = chan[Integer](n + 1);", "let chan[Integer] c = chan[Integer]((n + 1));"},
+		{"let c = chan[String]();", "let c = chan[String]();"},
+		{"func f(chan[Integer] c) { }", "func f(chan[Integer] c) {\n}"},
+		{"select { case recv(c) v { v; } case send(d, 1) { } default { } }",
+			"select { case recv(c) v {\nv;\n} case send(d, 1) {\n} default {\n} }"},
+		{"select { }", "select { }"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errors := []struct {
+		input string
+		want  string
+	}{
+		{"spawn 1;", "line 1:1: spawn requires a function call"},
+		{"select { case f(c) { } }", "line 1:10: select case must be a send or recv call"},
+		{"select { case send(c, 1) v { } }", "line 1:26: a send case cannot name a value"},
+		{"select { default { } default { } }", "line 1:22: multiple defaults in select"},
+	}
+	for _, tt := range errors {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.want {
+			t.Errorf("parse(%q) errors = %q; want %q", tt.input, errs, tt.want)
+		}
+	}
+}
+
+func TestPipelinesAndLambdas(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"xs |> filter(isEven) |> map(double);", "map(filter(xs, isEven), double);"},
+		{"x |> f;", "f(x);"},
+		{"a + 1 |> f(b);", "f((a + 1), b);"},
+		{"a |> f == g;", "(f == g)(a);"},
+		{"let f = (x) => x * 2;", "let f = (x) => (x * 2);"},
+		{"let f = (Integer a, b) => { let c = a; return c + b; };", "let f = (Integer a, b) => {\nlet c = a;\nreturn (c + b);\n};"},
+		{"let f = () => g((x) => x);", "let f = () => g((x) => x);"},
+		{"(a + b) * c;", "((a + b) * c);"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMacroSyntax(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"macro twice(e) { return quote(unquote(e) + unquote(e)); }", "macro twice(e) {\nreturn quote((unquote(e) + unquote(e)));\n}"},
+		{"macro unless(cond, body) { return quote { if (!cond) { unquote(body); } }; }",
+			"macro unless(cond, body) {\nreturn quote {\nif (!cond) {\nunquote(body);\n}\n};\n}"},
+		{"macro answer() { return quote(42); }", "macro answer() {\nreturn quote(42);\n}"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errors := []struct {
+		input string
+		want  string
+	}{
+		{"macro (x) { }", `line 1:7: expected next token to be identifier, got "("`},
+		{"macro m(x y) { }", `line 1:11: expected next token to be ,, got "y"`},
+		{"quote 1;", `line 1:7: expected next token to be (, got "1"`},
+	}
+	for _, tt := range errors {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.want {
+			t.Errorf("parse(%q) errors = %q; want %q", tt.input, errs, tt.want)
+		}
+	}
+}
+
+func TestComptimeSyntax(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"const N = comptime { return fib(20); };", "const N = comptime {\nreturn fib(20);\n};"},
+		{"let s = comptime { 1 + 2; } * 2;", "let s = (comptime {\n(1 + 2);\n} * 2);"},
+		{"func f() { return comptime { }; }", "func f() {\nreturn comptime {\n};\n}"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.want {
+			t.Errorf("parse(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errors := []struct {
+		input string
+		want  string
+	}{
+		{"comptime 1;", `line 1:10: expected next token to be {, got "1"`},
+		{"func g() { let x = comptime { yield 1; }; }", "line 1:31: yield outside function"},
+	}
+	for _, tt := range errors {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != tt.want {
+			t.Errorf("parse(%q) errors = %q; want %q", tt.input, errs, tt.want)
+		}
+	}
+}
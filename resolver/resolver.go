@@ -0,0 +1,298 @@
+// Package resolver binds the identifiers of a Blue program to their
+// declarations, reporting names that cannot be resolved before the
+// program runs.
+package resolver
+
+import (
+	"fmt"
+
+	"compiler/ast"
+	"compiler/token"
+)
+
+// Error is a name resolution error at a position in the source.
+type Error struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Resolve builds the symbol table of program. It reports undefined
+// names, names declared twice in the same scope and names used before
+// the declaration that introduces them.
+func Resolve(program *ast.Program) (*Table, []*Error) {
+	r := &resolver{
+		table: &Table{
+			Defs:   make(map[*ast.Identifier]*Symbol),
+			Uses:   make(map[*ast.Identifier]*Symbol),
+			Scopes: make(map[ast.Node]*Scope),
+		},
+		pending: make(map[*Scope]map[string]int),
+	}
+	r.scope = NewScope(Universe)
+	r.table.Program = r.scope
+	r.table.Scopes[program] = r.scope
+	r.statements(program.Statements)
+	return r.table, r.errors
+}
+
+type resolver struct {
+	table *Table
+	scope *Scope
+
+	// pending counts, per scope being resolved, the declarations that
+	// have not been reached yet.
+	pending map[*Scope]map[string]int
+
+	errors []*Error
+}
+
+func (r *resolver) errorf(tok token.Token, format string, args ...interface{}) {
+	r.errors = append(r.errors, &Error{Line: tok.Line, Column: tok.Column, Msg: fmt.Sprintf(format, args...)})
+}
+
+// statements resolves a list of statements in the current scope.
+// Functions and types are hoisted: their names are declared first, and
+// function bodies resolved last, since they run only once called and
+// may refer to anything the block declares.
+func (r *resolver) statements(stmts []ast.Statement) {
+	pending := make(map[string]int)
+	for _, stmt := range stmts {
+		for _, id := range declaredNames(stmt) {
+			pending[id.Value]++
+		}
+	}
+	r.pending[r.scope] = pending
+	defer delete(r.pending, r.scope)
+
+	var funcs []*ast.FunctionalLiteral
+	var records []*ast.RecordStatement
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.FunctionStatement:
+			r.declare(s.Literal.FunctionName, Func)
+			funcs = append(funcs, s.Literal)
+		case *ast.TypeStatement:
+			r.declare(s.Name, Type)
+		case *ast.RecordStatement:
+			r.declare(s.Name, Type)
+			records = append(records, s)
+		case *ast.InterfaceStatement:
+			r.declare(s.Name, Type)
+		}
+	}
+	for _, stmt := range stmts {
+		r.statement(stmt)
+	}
+	for _, fl := range funcs {
+		r.function(fl, nil)
+	}
+	for _, rs := range records {
+		// In a method, self is the record it was called on.
+		self := &ast.Identifier{Token: rs.Name.Token, Value: "self"}
+		for _, m := range rs.Methods {
+			r.function(m, self)
+		}
+	}
+}
+
+// declaredNames returns the identifiers stmt declares when it runs.
+// Functions and types are not included, as they are declared when the
+// block is entered.
+func declaredNames(stmt ast.Statement) []*ast.Identifier {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		return []*ast.Identifier{s.Assignment.Name}
+	case *ast.ConstStatement:
+		return []*ast.Identifier{s.Name}
+	case *ast.DestructureStatement:
+		return s.Names
+	case *ast.ImportStatement:
+		return []*ast.Identifier{s.Name}
+	}
+	return nil
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.ExpressionStatement:
+		r.expr(s.Expression)
+
+	case *ast.LetStatement:
+		r.expr(s.Assignment.Value)
+		r.declare(s.Assignment.Name, Var)
+
+	case *ast.ConstStatement:
+		r.expr(s.Value)
+		r.declare(s.Name, Const)
+
+	case *ast.DestructureStatement:
+		r.expr(s.Value)
+		for _, name := range s.Names {
+			r.declare(name, Var)
+		}
+
+	case *ast.AssignmentStatement:
+		r.expr(s.Value)
+		r.use(s.Name)
+
+	case *ast.ReturnStatement:
+		for _, rv := range s.ReturnValues {
+			r.expr(rv)
+		}
+
+	case *ast.IfStatement:
+		r.expr(s.Condition)
+		r.block(s.Consequence)
+		if s.Alternative != nil {
+			r.block(s.Alternative)
+		}
+
+	case *ast.ForStatement:
+		if s.Condition != nil {
+			r.expr(s.Condition)
+		}
+		if s.Iterable != nil {
+			// The loop variable has a scope around the body's, so the
+			// body may shadow it.
+			r.expr(s.Iterable)
+			r.scope = NewScope(r.scope)
+			r.table.Scopes[s] = r.scope
+			r.declare(s.Variable, Var)
+			r.block(s.Body)
+			r.scope = r.scope.Parent
+			break
+		}
+		r.block(s.Body)
+
+	case *ast.DeferStatement:
+		r.expr(s.Call)
+
+	case *ast.YieldStatement:
+		r.expr(s.Value)
+
+	case *ast.SpawnStatement:
+		r.expr(s.Call)
+
+	case *ast.ImportStatement:
+		r.declare(s.Name, Import)
+
+	case *ast.SwitchStatement:
+		r.expr(s.Subject)
+		for _, tc := range s.Cases {
+			r.scope = NewScope(r.scope)
+			r.table.Scopes[tc.Body] = r.scope
+			if tc.Name != nil {
+				r.declare(tc.Name, Var)
+			}
+			r.statements(tc.Body.Statements)
+			r.scope = r.scope.Parent
+		}
+		if s.Default != nil {
+			r.block(s.Default)
+		}
+
+	case *ast.SelectStatement:
+		for _, sc := range s.Cases {
+			r.expr(sc.Call)
+		}
+		for _, sc := range s.Cases {
+			r.scope = NewScope(r.scope)
+			r.table.Scopes[sc.Body] = r.scope
+			if sc.Name != nil {
+				r.declare(sc.Name, Var)
+			}
+			r.statements(sc.Body.Statements)
+			r.scope = r.scope.Parent
+		}
+		if s.Default != nil {
+			r.block(s.Default)
+		}
+	}
+}
+
+func (r *resolver) block(b *ast.BlockStatement) {
+	r.scope = NewScope(r.scope)
+	r.table.Scopes[b] = r.scope
+	r.statements(b.Statements)
+	r.scope = r.scope.Parent
+}
+
+// function resolves a function body in a scope of its own that holds
+// the parameters as well as the body's declarations, as a call does.
+// A method also has self, its receiver, in that scope.
+func (r *resolver) function(fl *ast.FunctionalLiteral, self *ast.Identifier) {
+	r.scope = NewScope(r.scope)
+	r.table.Scopes[fl] = r.scope
+	if self != nil {
+		r.declare(self, Param)
+	}
+	for _, p := range fl.Parameters {
+		r.declare(p.Name, Param)
+	}
+	r.statements(fl.Body.Statements)
+	r.scope = r.scope.Parent
+}
+
+func (r *resolver) declare(id *ast.Identifier, kind Kind) {
+	if pending := r.pending[r.scope]; pending[id.Value] > 0 && kind != Func && kind != Param {
+		pending[id.Value]--
+	}
+	if prev, ok := r.scope.Symbols[id.Value]; ok {
+		pos := prev.Pos()
+		r.errorf(id.Token, "%s redeclared in this block (previous declaration at line %d:%d)",
+			id.Value, pos.Line, pos.Column)
+		return
+	}
+	sym := &Symbol{Name: id.Value, Kind: kind, Decl: id, Scope: r.scope}
+	r.scope.Symbols[id.Value] = sym
+	r.table.Defs[id] = sym
+}
+
+func (r *resolver) use(id *ast.Identifier) {
+	if sym := r.scope.Lookup(id.Value); sym != nil {
+		r.table.Uses[id] = sym
+		return
+	}
+	for sc := r.scope; sc != nil; sc = sc.Parent {
+		if r.pending[sc][id.Value] > 0 {
+			r.errorf(id.Token, "%s used before declaration", id.Value)
+			return
+		}
+	}
+	r.errorf(id.Token, "undefined: %s", id.Value)
+}
+
+func (r *resolver) expr(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		r.use(e)
+	case *ast.PrefixExpression:
+		r.expr(e.Right)
+	case *ast.InfixExpression:
+		r.expr(e.Left)
+		r.expr(e.Right)
+	case *ast.CallExpression:
+		r.expr(e.Function)
+		for _, arg := range e.Arguments {
+			r.expr(arg)
+		}
+	case *ast.MemberExpression:
+		// The member is looked up in the module at run time.
+		r.expr(e.Object)
+	case *ast.TryExpression:
+		r.expr(e.Expression)
+	case *ast.ChannelExpression:
+		if e.Capacity != nil {
+			r.expr(e.Capacity)
+		}
+	case *ast.FunctionalLiteral:
+		r.function(e, nil)
+	case *ast.ComptimeExpression:
+		r.block(e.Block)
+	}
+}
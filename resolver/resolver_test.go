@@ -0,0 +1,119 @@
+package resolver_test
+
+import (
+	"testing"
+
+	"compiler/ast"
+	"compiler/lexer"
+	"compiler/parser"
+	"compiler/resolver"
+)
+
+func resolve(t *testing.T, input string) (*ast.Program, *resolver.Table, []*resolver.Error) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	table, errs := resolver.Resolve(program)
+	return program, table, errs
+}
+
+func TestResolvesWellFormedPrograms(t *testing.T) {
+	tests := []string{
+		`func Integer main() { return helper(1); }
+		 func Integer helper(n) { return n + limit; }
+		 let limit = 10;`,
+		`func Integer main() { let x = 1; if (x > 0) { let x = 2; x = 3; } return x; }`,
+		`import "math"; func Integer main() { return math.sqrt(16); }`,
+		`func Integer main() { let r = recover(div(1, 0)); return unwrapOr(r, 0); }`,
+		`func Integer ok() { return 1; } func Integer main() { return ok(); }`,
+		`let m = Meters(1); type Meters Integer;`,
+		`record R { Integer n; func Integer get() { return self.n; } } func f(s) { switch (s) { case R r { r.get(); } } }`,
+		`for (i in 0..3) { let i = i + 1; i; }`,
+		`func g() { yield 1; } let first = next(g()); let all = collect(g());`,
+		`let c = chan[Integer](1); spawn send(c, 1); select { case recv(c) v { v; } } close(c); wait();`,
+		`let k = 2; let scale = (x) => x * k; let r = 0..3 |> filter((n) => n > 0) |> map(scale);`,
+		`func sq(n) { return n * n; } const N = 3; const T = comptime { let t = 0; return sq(N) + t; };`,
+	}
+	for _, input := range tests {
+		if _, _, errs := resolve(t, input); len(errs) > 0 {
+			t.Errorf("Resolve(%q) = %v; want no errors", input, errs)
+		}
+	}
+}
+
+func TestResolutionErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`func Integer main() { return y; }`, "line 1:30: undefined: y"},
+		{`missing = 1;`, "line 1:1: undefined: missing"},
+		{`let x = 1; let x = 2;`, "line 1:16: x redeclared in this block (previous declaration at line 1:5)"},
+		{`func f() { } func f() { }`, "line 1:19: f redeclared in this block (previous declaration at line 1:6)"},
+		{`func f(a, a) { }`, "line 1:11: a redeclared in this block (previous declaration at line 1:8)"},
+		{`let y = x; let x = 1;`, "line 1:9: x used before declaration"},
+		{`let x = x + 1;`, "line 1:9: x used before declaration"},
+		{`if (true) { let z = 1; } z;`, "line 1:26: undefined: z"},
+		{`type T Integer; let T = 1;`, "line 1:21: T redeclared in this block (previous declaration at line 1:6)"},
+		{`func f(s) { switch (s) { case R r { } } r; }`, "line 1:41: undefined: r"},
+		{`func f() { self; }`, "line 1:12: undefined: self"},
+		{`for (i in 0..3) { } i;`, "line 1:21: undefined: i"},
+		{`for (i in i..3) { }`, "line 1:11: undefined: i"},
+		{`let c = chan[Integer](n);`, "line 1:23: undefined: n"},
+		{`select { case recv(c) v { } }`, "line 1:20: undefined: c"},
+		{`let c = 1; select { case recv(c) v { } } v;`, "line 1:42: undefined: v"},
+		{`let f = (x) => x; x;`, "line 1:19: undefined: x"},
+		{`let f = (x) => y; let y = 1;`, "line 1:16: y used before declaration"},
+		{`let f = (a, a) => a;`, "line 1:13: a redeclared in this block (previous declaration at line 1:10)"},
+		{`const T = comptime { return u; };`, "line 1:29: undefined: u"},
+		{`const T = comptime { let t = 1; }; t;`, "line 1:36: undefined: t"},
+	}
+	for _, tt := range tests {
+		_, _, errs := resolve(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("Resolve(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("Resolve(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	program, table, errs := resolve(t, `
+let x = 1;
+func Integer f(n) {
+	let x = n;
+	return x;
+}
+`)
+	if len(errs) > 0 {
+		t.Fatalf("resolve errors: %v", errs)
+	}
+
+	outer := program.Statements[0].(*ast.LetStatement).Assignment.Name
+	fn := program.Statements[1].(*ast.FunctionStatement).Literal
+	inner := fn.Body.Statements[0].(*ast.LetStatement)
+	ret := fn.Body.Statements[1].(*ast.ReturnStatement).ReturnValues[0].(*ast.Identifier)
+	n := inner.Assignment.Value.(*ast.Identifier)
+
+	if sym := table.SymbolOf(outer); sym == nil || sym.Kind != resolver.Var || sym.Scope != table.Program {
+		t.Errorf("outer x = %+v; want a variable in the program scope", sym)
+	}
+	if sym := table.SymbolOf(ret); sym == nil || sym.Decl != inner.Assignment.Name {
+		t.Errorf("returned x resolves to %+v; want the inner declaration", sym)
+	}
+	if sym := table.SymbolOf(n); sym == nil || sym.Kind != resolver.Param || sym.Decl != fn.Parameters[0].Name {
+		t.Errorf("n resolves to %+v; want parameter n", sym)
+	}
+	if scope := table.Scopes[fn]; scope == nil || scope.Parent != table.Program {
+		t.Errorf("function scope %+v is not nested in the program scope", scope)
+	}
+	if sym := table.Program.Lookup("Ok"); sym == nil || sym.Kind != resolver.Builtin {
+		t.Errorf("Ok = %+v; want a builtin", sym)
+	}
+}
@@ -0,0 +1,117 @@
+package resolver
+
+import (
+	"compiler/ast"
+	"compiler/token"
+)
+
+// Kind says what declared a symbol.
+type Kind int
+
+const (
+	Builtin Kind = iota
+	Var
+	Const
+	Func
+	Param
+	Import
+	Type
+)
+
+var kindNames = map[Kind]string{
+	Builtin: "builtin",
+	Var:     "variable",
+	Const:   "constant",
+	Func:    "function",
+	Param:   "parameter",
+	Import:  "module",
+	Type:    "type",
+}
+
+func (k Kind) String() string { return kindNames[k] }
+
+// Symbol is a declared name. Decl is the identifier that declared it,
+// nil for builtins.
+type Symbol struct {
+	Name  string
+	Kind  Kind
+	Decl  *ast.Identifier
+	Scope *Scope
+}
+
+// Pos returns the position of the symbol's declaration.
+func (s *Symbol) Pos() token.Token {
+	if s.Decl == nil {
+		return token.Token{}
+	}
+	return s.Decl.Token
+}
+
+// Scope is a lexical scope. Scopes nest the way the evaluator's
+// environments do: one per program, one per function holding its
+// parameters and body, and one per nested block.
+type Scope struct {
+	Parent   *Scope
+	Children []*Scope
+	Symbols  map[string]*Symbol
+}
+
+func NewScope(parent *Scope) *Scope {
+	s := &Scope{Parent: parent, Symbols: make(map[string]*Symbol)}
+	if parent != nil {
+		parent.Children = append(parent.Children, s)
+	}
+	return s
+}
+
+// Lookup finds name in s or the scopes enclosing it.
+func (s *Scope) Lookup(name string) *Symbol {
+	for sc := s; sc != nil; sc = sc.Parent {
+		if sym, ok := sc.Symbols[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// Universe is the outermost scope, holding the builtin functions.
+var Universe = newUniverse()
+
+func newUniverse() *Scope {
+	s := NewScope(nil)
+	for _, name := range []string{
+		"Ok", "Err", "isOk", "isErr", "unwrap", "unwrapOr", "message",
+		"panic", "recover", "len", "at", "div", "next", "collect", "map", "filter",
+		"send", "recv", "close", "wait",
+		"wrapping_add", "wrapping_sub", "wrapping_mul",
+		"Integer", "BigInteger",
+		"Int8", "Int16", "Int32", "Int64", "UInt8", "UInt16", "UInt32", "UInt64", "Byte",
+	} {
+		s.Symbols[name] = &Symbol{Name: name, Kind: Builtin, Scope: s}
+	}
+	return s
+}
+
+// Table is the symbol table built by Resolve.
+type Table struct {
+	// Program is the scope of the program's top-level declarations.
+	Program *Scope
+
+	// Defs maps each declaring identifier to the symbol it declares.
+	Defs map[*ast.Identifier]*Symbol
+
+	// Uses maps each identifier that refers to a declaration to its
+	// symbol. Identifiers that could not be resolved are absent.
+	Uses map[*ast.Identifier]*Symbol
+
+	// Scopes maps functions and blocks to the scopes they open.
+	Scopes map[ast.Node]*Scope
+}
+
+// SymbolOf returns the symbol id declares or refers to, or nil.
+func (t *Table) SymbolOf(id *ast.Identifier) *Symbol {
+	if sym, ok := t.Defs[id]; ok {
+		return sym
+	}
+	return t.Uses[id]
+}
@@ -19,8 +19,49 @@ const (
 	TokenRBrace
 	TokenSemicolon
 	TokenComma
+	TokenString
+	TokenDot
+	TokenLBracket
+	TokenRBracket
+	TokenQuestion
+	TokenEllipsis
+	TokenAt
+	TokenArrow
+	// TokenIllegal is a string literal that runs to the end of the
+	// input, which the parser reports at its opening quote.
+	TokenIllegal
 )
 
+var tokenNames = map[TokenType]string{
+	TokenEOF:        "EOF",
+	TokenIdentifier: "identifier",
+	TokenNumber:     "number",
+	TokenOperator:   "operator",
+	TokenKeyword:    "keyword",
+	TokenLParen:     "(",
+	TokenRParen:     ")",
+	TokenLBrace:     "{",
+	TokenRBrace:     "}",
+	TokenSemicolon:  ";",
+	TokenComma:      ",",
+	TokenString:     "string",
+	TokenDot:        ".",
+	TokenLBracket:   "[",
+	TokenRBracket:   "]",
+	TokenQuestion:   "?",
+	TokenEllipsis:   "...",
+	TokenAt:         "@",
+	TokenArrow:      "=>",
+	TokenIllegal:    "illegal",
+}
+
+func (t TokenType) String() string {
+	if name, ok := tokenNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
 type Token struct {
 	Type   TokenType `json:"tokentype"`
 	Lexeme string    `json:"lexeme"`
@@ -0,0 +1,1374 @@
+package types
+
+import (
+	"fmt"
+
+	"compiler/ast"
+	"compiler/token"
+)
+
+// Error is a type error at a position in the source.
+type Error struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Info holds the results of checking a program.
+type Info struct {
+	// Types maps every expression of the program to its inferred type.
+	Types map[ast.Expression]Type
+	// Scope holds the program's top-level declarations.
+	Scope *Scope
+}
+
+func NewInfo() *Info {
+	return &Info{Types: make(map[ast.Expression]Type)}
+}
+
+// TypeOf returns the type inferred for e, or nil if e was not checked.
+func (info *Info) TypeOf(e ast.Expression) Type {
+	return info.Types[e]
+}
+
+// Importer returns the types of the members that the module an import
+// statement names by path exports, or nil if they are not known.
+type Importer func(path string) map[string]Type
+
+// Check type checks program and returns the errors found, in the order
+// they appear in the source. If info is not nil, the type of every
+// expression is recorded in it. The members of imported modules are not
+// checked.
+func Check(program *ast.Program, info *Info) []*Error {
+	return CheckImports(program, info, nil)
+}
+
+// CheckImports is Check for a program whose imports importer gives the
+// members of, so that their use is checked too.
+func CheckImports(program *ast.Program, info *Info, importer Importer) []*Error {
+	c := &checker{scope: NewScope(Universe), info: info, importer: importer}
+	if info != nil {
+		info.Scope = c.scope
+	}
+	c.statements(program.Statements)
+	return c.errors
+}
+
+type checker struct {
+	info       *Info
+	importer   Importer
+	scope      *Scope
+	typeParams map[string]*TypeParam // of the function being checked
+	fn         *Signature            // the function being checked, nil at top level
+	fnName     string
+	generator  bool            // whether the function being checked is a generator
+	captured   map[string]bool // names the functions declared in it refer to
+	errors     []*Error
+}
+
+func (c *checker) errorf(tok token.Token, format string, args ...interface{}) {
+	c.errors = append(c.errors, &Error{Line: tok.Line, Column: tok.Column, Msg: fmt.Sprintf(format, args...)})
+}
+
+// declareLocal declares a variable of the function being checked.
+func (c *checker) declareLocal(name string, t Type) {
+	c.scope.Declare(&Var{Name: name, Type: t, owner: c.fn})
+}
+
+func (c *checker) openScope()  { c.scope = NewScope(c.scope) }
+func (c *checker) closeScope() { c.scope = c.scope.parent }
+
+func (c *checker) statements(stmts []ast.Statement) {
+	// Types and functions are hoisted, so every type and signature is
+	// known before any statement of the block is checked. Records and
+	// interfaces are declared before their members are resolved, so
+	// they may refer to each other; a type declared with a type
+	// statement may only refer to the types declared before it.
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.RecordStatement:
+			c.scope.Declare(&Var{Name: s.Name.Value, Type: &Record{Name: s.Name.Value}, IsType: true})
+		case *ast.InterfaceStatement:
+			c.scope.Declare(&Var{Name: s.Name.Value, Type: &Interface{Name: s.Name.Value}, IsType: true})
+		}
+	}
+	for _, stmt := range stmts {
+		if ts, ok := stmt.(*ast.TypeStatement); ok {
+			c.typeDecl(ts)
+		}
+	}
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.RecordStatement:
+			c.recordDecl(s)
+		case *ast.InterfaceStatement:
+			c.interfaceDecl(s)
+		}
+	}
+	for _, stmt := range stmts {
+		if fs, ok := stmt.(*ast.FunctionStatement); ok {
+			c.scope.Declare(&Var{Name: fs.Literal.FunctionName.Value, Type: c.signature(fs.Literal)})
+		}
+	}
+	for _, stmt := range stmts {
+		c.statement(stmt)
+	}
+}
+
+func (c *checker) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.ExpressionStatement:
+		c.expr(s.Expression)
+
+	case *ast.LetStatement:
+		c.let(s)
+
+	case *ast.ConstStatement:
+		c.scope.Declare(&Var{Name: s.Name.Value, Type: c.expr(s.Value), Const: true})
+
+	case *ast.DestructureStatement:
+		c.destructure(s)
+
+	case *ast.AssignmentStatement:
+		c.assignment(s)
+
+	case *ast.FunctionStatement:
+		sig, ok := c.scope.Lookup(s.Literal.FunctionName.Value).Type.(*Signature)
+		if !ok {
+			sig = c.signature(s.Literal)
+		}
+		c.functionBody(s.Literal, sig, nil)
+
+	case *ast.RecordStatement:
+		if rec, ok := c.scope.Lookup(s.Name.Value).Type.(*Record); ok {
+			for _, m := range s.Methods {
+				sig, ok := rec.Methods[m.FunctionName.Value]
+				if !ok {
+					sig = c.signature(m)
+				}
+				c.functionBody(m, sig, rec)
+			}
+		}
+
+	case *ast.SwitchStatement:
+		c.switchStatement(s)
+
+	case *ast.ReturnStatement:
+		c.returnStatement(s)
+
+	case *ast.IfStatement:
+		c.ifStatement(s)
+
+	case *ast.ForStatement:
+		if s.Iterable != nil {
+			c.forIn(s)
+			break
+		}
+		// The condition and body run again after the body has run, so
+		// they cannot rely on a narrowing the body may undo.
+		c.unnarrowAssigned(s.Body)
+		if s.Condition != nil {
+			c.condition(s.Condition, "for statement")
+		}
+		c.block(s.Body)
+
+	case *ast.DeferStatement:
+		c.expr(s.Call)
+
+	case *ast.YieldStatement:
+		c.yieldStatement(s)
+
+	case *ast.SpawnStatement:
+		c.expr(s.Call)
+
+	case *ast.SelectStatement:
+		c.selectStatement(s)
+
+	case *ast.ImportStatement:
+		mod := &Module{Name: s.Name.Value}
+		if c.importer != nil {
+			mod.Members = c.importer(s.Path)
+		}
+		c.scope.Declare(&Var{Name: s.Name.Value, Type: mod})
+	}
+}
+
+// typeDecl declares the type name of s: an alias stands for the type it
+// names, while any other declaration defines a new type.
+func (c *checker) typeDecl(s *ast.TypeStatement) {
+	t := c.resolve(s.Type)
+	if !s.Alias && t != Unknown {
+		t = &Named{Name: s.Name.Value, Underlying: Underlying(t)}
+	}
+	c.scope.Declare(&Var{Name: s.Name.Value, Type: t, IsType: true})
+}
+
+// recordDecl fills in the fields and method signatures of the record s
+// declares.
+func (c *checker) recordDecl(s *ast.RecordStatement) {
+	rec, ok := c.scope.Lookup(s.Name.Value).Type.(*Record)
+	if !ok {
+		return // redeclared, reported by name resolution
+	}
+	rec.Methods = make(map[string]*Signature)
+	for _, f := range s.Fields {
+		if rec.Field(f.Name.Value) != nil {
+			c.errorf(f.Name.Token, "%s redeclared in record %s", f.Name.Value, rec.Name)
+			continue
+		}
+		rec.Fields = append(rec.Fields, &Var{Name: f.Name.Value, Type: c.resolve(f.Type)})
+	}
+	for _, m := range s.Methods {
+		name := m.FunctionName
+		if _, dup := rec.Methods[name.Value]; dup || rec.Field(name.Value) != nil {
+			c.errorf(name.Token, "%s redeclared in record %s", name.Value, rec.Name)
+			continue
+		}
+		rec.Methods[name.Value] = c.signature(m)
+	}
+}
+
+// interfaceDecl fills in the method signatures of the interface s
+// declares.
+func (c *checker) interfaceDecl(s *ast.InterfaceStatement) {
+	iface, ok := c.scope.Lookup(s.Name.Value).Type.(*Interface)
+	if !ok {
+		return // redeclared, reported by name resolution
+	}
+	iface.Methods = make(map[string]*Signature)
+	for _, m := range s.Methods {
+		name := m.FunctionName
+		if _, dup := iface.Methods[name.Value]; dup {
+			c.errorf(name.Token, "%s redeclared in interface %s", name.Value, iface.Name)
+			continue
+		}
+		iface.Methods[name.Value] = c.signature(m)
+	}
+}
+
+// switchStatement checks a type switch. The subject must be an
+// interface, and each case a type that could implement it. In a case,
+// the name the case declares has the case's type.
+func (c *checker) switchStatement(s *ast.SwitchStatement) {
+	subject := c.expr(s.Subject)
+	iface, isIface := NonNull(subject).(*Interface)
+	if !isIface && subject != Unknown {
+		c.errorf(position(s.Subject), "%s (type %s) is not an interface", s.Subject, subject)
+	}
+
+	for _, tc := range s.Cases {
+		t := c.resolve(tc.Type)
+		if _, ok := t.(*Interface); isIface && !ok && t != Unknown {
+			if missing := MissingMethod(t, iface); missing != "" {
+				c.errorf(tc.Type.Token, "impossible type switch case: %s (type %s) cannot have type %s (%s)",
+					s.Subject, subject, t, missing)
+			}
+		}
+		c.openScope()
+		if tc.Name != nil {
+			c.declareLocal(tc.Name.Value, t)
+		}
+		c.statements(tc.Body.Statements)
+		c.closeScope()
+	}
+	if s.Default != nil {
+		c.block(s.Default)
+	}
+}
+
+// forIn checks a for-in loop. The loop variable has the element type of
+// the iterable, in a scope around the body's.
+func (c *checker) forIn(s *ast.ForStatement) {
+	t := c.nonNull(s.Iterable, c.expr(s.Iterable))
+	var elem Type = Unknown
+	if t != Unknown {
+		if elem = ElementType(t); elem == nil {
+			c.errorf(position(s.Iterable), "cannot range over %s (type %s)", s.Iterable, t)
+			elem = Unknown
+		}
+	}
+	c.unnarrowAssigned(s.Body)
+	c.openScope()
+	c.declareLocal(s.Variable.Value, elem)
+	c.block(s.Body)
+	c.closeScope()
+}
+
+// selectStatement checks the send and recv calls of a select statement
+// like any other calls. The name a recv case binds has the type recv
+// returns, which is an Err once the channel is closed.
+func (c *checker) selectStatement(s *ast.SelectStatement) {
+	for _, sc := range s.Cases {
+		t := c.expr(sc.Call)
+		c.openScope()
+		if sc.Name != nil {
+			c.declareLocal(sc.Name.Value, t)
+		}
+		c.statements(sc.Body.Statements)
+		c.closeScope()
+	}
+	if s.Default != nil {
+		c.block(s.Default)
+	}
+}
+
+func (c *checker) block(b *ast.BlockStatement) {
+	c.openScope()
+	c.statements(b.Statements)
+	c.closeScope()
+}
+
+// ifStatement checks an if statement. A condition comparing an optional
+// variable with null narrows the variable's type to its non-null values
+// in the branch where it cannot be null, and in the rest of the
+// enclosing block if the other branch always leaves it, until the
+// variable is next assigned.
+func (c *checker) ifStatement(s *ast.IfStatement) {
+	c.condition(s.Condition, "if statement")
+	v, nonNullWhenTrue := c.nullTest(s.Condition)
+
+	c.narrowedBlock(s.Consequence, v, nonNullWhenTrue)
+	if s.Alternative != nil {
+		c.narrowedBlock(s.Alternative, v, !nonNullWhenTrue)
+	}
+
+	if v == nil {
+		return
+	}
+	if (!nonNullWhenTrue && terminates(s.Consequence)) ||
+		(nonNullWhenTrue && s.Alternative != nil && terminates(s.Alternative)) {
+		c.scope.Declare(nonNullVar(v))
+	}
+}
+
+func (c *checker) narrowedBlock(b *ast.BlockStatement, v *Var, narrow bool) {
+	c.openScope()
+	if v != nil && narrow {
+		c.scope.Declare(nonNullVar(v))
+	}
+	c.statements(b.Statements)
+	c.closeScope()
+}
+
+// nullTest recognizes a condition such as x != null or null == x that
+// compares an optional variable with null. It returns the variable,
+// or nil, and whether the condition holds when it is not null.
+func (c *checker) nullTest(cond ast.Expression) (*Var, bool) {
+	e, ok := cond.(*ast.InfixExpression)
+	if !ok || (e.Operator != "==" && e.Operator != "!=") {
+		return nil, false
+	}
+	operand := e.Left
+	if _, ok := operand.(*ast.NullLiteral); ok {
+		operand = e.Right
+	} else if _, ok := e.Right.(*ast.NullLiteral); !ok {
+		return nil, false
+	}
+	ident, ok := operand.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	v := c.scope.Lookup(ident.Value)
+	if v == nil || !c.narrowable(v) {
+		return nil, false
+	}
+	if _, ok := v.Type.(*Optional); !ok {
+		return nil, false
+	}
+	return v, e.Operator == "!="
+}
+
+// narrowable reports whether v may be narrowed, which is only sound if
+// nothing but the statements being checked can assign it: if it is a
+// constant, or a variable of the function being checked that no
+// function declared in it refers to. Variables of the program and of
+// enclosing functions may be assigned by any call.
+func (c *checker) narrowable(v *Var) bool {
+	if v.Const {
+		return true
+	}
+	return v.owner != nil && v.owner == c.fn && !c.captured[v.Name]
+}
+
+// nonNullVar returns v with its type narrowed to the non-null values.
+func nonNullVar(v *Var) *Var {
+	decl := v
+	if v.narrows != nil {
+		decl = v.narrows
+	}
+	return &Var{Name: v.Name, Type: NonNull(v.Type), Const: v.Const, owner: v.owner, narrows: decl}
+}
+
+// unnarrow ends the narrowing of v, if v is narrowed.
+func unnarrow(v *Var) {
+	if v != nil && v.narrows != nil {
+		v.Type = v.narrows.Type
+	}
+}
+
+// unnarrowAssigned ends the narrowing of the variables that body
+// assigns.
+func (c *checker) unnarrowAssigned(body *ast.BlockStatement) {
+	ast.Modify(body, func(n ast.Node) ast.Node {
+		if s, ok := n.(*ast.AssignmentStatement); ok {
+			unnarrow(c.scope.Lookup(s.Name.Value))
+		}
+		return n
+	})
+}
+
+// capturedNames returns the names that the functions declared anywhere
+// in body refer to.
+func capturedNames(body *ast.BlockStatement) map[string]bool {
+	names := make(map[string]bool)
+	ast.Modify(body, func(n ast.Node) ast.Node {
+		if fl, ok := n.(*ast.FunctionalLiteral); ok {
+			ast.Modify(fl.Body, func(n ast.Node) ast.Node {
+				if id, ok := n.(*ast.Identifier); ok {
+					names[id.Value] = true
+				}
+				return n
+			})
+		}
+		return n
+	})
+	return names
+}
+
+// terminates reports whether b always leaves the enclosing block, by
+// returning, breaking out of a loop or panicking.
+func terminates(b *ast.BlockStatement) bool {
+	if len(b.Statements) == 0 {
+		return false
+	}
+	switch last := b.Statements[len(b.Statements)-1].(type) {
+	case *ast.ReturnStatement, *ast.BranchStatement:
+		return true
+	case *ast.ExpressionStatement:
+		call, ok := last.Expression.(*ast.CallExpression)
+		if !ok {
+			return false
+		}
+		ident, ok := call.Function.(*ast.Identifier)
+		return ok && ident.Value == "panic"
+	}
+	return false
+}
+
+func (c *checker) let(s *ast.LetStatement) {
+	name := s.Assignment.Name
+	if s.Type == nil {
+		// Without an annotation the variable takes the type of its
+		// initializer.
+		typ := c.expr(s.Assignment.Value)
+		if typ == Null {
+			c.errorf(name.Token, "cannot infer the type of %s from null; declare it with an optional type", name.Value)
+			typ = Unknown
+		}
+		c.declareLocal(name.Value, typ)
+		return
+	}
+
+	typ := c.resolve(s.Type)
+	value := c.exprWith(s.Assignment.Value, typ)
+	if !AssignableTo(value, typ) {
+		c.errorf(name.Token, "cannot use %s (type %s) as %s in let %s",
+			s.Assignment.Value, value, typ, name.Value)
+	}
+	c.declareLocal(name.Value, typ)
+}
+
+func (c *checker) destructure(s *ast.DestructureStatement) {
+	value := c.expr(s.Value)
+	types := make([]Type, len(s.Names))
+	for i := range types {
+		types[i] = Unknown
+	}
+
+	switch v := value.(type) {
+	case *Tuple:
+		if len(v.Elements) != len(s.Names) {
+			c.errorf(s.Token, "assignment mismatch: %d names but %s returns %d values",
+				len(s.Names), s.Value, len(v.Elements))
+		} else {
+			types = v.Elements
+		}
+	default:
+		if value != Unknown {
+			c.errorf(s.Token, "assignment mismatch: %d names but 1 value", len(s.Names))
+		}
+	}
+
+	for i, name := range s.Names {
+		c.declareLocal(name.Value, types[i])
+	}
+}
+
+func (c *checker) assignment(s *ast.AssignmentStatement) {
+	v := c.scope.Lookup(s.Name.Value)
+	if v == nil {
+		c.expr(s.Value)
+		return // reported by name resolution
+	}
+	// A narrowed variable may be assigned any value of its declared
+	// type, which ends the narrowing.
+	declared := v
+	if v.narrows != nil {
+		declared = v.narrows
+	}
+	value := c.exprWith(s.Value, declared.Type)
+	if v.Const {
+		c.errorf(s.Name.Token, "cannot assign to constant %s", s.Name.Value)
+		return
+	}
+	unnarrow(v)
+	if !AssignableTo(value, declared.Type) {
+		c.errorf(s.Name.Token, "cannot use %s (type %s) as %s in assignment to %s",
+			s.Value, value, declared.Type, s.Name.Value)
+	}
+}
+
+func (c *checker) returnStatement(s *ast.ReturnStatement) {
+	if c.generator {
+		// return only ends a generator; its values are yielded.
+		for _, rv := range s.ReturnValues {
+			c.expr(rv)
+		}
+		if len(s.ReturnValues) > 0 {
+			c.errorf(s.Token, "generator %s cannot return a value", c.fnName)
+		}
+		return
+	}
+	var want Type
+	if c.fn != nil {
+		want = c.fn.Result
+	}
+	values := make([]Type, len(s.ReturnValues))
+	for i, rv := range s.ReturnValues {
+		values[i] = c.exprWith(rv, expectedElement(want, i, len(values)))
+	}
+	if want == nil {
+		return
+	}
+
+	switch len(values) {
+	case 0:
+		c.errorf(s.Token, "missing return value: %s returns %s", c.fnName, want)
+	case 1:
+		if !AssignableTo(values[0], want) {
+			c.errorf(s.Token, "cannot use %s (type %s) as %s in return from %s",
+				s.ReturnValues[0], values[0], want, c.fnName)
+		}
+	default:
+		got := &Tuple{Elements: values}
+		if !AssignableTo(got, want) {
+			c.errorf(s.Token, "cannot use %s as %s in return from %s", got, want, c.fnName)
+		}
+	}
+}
+
+// yieldStatement checks that the value yielded has the element type of
+// the generator.
+func (c *checker) yieldStatement(s *ast.YieldStatement) {
+	var want Type
+	if c.fn != nil {
+		if g, ok := c.fn.Result.(*Generator); ok {
+			want = g.Elem
+		}
+	}
+	got := c.exprWith(s.Value, want)
+	if want != nil && !AssignableTo(got, want) {
+		c.errorf(position(s.Value), "cannot use %s (type %s) as %s in yield from %s", s.Value, got, want, c.fnName)
+	}
+}
+
+func (c *checker) condition(e ast.Expression, context string) {
+	if t := c.expr(e); t != Unknown && Underlying(t) != Boolean {
+		c.errorf(position(e), "non-boolean condition in %s (type %s)", context, t)
+	}
+}
+
+// signature computes the type of a function declaration.
+func (c *checker) signature(fl *ast.FunctionalLiteral) *Signature {
+	saved := c.typeParams
+	defer func() { c.typeParams = saved }()
+
+	sig := &Signature{}
+	c.typeParams = c.declareTypeParams(fl, sig)
+	for _, p := range fl.Parameters {
+		sig.Params = append(sig.Params, c.paramType(p))
+	}
+	sig.Variadic = fl.Variadic()
+	if fl.ReturnType != nil {
+		sig.Result = c.resolve(fl.ReturnType)
+	} else if fl.Generator {
+		sig.Result = &Generator{Elem: Unknown}
+	}
+	return sig
+}
+
+func (c *checker) declareTypeParams(fl *ast.FunctionalLiteral, sig *Signature) map[string]*TypeParam {
+	params := make(map[string]*TypeParam)
+	for name, tp := range c.typeParams {
+		params[name] = tp
+	}
+	for _, tp := range fl.TypeParameters {
+		param := &TypeParam{Name: tp.Name.Value}
+		params[param.Name] = param
+		sig.TypeParams = append(sig.TypeParams, param)
+	}
+	// Constraints may only mention concrete types, so they are resolved
+	// once all the parameters are known.
+	c.typeParams = params
+	for i, tp := range fl.TypeParameters {
+		for _, t := range tp.Constraint {
+			sig.TypeParams[i].Constraint = append(sig.TypeParams[i].Constraint, c.resolve(t))
+		}
+	}
+	return params
+}
+
+func (c *checker) paramType(p *ast.Parameter) Type {
+	if p.Type == nil {
+		return Unknown
+	}
+	return c.resolve(p.Type)
+}
+
+// functionBody checks the body of fl, whose signature is sig. For a
+// method, self is the record it is called on.
+func (c *checker) functionBody(fl *ast.FunctionalLiteral, sig *Signature, self *Record) {
+	savedParams, savedFn, savedName, savedGenerator, savedCaptured := c.typeParams, c.fn, c.fnName, c.generator, c.captured
+	defer func() {
+		c.typeParams, c.fn, c.fnName, c.generator, c.captured = savedParams, savedFn, savedName, savedGenerator, savedCaptured
+	}()
+
+	c.fn, c.fnName, c.generator = sig, fl.FunctionName.Value, fl.Generator
+	c.captured = capturedNames(fl.Body)
+	if _, ok := sig.Result.(*Generator); fl.Generator && sig.Result != nil && !ok && sig.Result != Unknown {
+		c.errorf(fl.ReturnType.Token, "generator %s must return Generator[T], not %s", fl.FunctionName.Value, sig.Result)
+	}
+	c.typeParams = make(map[string]*TypeParam)
+	for name, tp := range savedParams {
+		c.typeParams[name] = tp
+	}
+	for _, tp := range sig.TypeParams {
+		c.typeParams[tp.Name] = tp
+	}
+
+	c.openScope()
+	if self != nil {
+		c.scope.Declare(&Var{Name: "self", Type: self})
+	}
+	for i, p := range fl.Parameters {
+		typ := sig.Params[i]
+		if p.Variadic {
+			// The arguments are collected into a tuple whose length is
+			// only known at run time.
+			typ = Unknown
+		}
+		c.declareLocal(p.Name.Value, typ)
+	}
+	c.statements(fl.Body.Statements)
+	c.closeScope()
+}
+
+// resolve turns a type written in the source into a Type.
+func (c *checker) resolve(te *ast.TypeExpression) Type {
+	if te.Optional {
+		plain := *te
+		plain.Optional = false
+		return NewOptional(c.resolve(&plain))
+	}
+	if te.Name == "" {
+		tuple := &Tuple{}
+		for _, el := range te.Elements {
+			tuple.Elements = append(tuple.Elements, c.resolve(el))
+		}
+		return tuple
+	}
+
+	if te.Name == "Result" || te.Name == "Generator" || te.Name == "chan" {
+		if len(te.Arguments) != 1 {
+			c.errorf(te.Token, "%s expects 1 type argument, got %d", te.Name, len(te.Arguments))
+			return Unknown
+		}
+		arg := c.resolve(te.Arguments[0])
+		switch te.Name {
+		case "Generator":
+			return &Generator{Elem: arg}
+		case "chan":
+			return &Channel{Elem: arg}
+		}
+		return &Result{Value: arg}
+	}
+	if len(te.Arguments) > 0 {
+		c.errorf(te.Token, "%s does not take type arguments", te.Name)
+		return Unknown
+	}
+
+	if t, ok := predeclared[te.Name]; ok {
+		return t
+	}
+	if tp, ok := c.typeParams[te.Name]; ok {
+		return tp
+	}
+	if v := c.scope.Lookup(te.Name); v != nil && v.IsType {
+		return v.Type
+	}
+	c.errorf(te.Token, "undefined type %s", te.Name)
+	return Unknown
+}
+
+// expectedElement is the type expected of value i of n returned
+// together where want is expected of them all.
+func expectedElement(want Type, i, n int) Type {
+	if n == 1 {
+		return want
+	}
+	if t, ok := want.(*Tuple); ok && len(t.Elements) == n {
+		return t.Elements[i]
+	}
+	return nil
+}
+
+// expr computes the type of e, reporting any type errors inside it.
+func (c *checker) expr(e ast.Expression) Type {
+	return c.exprWith(e, nil)
+}
+
+// exprWith computes the type of e where a value of type expected is
+// wanted. The expected type, if not nil, only fills in what e itself
+// leaves open, such as the type argument of Err("..."); checking that
+// the two agree is up to the caller.
+func (c *checker) exprWith(e ast.Expression, expected Type) Type {
+	t := c.typeOf(e, expected)
+	if c.info != nil {
+		c.info.Types[e] = t
+	}
+	return t
+}
+
+func (c *checker) typeOf(e ast.Expression, expected Type) Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return Integer
+	case *ast.BigIntegerLiteral:
+		return BigInteger
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Boolean
+	case *ast.NullLiteral:
+		return Null
+
+	case *ast.Identifier:
+		v := c.scope.Lookup(e.Value)
+		if v == nil {
+			return Unknown // reported by name resolution
+		}
+		if v.IsType {
+			c.errorf(e.Token, "%s (type) is not an expression", e.Value)
+			return Unknown
+		}
+		return v.Type
+
+	case *ast.PrefixExpression:
+		right := c.expr(e.Right)
+		switch e.Operator {
+		case "!":
+			return Boolean
+		case "-", "~":
+			right = c.nonNull(e.Right, right)
+			if right == Unknown {
+				return Integer
+			}
+			if !IsInteger(Underlying(right)) {
+				c.errorf(e.Token, "invalid operation: operator %s not defined on %s (type %s)", e.Operator, e.Right, right)
+				return Integer
+			}
+			return right
+		}
+		c.errorf(e.Token, "unknown prefix operator %s", e.Operator)
+		return Unknown
+
+	case *ast.InfixExpression:
+		if e.Operator == "??" {
+			return c.coalesce(e, expected)
+		}
+		return c.binary(e, c.expr(e.Left), c.expr(e.Right))
+
+	case *ast.CallExpression:
+		return c.call(e, expected)
+
+	case *ast.MemberExpression:
+		return c.member(e)
+
+	case *ast.TryExpression:
+		return c.try(e, expected)
+
+	case *ast.ChannelExpression:
+		return c.channel(e)
+
+	case *ast.FunctionalLiteral:
+		// A lambda is checked where it is written, in the scope it
+		// closes over.
+		sig := c.signature(e)
+		c.functionBody(e, sig, nil)
+		return sig
+
+	case *ast.ComptimeExpression:
+		// The block is checked like the body of a function without
+		// parameters. Its value is only known once it is evaluated.
+		fl := &ast.FunctionalLiteral{Token: e.Token, FunctionName: &ast.Identifier{Token: e.Token, Value: "comptime"}, Body: e.Block}
+		c.functionBody(fl, &Signature{}, nil)
+		return Unknown
+	}
+	return Unknown
+}
+
+// channel checks chan[T](capacity).
+func (c *checker) channel(e *ast.ChannelExpression) Type {
+	if e.Capacity != nil {
+		if t := c.expr(e.Capacity); t != Unknown && t != Integer {
+			c.errorf(position(e.Capacity), "cannot use %s (type %s) as Integer in channel capacity", e.Capacity, t)
+		}
+	}
+	return c.resolve(e.Type)
+}
+
+// nonNull checks that e, of type t, is used where null is not allowed.
+// An optional value must be compared with null first. The result is the
+// type of the non-null values of t.
+func (c *checker) nonNull(e ast.Expression, t Type) Type {
+	if _, ok := t.(*Optional); ok {
+		c.errorf(position(e), "%s may be null (type %s); compare it with null first", e, t)
+	}
+	return NonNull(t)
+}
+
+// member checks x.name, or x?.name, which is null when x is.
+func (c *checker) member(e *ast.MemberExpression) Type {
+	object := c.expr(e.Object)
+	_, optional := object.(*Optional)
+	if e.Safe() {
+		object = NonNull(object)
+	} else {
+		object = c.nonNull(e.Object, object)
+	}
+
+	name := e.Member.Value
+	var typ Type = Unknown
+	switch o := object.(type) {
+	case *Module:
+		if o.Members == nil {
+			break // not known, so not checked
+		}
+		if t, ok := o.Members[name]; ok {
+			typ = t
+		} else {
+			c.errorf(e.Member.Token, "module %s has no exported member %s", o.Name, name)
+		}
+	case *Record:
+		if f := o.Field(name); f != nil {
+			typ = f.Type
+		} else if m, ok := o.Methods[name]; ok {
+			typ = m
+		} else {
+			c.errorf(e.Member.Token, "%s (type %s) has no field or method %s", e.Object, object, name)
+		}
+	case *Interface:
+		if m, ok := o.Methods[name]; ok {
+			typ = m
+		} else {
+			c.errorf(e.Member.Token, "%s (type %s) has no method %s", e.Object, object, name)
+		}
+	default:
+		if object != Unknown {
+			c.errorf(e.Member.Token, "%s (type %s) has no member %s", e.Object, object, name)
+		}
+	}
+	if optional && e.Safe() {
+		return NewOptional(typ)
+	}
+	return typ
+}
+
+// coalesce checks x ?? y, which is x unless x is null, and y otherwise.
+func (c *checker) coalesce(e *ast.InfixExpression, expected Type) Type {
+	var want Type
+	if expected != nil {
+		want = NewOptional(expected)
+	}
+	left := c.exprWith(e.Left, want)
+	if _, ok := left.(*Optional); !ok && left != Unknown && left != Null {
+		c.errorf(e.Token, "invalid operation: %s (type %s) is never null", e.Left, left)
+	}
+
+	elem := NonNull(left)
+	if expected == nil && elem != Unknown && elem != Null {
+		expected = elem
+	}
+	right := c.exprWith(e.Right, expected)
+	switch {
+	case left == Unknown || left == Null:
+		return right
+	case AssignableTo(right, elem):
+		return elem
+	case AssignableTo(right, left):
+		// The default may itself be null.
+		return left
+	}
+	c.errorf(e.Token, "mismatched types %s and %s in %s", left, right, e)
+	return elem
+}
+
+func (c *checker) try(e *ast.TryExpression, expected Type) Type {
+	var want Type
+	if expected != nil {
+		want = &Result{Value: expected}
+	}
+	operand := c.nonNull(e.Expression, c.exprWith(e.Expression, want))
+	if c.fn != nil && c.fn.Result != nil {
+		if _, ok := c.fn.Result.(*Result); !ok {
+			c.errorf(e.Token, "? used in %s, which returns %s rather than a Result", c.fnName, c.fn.Result)
+		}
+	}
+	switch operand := operand.(type) {
+	case *Result:
+		return operand.Value
+	}
+	if operand != Unknown {
+		c.errorf(e.Token, "? applied to %s (type %s), not a Result", e.Expression, operand)
+	}
+	return Unknown
+}
+
+func (c *checker) binary(e *ast.InfixExpression, left, right Type) Type {
+	op := e.Operator
+	if op == "==" || op == "!=" {
+		// An optional value may be compared with null, and with values
+		// of its element type.
+		if left == Null || right == Null {
+			c.nullComparison(e, left, right)
+			return Boolean
+		}
+		left, right = NonNull(left), NonNull(right)
+	} else {
+		left, right = c.nonNull(e.Left, left), c.nonNull(e.Right, right)
+	}
+
+	if op == "<<" || op == ">>" {
+		return c.shift(e, left, right)
+	}
+	if op == ".." || op == "..=" {
+		return c.rangeOf(e, left, right)
+	}
+
+	// An integer literal takes the fixed-width or named integer type of
+	// the other operand.
+	if _, ok := e.Right.(*ast.IntegerLiteral); ok && adoptsLiterals(left) {
+		right = left
+	}
+	if _, ok := e.Left.(*ast.IntegerLiteral); ok && adoptsLiterals(right) {
+		left = right
+	}
+
+	comparison := op == "==" || op == "!=" || op == "<" || op == ">" || op == "<=" || op == ">="
+
+	result := left
+	if left == Unknown {
+		result = right
+	}
+	if comparison {
+		result = Boolean
+	}
+	if left == Unknown || right == Unknown {
+		return result
+	}
+
+	if !Identical(left, right) {
+		c.errorf(e.Token, "mismatched types %s and %s in %s", left, right, e)
+		return result
+	}
+	if !supports(left, op) {
+		c.errorf(e.Token, "invalid operation: operator %s not defined on %s (type %s)", op, e.Left, left)
+	}
+	return result
+}
+
+func (c *checker) nullComparison(e *ast.InfixExpression, left, right Type) {
+	operand, typ := e.Left, left
+	if left == Null {
+		operand, typ = e.Right, right
+	}
+	if _, ok := typ.(*Optional); !ok && typ != Unknown && typ != Null {
+		c.errorf(e.Token, "invalid comparison: %s (type %s) is never null", operand, typ)
+	}
+}
+
+// adoptsLiterals reports whether an integer literal used with an
+// operand of type t takes type t.
+func adoptsLiterals(t Type) bool {
+	u := Underlying(t)
+	return IsSized(u) || (u == Integer && t != u)
+}
+
+// shift checks left << right or left >> right. The count may be an
+// integer of any type; the result has the type of left.
+func (c *checker) shift(e *ast.InfixExpression, left, right Type) Type {
+	if left != Unknown && !IsInteger(Underlying(left)) {
+		c.errorf(e.Token, "invalid operation: operator %s not defined on %s (type %s)", e.Operator, e.Left, left)
+	}
+	if right != Unknown && !IsInteger(Underlying(right)) {
+		c.errorf(e.Token, "invalid shift count %s (type %s)", e.Right, right)
+	}
+	return left
+}
+
+// rangeOf checks left..right or left..=right, whose bounds must be
+// Integers.
+func (c *checker) rangeOf(e *ast.InfixExpression, left, right Type) Type {
+	if left != Unknown && left != Integer {
+		c.errorf(e.Token, "invalid operation: operator %s not defined on %s (type %s)", e.Operator, e.Left, left)
+	} else if right != Unknown && right != Integer {
+		c.errorf(e.Token, "invalid operation: operator %s not defined on %s (type %s)", e.Operator, e.Right, right)
+	}
+	return Range
+}
+
+// supports reports whether operator op can be applied to two operands of
+// type t. A named type supports the operators of its underlying type.
+// For a type parameter, every type it may stand for must support op.
+func supports(t Type, op string) bool {
+	t = Underlying(t)
+	if tp, ok := t.(*TypeParam); ok {
+		if op == "==" || op == "!=" {
+			return true
+		}
+		if len(tp.Constraint) == 0 {
+			return false
+		}
+		for _, ct := range tp.Constraint {
+			if !supports(ct, op) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch op {
+	case "==", "!=":
+		return IsInteger(t) || t == String || t == Boolean
+	case "+", "<", ">", "<=", ">=":
+		return IsInteger(t) || t == String
+	case "-", "*", "/", "%", "&", "|", "^":
+		return IsInteger(t)
+	}
+	return false
+}
+
+func (c *checker) call(e *ast.CallExpression, expected Type) Type {
+	if ident, ok := e.Function.(*ast.Identifier); ok && ident.Value == "recover" && c.scope.Lookup("recover") == nil {
+		if len(e.Arguments) == 1 {
+			var want Type
+			if r, ok := expected.(*Result); ok {
+				want = r.Value
+			}
+			return &Result{Value: c.exprWith(e.Arguments[0], want)}
+		}
+		return Unknown
+	}
+
+	if ident, ok := e.Function.(*ast.Identifier); ok {
+		if v := c.scope.Lookup(ident.Value); v != nil && v.IsType {
+			if rec, ok := v.Type.(*Record); ok {
+				return c.construct(e, rec)
+			}
+			return c.conversion(e, v.Type)
+		}
+	}
+
+	callee := c.nonNull(e.Function, c.expr(e.Function))
+	sig, ok := callee.(*Signature)
+	if !ok {
+		for _, a := range e.Arguments {
+			c.expr(a)
+		}
+		if callee != Unknown {
+			c.errorf(position(e.Function), "cannot call non-function %s (type %s)", e.Function, callee)
+		}
+		return Unknown
+	}
+
+	args := make([]Type, len(e.Arguments))
+	for i, a := range e.Arguments {
+		var want Type
+		if len(sig.TypeParams) == 0 {
+			want = sig.param(i)
+		}
+		args[i] = c.exprWith(a, want)
+	}
+	c.arity(e, sig)
+
+	bindings := make(map[*TypeParam]Type)
+	for i, arg := range args {
+		param := sig.param(i)
+		if param == nil {
+			break
+		}
+		if len(sig.TypeParams) > 0 {
+			if msg := infer(param, arg, bindings); msg != "" {
+				c.errorf(position(e.Arguments[i]), "%s: %s", e.Function, msg)
+				continue
+			}
+			param = substitute(param, bindings)
+		}
+		if !AssignableTo(arg, param) {
+			c.errorf(position(e.Arguments[i]), "cannot use %s (type %s) as %s in argument to %s",
+				e.Arguments[i], arg, param, e.Function)
+		}
+	}
+
+	for _, tp := range sig.TypeParams {
+		if bound, ok := bindings[tp]; ok && !satisfies(bound, tp.Constraint) {
+			c.errorf(position(e.Function), "%s: %s does not satisfy %s", e.Function, bound, constraintString(tp))
+		}
+	}
+
+	if sig.Result == nil {
+		return Unknown
+	}
+	if expected != nil {
+		// Type parameters that only appear in the result, as in Err,
+		// take their type from the context. A mismatch is reported
+		// where the result is used.
+		infer(sig.Result, expected, bindings)
+	}
+	return substitute(sig.Result, bindings)
+}
+
+// conversion checks T(x), which converts x to type T. Values convert
+// between types with identical underlying types, and between integer
+// types of any kind.
+func (c *checker) conversion(e *ast.CallExpression, target Type) Type {
+	if len(e.Arguments) != 1 {
+		for _, a := range e.Arguments {
+			c.expr(a)
+		}
+		c.errorf(e.Token, "%s expects 1 argument, got %d", e.Function, len(e.Arguments))
+		return target
+	}
+
+	arg := c.expr(e.Arguments[0])
+	if iface, ok := target.(*Interface); ok {
+		if arg != Unknown {
+			if missing := MissingMethod(arg, iface); missing != "" {
+				c.errorf(position(e.Arguments[0]), "cannot convert %s (type %s) to %s: %s", e.Arguments[0], arg, target, missing)
+			}
+		}
+		return target
+	}
+	from, to := Underlying(arg), Underlying(target)
+	if arg != Unknown && target != Unknown && !Identical(from, to) && !(IsInteger(from) && IsInteger(to)) {
+		c.errorf(position(e.Arguments[0]), "cannot convert %s (type %s) to %s", e.Arguments[0], arg, target)
+	}
+	return target
+}
+
+// construct checks T(a, b), which builds a record of type T from the
+// values of its fields.
+func (c *checker) construct(e *ast.CallExpression, rec *Record) Type {
+	for i, a := range e.Arguments {
+		if i >= len(rec.Fields) {
+			c.expr(a)
+			continue
+		}
+		field := rec.Fields[i]
+		if arg := c.exprWith(a, field.Type); !AssignableTo(arg, field.Type) {
+			c.errorf(position(a), "cannot use %s (type %s) as %s in field %s of %s",
+				a, arg, field.Type, field.Name, rec)
+		}
+	}
+	if len(e.Arguments) != len(rec.Fields) {
+		c.errorf(e.Token, "%s expects %s, got %d", e.Function, arguments(len(rec.Fields)), len(e.Arguments))
+	}
+	return rec
+}
+
+func (c *checker) arity(e *ast.CallExpression, sig *Signature) {
+	got, want := len(e.Arguments), len(sig.Params)
+	if sig.Variadic {
+		if got < want-1 {
+			c.errorf(e.Token, "%s expects at least %s, got %d", e.Function, arguments(want-1), got)
+		}
+		return
+	}
+	if got != want {
+		c.errorf(e.Token, "%s expects %s, got %d", e.Function, arguments(want), got)
+	}
+}
+
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// infer binds the type parameters in param to the matching parts of
+// arg. It returns a message describing a conflicting binding, if any.
+func infer(param, arg Type, bindings map[*TypeParam]Type) string {
+	if arg == nil || arg == Unknown {
+		return ""
+	}
+	switch p := param.(type) {
+	case *TypeParam:
+		if bound, ok := bindings[p]; ok {
+			if !Identical(bound, arg) {
+				return fmt.Sprintf("type parameter %s inferred as both %s and %s", p.Name, bound, arg)
+			}
+			return ""
+		}
+		bindings[p] = arg
+	case *Tuple:
+		if a, ok := arg.(*Tuple); ok && len(a.Elements) == len(p.Elements) {
+			for i := range p.Elements {
+				if msg := infer(p.Elements[i], a.Elements[i], bindings); msg != "" {
+					return msg
+				}
+			}
+		}
+	case *Result:
+		if a, ok := arg.(*Result); ok {
+			return infer(p.Value, a.Value, bindings)
+		}
+	case *Generator:
+		if a, ok := arg.(*Generator); ok {
+			return infer(p.Elem, a.Elem, bindings)
+		}
+	case *Channel:
+		if a, ok := arg.(*Channel); ok {
+			return infer(p.Elem, a.Elem, bindings)
+		}
+	case *Sequence:
+		return infer(p.Elem, ElementType(arg), bindings)
+	case *Signature:
+		if a, ok := arg.(*Signature); ok && len(a.TypeParams) == 0 && len(a.Params) == len(p.Params) {
+			for i := range p.Params {
+				if msg := infer(p.Params[i], a.Params[i], bindings); msg != "" {
+					return msg
+				}
+			}
+			return infer(p.Result, a.Result, bindings)
+		}
+	case *Optional:
+		if arg != Null {
+			return infer(p.Elem, NonNull(arg), bindings)
+		}
+	}
+	return ""
+}
+
+// substitute replaces the type parameters in t with their bindings.
+// Parameters without a binding become Unknown.
+func substitute(t Type, bindings map[*TypeParam]Type) Type {
+	switch t := t.(type) {
+	case *TypeParam:
+		if bound, ok := bindings[t]; ok {
+			return bound
+		}
+		return Unknown
+	case *Tuple:
+		elements := make([]Type, len(t.Elements))
+		for i, el := range t.Elements {
+			elements[i] = substitute(el, bindings)
+		}
+		return &Tuple{Elements: elements}
+	case *Result:
+		return &Result{Value: substitute(t.Value, bindings)}
+	case *Generator:
+		return &Generator{Elem: substitute(t.Elem, bindings)}
+	case *Channel:
+		return &Channel{Elem: substitute(t.Elem, bindings)}
+	case *Sequence:
+		return &Sequence{Elem: substitute(t.Elem, bindings)}
+	case *Signature:
+		if len(t.TypeParams) > 0 {
+			return t
+		}
+		params := make([]Type, len(t.Params))
+		for i, p := range t.Params {
+			params[i] = substitute(p, bindings)
+		}
+		var result Type
+		if t.Result != nil {
+			result = substitute(t.Result, bindings)
+		}
+		return &Signature{Params: params, Result: result, Variadic: t.Variadic}
+	case *Optional:
+		return NewOptional(substitute(t.Elem, bindings))
+	}
+	return t
+}
+
+func satisfies(t Type, constraint []Type) bool {
+	if len(constraint) == 0 || t == Unknown {
+		return true
+	}
+	for _, allowed := range constraint {
+		if Identical(t, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func constraintString(tp *TypeParam) string {
+	if len(tp.Constraint) == 0 {
+		return tp.Name
+	}
+	s := tp.Name + " "
+	for i, t := range tp.Constraint {
+		if i > 0 {
+			s += " | "
+		}
+		s += t.String()
+	}
+	return s
+}
+
+// position returns the token an error about e should point at.
+func position(e ast.Expression) token.Token {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		return e.Token
+	case *ast.IntegerLiteral:
+		return e.Token
+	case *ast.StringLiteral:
+		return e.Token
+	case *ast.Boolean:
+		return e.Token
+	case *ast.NullLiteral:
+		return e.Token
+	case *ast.PrefixExpression:
+		return e.Token
+	case *ast.InfixExpression:
+		return position(e.Left)
+	case *ast.CallExpression:
+		return position(e.Function)
+	case *ast.MemberExpression:
+		return position(e.Object)
+	case *ast.TryExpression:
+		return position(e.Expression)
+	case *ast.ChannelExpression:
+		return e.Token
+	case *ast.FunctionalLiteral:
+		return e.Token
+	}
+	return token.Token{}
+}
@@ -0,0 +1,596 @@
+package types_test
+
+import (
+	"strings"
+	"testing"
+
+	"compiler/ast"
+	"compiler/lexer"
+	"compiler/parser"
+	"compiler/token"
+	"compiler/types"
+)
+
+func check(t *testing.T, input string) []*types.Error {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return types.Check(program, nil)
+}
+
+func TestWellTypedPrograms(t *testing.T) {
+	tests := []string{
+		`func Integer add(Integer a, Integer b) { return a + b; }
+		 func Integer main() { return add(1, 2); }`,
+		`func String greet(String name) { return "hi " + name; }`,
+		`func (Integer, String) pair() { return 1, "a"; }
+		 func Integer main() { let n, s = pair(); return n; }`,
+		`func T max[T Integer | String](T a, T b) { if (a > b) { return a; } return b; }
+		 func Integer main() { let String s = max("a", "b"); return max(1, 2); }`,
+		`func Result[Integer] half(Integer n) { if (n == 1) { return Err("odd"); } return Ok(n / 2); }
+		 func Result[Integer] quarter(Integer n) { let Integer h = half(n)?; return half(h); }`,
+		`func Integer main() { let Result[Integer] r = recover(1 / 0); return unwrapOr(r, 0); }`,
+		`func Integer untyped(x) { return x * 2; }`,
+		`func UInt8 low(Int32 n) { return Byte(n & 255); }
+		 func Int32 f(Int32 n) { return ~n << 2 | n >> 1 ^ 7 + n; }
+		 func Integer main() { let Byte b = low(Int32(300)) + 1; return Integer(b); }`,
+		`func BigInteger big(BigInteger n) { return -n * 2n % BigInteger(n); }
+		 func Integer main() { return Integer(big(3n)); }`,
+		`func Integer sum(...Integer nums) { return len(nums); }
+		 func Integer main() { return sum() + sum(1) + sum(1, 2, 3); }`,
+		`func T first[T](T a, ...T rest) { return a; }
+		 func Integer main() { return first(1, 2, 3); }`,
+	}
+	for _, input := range tests {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`let Integer x = "a";`, `line 1:13: cannot use "a" (type String) as Integer in let x`},
+		{`let Integer x = 1; x = true;`, "line 1:20: cannot use true (type Boolean) as Integer in assignment to x"},
+		{`const x = 1; x = 2;`, "line 1:14: cannot assign to constant x"},
+		{`1 + "a";`, "line 1:3: mismatched types Integer and String in (1 + \"a\")"},
+		{`"a" - "b";`, "line 1:5: invalid operation: operator - not defined on \"a\" (type String)"},
+		{`"a" % "b";`, "line 1:5: invalid operation: operator % not defined on \"a\" (type String)"},
+		{`Int32(1) + Int64(1);`, "line 1:10: mismatched types Int32 and Int64 in (Int32(1) + Int64(1))"},
+		{`let Int32 x = 1;`, "line 1:11: cannot use 1 (type Integer) as Int32 in let x"},
+		{`"a" << 1;`, `line 1:5: invalid operation: operator << not defined on "a" (type String)`},
+		{`~true;`, "line 1:1: invalid operation: operator ~ not defined on true (type Boolean)"},
+		{`1n + 1;`, "line 1:4: mismatched types BigInteger and Integer in (1n + 1)"},
+		{`if (1) { }`, "line 1:5: non-boolean condition in if statement (type Integer)"},
+		{`func Integer f() { return "a"; }`, `line 1:20: cannot use "a" (type String) as Integer in return from f`},
+		{`func Integer f() { return; }`, "line 1:20: missing return value: f returns Integer"},
+		{`func (Integer, Integer) f() { return 1, "a"; }`, "line 1:31: cannot use (Integer, String) as (Integer, Integer) in return from f"},
+		{`func f(Integer n) { } f("a");`, `line 1:25: cannot use "a" (type String) as Integer in argument to f`},
+		{`func Foo f() { }`, "line 1:6: undefined type Foo"},
+		{`func T f[T](T a, T b) { return a + b; }`, "line 1:34: invalid operation: operator + not defined on a (type T)"},
+		{`func T f[T Integer](T a) { return a; } f("a");`, "line 1:40: f: String does not satisfy T Integer"},
+		{`func T f[T](T a, T b) { return a; } f(1, "a");`, "line 1:42: f: type parameter T inferred as both Integer and String"},
+		{`func Integer f() { return 1; } func Result[Integer] g() { return f()?; }`, "line 1:69: ? applied to f() (type Integer), not a Result"},
+		{`func Integer g() { return Ok(1)?; }`, "line 1:32: ? used in g, which returns Integer rather than a Result"},
+		{`func Integer f() { return 1; } let a, b = f();`, "line 1:32: assignment mismatch: 2 names but 1 value"},
+		{`let Integer x = 1; x();`, "line 1:20: cannot call non-function x (type Integer)"},
+		{`func Integer add(a, b) { return a + b; } add(1);`, "line 1:45: add expects 2 arguments, got 1"},
+		{`func f(n) { } f(1, 2);`, "line 1:16: f expects 1 argument, got 2"},
+		{`Ok();`, "line 1:3: Ok expects 1 argument, got 0"},
+		{`func f(String s, ...Integer n) { } f();`, "line 1:37: f expects at least 1 argument, got 0"},
+		{`func f(...Integer n) { } f(1, "a");`, `line 1:31: cannot use "a" (type String) as Integer in argument to f`},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestAllErrorsAreReported(t *testing.T) {
+	errs := check(t, `let Integer a = "x"; let String b = 1;`)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(errs), errs)
+	}
+	for _, err := range errs {
+		if !strings.Contains(err.Error(), "cannot use") {
+			t.Errorf("unexpected error %q", err)
+		}
+	}
+}
+
+func TestUnknownPrefixOperator(t *testing.T) {
+	// The parser rejects such operators, so the expression is built by
+	// hand.
+	program := &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{
+		Expression: &ast.PrefixExpression{
+			Token:    token.Token{Type: token.TokenOperator, Lexeme: "*", Line: 1, Column: 1},
+			Operator: "*",
+			Right:    &ast.IntegerLiteral{Value: 5},
+		},
+	}}}
+	errs := types.Check(program, nil)
+	if len(errs) != 1 || errs[0].Error() != "line 1:1: unknown prefix operator *" {
+		t.Errorf("errors = %v; want [line 1:1: unknown prefix operator *]", errs)
+	}
+}
+
+func TestLetTakesTypeOfInitializer(t *testing.T) {
+	errs := check(t, `let x = 1; x = "a";`)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	want := `line 1:12: cannot use "a" (type String) as Integer in assignment to x`
+	if got := errs[0].Error(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestInferredTypesAreRecorded(t *testing.T) {
+	input := `
+func (Integer, String) pair() { return 1, "a"; }
+func Result[Integer] f(Integer n) {
+	let doubled = n * 2;
+	let big = doubled > 10;
+	let n2, s = pair();
+	if (big) {
+		return Err("too big");
+	}
+	return Ok(doubled);
+}
+`
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	info := types.NewInfo()
+	if errs := types.Check(program, info); len(errs) > 0 {
+		t.Fatalf("type errors: %v", errs)
+	}
+
+	want := map[string]string{
+		"(n * 2)":        "Integer",
+		"doubled":        "Integer",
+		"(doubled > 10)": "Boolean",
+		"big":            "Boolean",
+		"pair()":         "(Integer, String)",
+		`Err("too big")`: "Result[Integer]",
+		"Ok(doubled)":    "Result[Integer]",
+		`"too big"`:      "String",
+		"Err":            "func(Unknown) Result[T]",
+	}
+	got := make(map[string]string)
+	for e, typ := range info.Types {
+		got[e.String()] = typ.String()
+	}
+	for expr, typ := range want {
+		if got[expr] != typ {
+			t.Errorf("type of %s = %q; want %q", expr, got[expr], typ)
+		}
+	}
+}
+
+func TestNullSafety(t *testing.T) {
+	ok := []string{
+		`func Integer? find(Integer n) { if (n > 0) { return n; } return null; }
+		 func Integer main() {
+			let Integer? x = find(1);
+			if (x != null) { return x + 1; }
+			return 0;
+		 }`,
+		`func Integer f(Integer? x) { if (x == null) { return 0; } return x * 2; }`,
+		`func Integer f(Integer? x) { if (null == x) { return 0; } else { return -x; } }`,
+		`func Integer f(Integer? x, Integer? y) { let Integer? z = y ?? x; return x ?? y ?? 0; }`,
+		`func Boolean f(Integer? x) { return x == 1; }`,
+		`func f(Integer? x) { if (x != null) { x = null; } }`,
+		`func Integer f(Integer? x) { if (x != null) { x = null; } if (x == null) { x = 1; return 0; } return x; }`,
+		`func Integer f(Integer? x) { if (x == null) { return 0; } let y = x + 1; x = y; return y; }`,
+		`func T f[T](T? x, T fallback) { return x ?? fallback; }
+		 func Integer main() { return f(null, 1) + f(find(), 2); }
+		 func Integer? find() { return 3; }`,
+	}
+	for _, input := range ok {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`let Integer x = null;`, "line 1:13: cannot use null (type Null) as Integer in let x"},
+		{`func Integer f(Integer? x) { return x + 1; }`, "line 1:37: x may be null (type Integer?); compare it with null first"},
+		{`func Integer f(Integer? x) { return x; }`, "line 1:30: cannot use x (type Integer?) as Integer in return from f"},
+		{`func f(Integer n) { } func g(Integer? x) { f(x); }`, "line 1:46: cannot use x (type Integer?) as Integer in argument to f"},
+		{`func f(Integer? x) { if (x != null) { } x - 1; }`, "line 1:41: x may be null (type Integer?); compare it with null first"},
+		{`func f(Integer? x) { if (x == null) { x - 1; } }`, "line 1:39: x may be null (type Integer?); compare it with null first"},
+		{`func f(Integer? x) { if (x != null) { x = "a"; } }`, `line 1:39: cannot use "a" (type String) as Integer? in assignment to x`},
+		{`func Integer f(Integer? x) { if (x != null) { x = null; return x + 1; } return 0; }`, "line 1:64: x may be null (type Integer?); compare it with null first"},
+		{`func f(Integer? x) { if (x == null) { return; } for (true) { x + 1; x = null; } }`, "line 1:62: x may be null (type Integer?); compare it with null first"},
+		{`let Integer? g = 5; func clear() { g = null; } func Integer f() { if (g != null) { clear(); return g + 1; } return 0; }`,
+			"line 1:100: g may be null (type Integer?); compare it with null first"},
+		{`func Integer f() { let Integer? x = 1; let clear = () => { x = null; }; if (x != null) { clear(); return x + 1; } return 0; }`,
+			"line 1:106: x may be null (type Integer?); compare it with null first"},
+		{`func Integer f(Integer? x) { if (x != null) { return x + 1; } func g() { x = null; } return 0; }`,
+			"line 1:54: x may be null (type Integer?); compare it with null first"},
+		{`func f(Integer x) { if (x != null) { } }`, "line 1:27: invalid comparison: x (type Integer) is never null"},
+		{`func f(Integer x) { x ?? 0; }`, "line 1:23: invalid operation: x (type Integer) is never null"},
+		{`func f(Integer? x) { x ?? "a"; }`, `line 1:24: mismatched types Integer? and String in (x ?? "a")`},
+		{`let x = null;`, "line 1:5: cannot infer the type of x from null; declare it with an optional type"},
+		{`func f(Integer? x) { -x; }`, "line 1:23: x may be null (type Integer?); compare it with null first"},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNamedTypes(t *testing.T) {
+	ok := []string{
+		`type Meters Integer;
+		 func Meters add(Meters a, Meters b) { return a + b * 2 - 1; }
+		 func Integer main() { let Meters m = add(Meters(1), Meters(2)); return Integer(m); }`,
+		`type UserID = Integer; func UserID next(UserID id) { return id + 1; } let Integer n = next(5);`,
+		`func Km f(Meters m) { return Km(m) << 1; } type Meters Integer; type Km Meters;`,
+		`type Name String; func Boolean f(Name n) { return n == Name("ada"); }`,
+		`type Flag Boolean; if (Flag(true)) { }`,
+		`type Level Int8; let Level l = Level(3) + 100;`,
+	}
+	for _, input := range ok {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`type Meters Integer; type Feet Integer; Meters(1) + Feet(2);`,
+			"line 1:51: mismatched types Meters and Feet in (Meters(1) + Feet(2))"},
+		{`type Meters Integer; let Meters m = 5;`, "line 1:33: cannot use 5 (type Integer) as Meters in let m"},
+		{`type Meters Integer; func f(Integer n) { } f(Meters(1));`,
+			"line 1:46: cannot use Meters(1) (type Meters) as Integer in argument to f"},
+		{`type Name String; Name(1);`, "line 1:24: cannot convert 1 (type Integer) to Name"},
+		{`type Name String; Name("a") - Name("b");`, `line 1:29: invalid operation: operator - not defined on Name("a") (type Name)`},
+		{`type Meters Integer; let x = Meters;`, "line 1:30: Meters (type) is not an expression"},
+		{`type Meters Integer; Meters(1, 2);`, "line 1:28: Meters expects 1 argument, got 2"},
+		{`type Bad Missing;`, "line 1:10: undefined type Missing"},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	ok := []string{
+		`interface Shape { Integer area(); }
+		 record Rect { Integer w; Integer h; func Integer area() { return self.w * self.h; } }
+		 func Integer total(Shape a, Shape b) { return a.area() + b.area(); }
+		 func Integer main() { let Shape s = Rect(1, 2); return total(s, Rect(3, 4)); }`,
+		`record Node { Integer value; Node? next; }
+		 func Integer sum(Node? n) { if (n == null) { return 0; } return n.value + sum(n.next); }`,
+		`interface Named { String name(); }
+		 interface Shape { Integer area(); String name(); }
+		 record Dot { func Integer area() { return 0; } func String name() { return "dot"; } }
+		 func String f(Shape s) { let Named n = s; return n.name(); }
+		 func Integer g(Shape s) { switch (s) { case Dot d { return d.area(); } case Named n { return 1; } default { return 2; } } }`,
+	}
+	for _, input := range ok {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+
+	decls := `interface Shape { Integer area(); }
+record Rect { Integer w; func Integer area() { return self.w; } }
+record Text { String s; func String area() { return self.s; } }
+`
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`let Shape s = Text("a");`, `line 4:11: cannot use Text("a") (type Text) as Shape in let s`},
+		{`let Shape s = 1;`, "line 4:11: cannot use 1 (type Integer) as Shape in let s"},
+		{`Shape(Text("a"));`, `line 4:7: cannot convert Text("a") (type Text) to Shape: method area has type func() String, want func() Integer`},
+		{`Rect("a");`, `line 4:6: cannot use "a" (type String) as Integer in field w of Rect`},
+		{`Rect();`, "line 4:5: Rect expects 1 argument, got 0"},
+		{`Rect(1).h;`, "line 4:9: Rect(1) (type Rect) has no field or method h"},
+		{`let Shape s = Rect(1); s.w;`, "line 4:26: s (type Shape) has no method w"},
+		{`let Shape s = Rect(1); switch (s) { case Text t { } }`, "line 4:42: impossible type switch case: s (type Shape) cannot have type Text (method area has type func() String, want func() Integer)"},
+		{`switch (1) { }`, "line 4:9: 1 (type Integer) is not an interface"},
+		{`let Shape s = Rect(1); switch (s) { case Rect r { let String x = r.w; } }`, "line 4:62: cannot use r.w (type Integer) as String in let x"},
+		{`record P { Integer x; String x; }`, "line 4:30: x redeclared in record P"},
+		{`Rect(1) == Rect(1);`, "line 4:9: invalid operation: operator == not defined on Rect(1) (type Rect)"},
+		{`record Q { func Integer f() { return self.g; } }`, "line 4:43: self (type Q) has no field or method g"},
+	}
+	for _, tt := range tests {
+		errs := check(t, decls+tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestForIn(t *testing.T) {
+	ok := []string{
+		`func Integer sum(Integer n) { let s = 0; for (i in 0..n) { s = s + i; } return s; }`,
+		`let Range r = 1..=3; for (i in r) { let Integer j = i; }`,
+		`record Words { func String? next() { return null; } }
+		 for (w in Words()) { let String s = w + "!"; }`,
+		`interface Iterator { Integer? next(); }
+		 func Integer total(Iterator it) { let s = 0; for (n in it) { s = s + n; } return s; }`,
+		`func f(xs) { for (x in xs) { x + 1; } }`,
+		`func (Integer, Integer) pair() { return 1, 2; }
+		 for (n in pair()) { let Integer m = n; }`,
+		`func (Integer, String) pair() { return 1, "a"; }
+		 for (x in pair()) { }`,
+		`func Integer sum(...Integer ns) { let s = 0; for (n in ns) { s = s + n; } return s; }`,
+	}
+	for _, input := range ok {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`for (c in "abc") { }`, `line 1:11: cannot range over "abc" (type String)`},
+		{`0.."a";`, `line 1:2: invalid operation: operator .. not defined on "a" (type String)`},
+		{`Int32(0)..=3;`, "line 1:9: invalid operation: operator ..= not defined on Int32(0) (type Int32)"},
+		{`for (i in 0..3) { let String s = i; }`, "line 1:30: cannot use i (type Integer) as String in let s"},
+		{`let Range? r = null; for (i in r) { }`, "line 1:32: r may be null (type Range?); compare it with null first"},
+		{`record R { func Integer next() { return 0; } } for (i in R()) { }`, "line 1:58: cannot range over R() (type R)"},
+		{"func (Integer, Integer) pair() { return 1, 2; }\nfor (n in pair()) { let String s = n; }", "line 2:32: cannot use n (type Integer) as String in let s"},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	ok := []string{
+		`func Generator[Integer] count(Integer n) { for (i in 0..n) { yield i; } }
+		 func Integer sum() { let s = 0; for (i in count(3)) { s = s + i; } return s; }`,
+		`func Generator[String] words() { yield "a"; return; }
+		 func String first() { return unwrapOr(next(words()), ""); }`,
+		`func gen() { yield 1; yield "a"; } let g = gen(); for (x in g) { }`,
+		`func Integer total(Generator[Integer] g) { let s = 0; for (n in g) { s = s + n; } return s; }`,
+	}
+	for _, input := range ok {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`func Generator[Integer] g() { yield "a"; }`, `line 1:37: cannot use "a" (type String) as Integer in yield from g`},
+		{`func Integer g() { yield 1; }`, "line 1:6: generator g must return Generator[T], not Integer"},
+		{`func Generator[Integer] g() { yield 1; return 1; }`, "line 1:40: generator g cannot return a value"},
+		{`func Generator[Integer] g() { yield 1; } let String s = unwrap(next(g()));`, "line 1:53: cannot use unwrap(next(g())) (type Integer) as String in let s"},
+		{`func Generator[Integer] g() { yield 1; } for (s in g()) { let String t = s; }`, "line 1:70: cannot use s (type Integer) as String in let t"},
+		{`let Generator g = 1;`, "line 1:5: Generator expects 1 type argument, got 0"},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestChannels(t *testing.T) {
+	ok := []string{
+		`func worker(chan[Integer] jobs, chan[String] out) { for (j in jobs) { send(out, "done"); } }
+		 func main() { let jobs = chan[Integer](2); let out = chan[String](); spawn worker(jobs, out); send(jobs, 1); close(jobs); wait(); }`,
+		`let c = chan[Integer](1); let Result[Integer] n = recv(c); let Integer m = unwrapOr(recv(c), 0);`,
+		`let c = chan[Integer](1); select { case recv(c) v { let Integer n = unwrapOr(v, 0); } case send(c, 2) { } default { } }`,
+	}
+	for _, input := range ok {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`let c = chan[Integer](); send(c, "a");`, "line 1:34: send: type parameter T inferred as both Integer and String"},
+		{`let c = chan[Integer](); let Integer n = recv(c);`, "line 1:38: cannot use recv(c) (type Result[Integer]) as Integer in let n"},
+		{`let c = chan[Integer]("a");`, `line 1:23: cannot use "a" (type String) as Integer in channel capacity`},
+		{`let chan[String] c = chan[Integer]();`, "line 1:18: cannot use chan[Integer]() (type chan[Integer]) as chan[String] in let c"},
+		{`let c = chan[Integer](); select { case recv(c) v { let Integer n = v; } }`, "line 1:64: cannot use v (type Result[Integer]) as Integer in let n"},
+		{`let c = chan[Integer](); for (s in c) { let String x = s; }`, "line 1:52: cannot use s (type Integer) as String in let x"},
+		{`func f(Integer n) { } spawn f("a");`, `line 1:31: cannot use "a" (type String) as Integer in argument to f`},
+		{`let c = chan(1);`, "line 1:9: chan expects 1 type argument, got 0"},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLambdas(t *testing.T) {
+	ok := []string{
+		`let double = (Integer x) => x * 2; let Integer n = double(3);`,
+		`func isEven(Integer n) { return n % 2 == 0; } let r = 0..10 |> filter(isEven) |> map((x) => x * 2);`,
+		`let f = (x) => { if (x) { return 1; } return 2; };`,
+	}
+	for _, input := range ok {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`let f = (Integer x) => x + "a";`, `line 1:26: mismatched types Integer and String in (x + "a")`},
+		{`let f = (Integer x) => x; f("a");`, `line 1:29: cannot use "a" (type String) as Integer in argument to f`},
+		{`let f = (Integer x) => x; "a" |> f;`, `line 1:27: cannot use "a" (type String) as Integer in argument to f`},
+		{`let String s = (x) => x;`, "line 1:12: cannot use (x) => x (type func(Unknown)) as String in let s"},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestComptimeBlocks(t *testing.T) {
+	ok := []string{
+		`func Integer square(Integer n) { return n * n; } const K = comptime { return square(4); };`,
+		`const N = comptime { let s = 0; for (i in 0..4) { s = s + i; } return s; };`,
+	}
+	for _, input := range ok {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`func Integer f(Integer x) { return x; } const K = comptime { return f("s"); };`, `line 1:71: cannot use "s" (type String) as Integer in argument to f`},
+		{`const K = comptime { let Integer n = "a"; return n; };`, `line 1:34: cannot use "a" (type String) as Integer in let n`},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestPipelines(t *testing.T) {
+	ok := []string{
+		`func Integer double(Integer n) { return n * 2; } for (n in 1..=3 |> map(double)) { let Integer m = n; }`,
+		`func String name(Integer n) { return "n"; } let names = map(0..3, name); for (s in names) { let String t = s + "!"; }`,
+		`func Generator[String] words() { yield "a"; } for (w in words() |> filter((String w) => w != "")) { let String s = w; }`,
+		`for (x in 0..3 |> map((x) => x) |> filter((x) => true)) { }`,
+	}
+	for _, input := range ok {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("check(%q) = %v; want no errors", input, errs)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`func Boolean long(String s) { return true; } 0..3 |> filter(long);`, "line 1:61: filter: type parameter T inferred as both Integer and String"},
+		{`func String name(Integer n) { return "n"; } for (s in 0..3 |> map(name)) { let Integer n = s; }`, "line 1:88: cannot use s (type String) as Integer in let n"},
+		{`func Integer count(Integer n) { return n; } 0..3 |> filter(count);`, "line 1:60: cannot use count (type func(Integer) Integer) as func(Integer) Boolean in argument to filter"},
+		{`0..3 |> map((String s) => s + "!");`, "line 1:13: map: type parameter T inferred as both Integer and String"},
+		{`func String name(Integer n) { return "n"; } 0..3 |> map(name) |> map((Integer n) => n + 1);`, "line 1:70: map: type parameter T inferred as both String and Integer"},
+		{`map(5, (x) => x);`, "line 1:5: cannot use 5 (type Integer) as Sequence[Unknown] in argument to map"},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		if len(errs) == 0 {
+			t.Errorf("check(%q): no errors; want %q", tt.input, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestImportedMembers(t *testing.T) {
+	importer := func(path string) map[string]types.Type {
+		if path != "util" {
+			return nil
+		}
+		return map[string]types.Type{
+			"twice":  &types.Signature{Params: []types.Type{types.Integer}, Result: types.Integer},
+			"Answer": types.Integer,
+		}
+	}
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`import "util"; let Integer n = util.twice(util.Answer);`, ""},
+		{`import "other"; let n = other.anything(1, "a");`, ""},
+		{`import "util"; util.twice("x");`, `line 1:27: cannot use "x" (type String) as Integer in argument to util.twice`},
+		{`import "util"; let String s = util.Answer;`, "line 1:27: cannot use util.Answer (type Integer) as String in let s"},
+		{`import "util"; util.thrice(1);`, "line 1:21: module util has no exported member thrice"},
+	}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		errs := types.CheckImports(p.ParseProgram(), nil, importer)
+		got := ""
+		if len(errs) > 0 {
+			got = errs[0].Error()
+		}
+		if got != tt.want {
+			t.Errorf("check(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package types
+
+// Var is a name declared in a scope. A type name is declared as a Var
+// with IsType set, whose Type is the type it names.
+type Var struct {
+	Name   string
+	Type   Type
+	Const  bool
+	IsType bool
+
+	owner   *Signature // the function the variable is local to, if any
+	narrows *Var       // the declaration a narrowed variable stands for
+}
+
+// Scope maps names to their declarations. Scopes nest the same way the
+// evaluator's environments do.
+type Scope struct {
+	parent *Scope
+	vars   map[string]*Var
+}
+
+func NewScope(parent *Scope) *Scope {
+	return &Scope{parent: parent, vars: make(map[string]*Var)}
+}
+
+// Lookup finds name in s or the scopes enclosing it.
+func (s *Scope) Lookup(name string) *Var {
+	for sc := s; sc != nil; sc = sc.parent {
+		if v, ok := sc.vars[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// Declare adds v to s, replacing any declaration of the same name in s.
+func (s *Scope) Declare(v *Var) {
+	s.vars[v.Name] = v
+}
+
+// Universe is the outermost scope, holding the builtin functions.
+var Universe = newUniverse()
+
+func newUniverse() *Scope {
+	s := NewScope(nil)
+	t := &TypeParam{Name: "T"}
+	u := &TypeParam{Name: "U"}
+	anyResult := &Result{Value: Unknown}
+
+	builtins := map[string]*Signature{
+		"Ok":       {TypeParams: []*TypeParam{t}, Params: []Type{t}, Result: &Result{Value: t}},
+		"Err":      {TypeParams: []*TypeParam{t}, Params: []Type{Unknown}, Result: &Result{Value: t}},
+		"isOk":     {Params: []Type{anyResult}, Result: Boolean},
+		"isErr":    {Params: []Type{anyResult}, Result: Boolean},
+		"unwrap":   {TypeParams: []*TypeParam{t}, Params: []Type{&Result{Value: t}}, Result: t},
+		"unwrapOr": {TypeParams: []*TypeParam{t}, Params: []Type{&Result{Value: t}, t}, Result: t},
+		"message":  {Params: []Type{anyResult}, Result: String},
+		"panic":    {Params: []Type{Unknown}},
+		"len":      {Params: []Type{Unknown}, Result: Integer},
+		"at":       {Params: []Type{Unknown, Integer}, Result: anyResult},
+		"div":      {Params: []Type{Integer, Integer}, Result: &Result{Value: Integer}},
+		"next":     {TypeParams: []*TypeParam{t}, Params: []Type{&Generator{Elem: t}}, Result: &Result{Value: t}},
+		"collect":  {Params: []Type{Unknown}, Result: Unknown},
+		"map":      {TypeParams: []*TypeParam{t, u}, Params: []Type{&Sequence{Elem: t}, &Signature{Params: []Type{t}, Result: u}}, Result: &Sequence{Elem: u}},
+		"filter":   {TypeParams: []*TypeParam{t}, Params: []Type{&Sequence{Elem: t}, &Signature{Params: []Type{t}, Result: Boolean}}, Result: &Sequence{Elem: t}},
+		"send":     {TypeParams: []*TypeParam{t}, Params: []Type{&Channel{Elem: t}, t}},
+		"recv":     {TypeParams: []*TypeParam{t}, Params: []Type{&Channel{Elem: t}}, Result: &Result{Value: t}},
+		"close":    {Params: []Type{Unknown}},
+		"wait":     {},
+
+		"Integer":    {Params: []Type{Unknown}, Result: Integer},
+		"BigInteger": {Params: []Type{Unknown}, Result: BigInteger},
+
+		"wrapping_add": {Params: []Type{Integer, Integer}, Result: Integer},
+		"wrapping_sub": {Params: []Type{Integer, Integer}, Result: Integer},
+		"wrapping_mul": {Params: []Type{Integer, Integer}, Result: Integer},
+	}
+	// Each sized integer type converts integers of any type to it.
+	for _, name := range []string{"Int8", "Int16", "Int32", "Int64", "UInt8", "UInt16", "UInt32", "UInt64", "Byte"} {
+		builtins[name] = &Signature{Params: []Type{Unknown}, Result: predeclared[name]}
+	}
+	for name, sig := range builtins {
+		s.Declare(&Var{Name: name, Type: sig})
+	}
+	return s
+}
@@ -0,0 +1,380 @@
+// Package types implements static type checking of Blue programs.
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Type is the static type of a Blue value.
+type Type interface {
+	String() string
+}
+
+// Basic is a predeclared type such as Integer.
+type Basic struct {
+	name string
+}
+
+func (b *Basic) String() string { return b.name }
+
+var (
+	Integer    = &Basic{"Integer"}
+	BigInteger = &Basic{"BigInteger"}
+	String     = &Basic{"String"}
+	Boolean    = &Basic{"Boolean"}
+
+	Int8   = &Basic{"Int8"}
+	Int16  = &Basic{"Int16"}
+	Int32  = &Basic{"Int32"}
+	Int64  = &Basic{"Int64"}
+	UInt8  = &Basic{"UInt8"}
+	UInt16 = &Basic{"UInt16"}
+	UInt32 = &Basic{"UInt32"}
+	UInt64 = &Basic{"UInt64"}
+
+	// Range is the type of the range expressions a..b and a..=b, whose
+	// elements are Integers.
+	Range = &Basic{"Range"}
+
+	// Null is the type of the null literal. It is only assignable to
+	// optional types.
+	Null = &Basic{"Null"}
+
+	// Unknown is the type of values the checker cannot see into, such as
+	// untyped parameters. It is compatible with every other type, and
+	// operations on it are left to be checked at run time.
+	Unknown = &Basic{"Unknown"}
+)
+
+// predeclared maps the names of the builtin types to them. Byte is
+// another name for UInt8.
+var predeclared = map[string]Type{
+	"Integer": Integer, "BigInteger": BigInteger, "String": String, "Boolean": Boolean, "Range": Range,
+	"Int8": Int8, "Int16": Int16, "Int32": Int32, "Int64": Int64,
+	"UInt8": UInt8, "UInt16": UInt16, "UInt32": UInt32, "UInt64": UInt64,
+	"Byte": UInt8,
+}
+
+// IsSized reports whether t is a fixed-width integer type such as Int32.
+func IsSized(t Type) bool {
+	switch t {
+	case Int8, Int16, Int32, Int64, UInt8, UInt16, UInt32, UInt64:
+		return true
+	}
+	return false
+}
+
+// IsInteger reports whether t is an integer type of any size.
+func IsInteger(t Type) bool {
+	return t == Integer || t == BigInteger || IsSized(t)
+}
+
+// Tuple is the type of several values returned together.
+type Tuple struct {
+	Elements []Type
+}
+
+func (t *Tuple) String() string {
+	return "(" + joinTypes(t.Elements) + ")"
+}
+
+// Named is a distinct type defined by a type declaration such as
+// type Meters Integer. Its values are represented like those of its
+// underlying type, but it is not identical to any other type.
+type Named struct {
+	Name       string
+	Underlying Type
+}
+
+func (n *Named) String() string { return n.Name }
+
+// Underlying returns the type a named type is defined in terms of, and t
+// itself for every other type.
+func Underlying(t Type) Type {
+	if n, ok := t.(*Named); ok {
+		return n.Underlying
+	}
+	return t
+}
+
+// Record is a record type: named fields, and methods called on its
+// values.
+type Record struct {
+	Name    string
+	Fields  []*Var
+	Methods map[string]*Signature
+}
+
+func (r *Record) String() string { return r.Name }
+
+// Field returns the field called name, or nil.
+func (r *Record) Field(name string) *Var {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Interface is an interface type, a set of methods. A type implements
+// it by having methods with the same names and signatures.
+type Interface struct {
+	Name    string
+	Methods map[string]*Signature
+}
+
+func (i *Interface) String() string { return i.Name }
+
+// methods returns the methods of t, or nil if it has none.
+func methods(t Type) map[string]*Signature {
+	switch t := t.(type) {
+	case *Record:
+		return t.Methods
+	case *Interface:
+		return t.Methods
+	}
+	return nil
+}
+
+// ElementType returns the type of the elements a for-in loop over a
+// value of type t yields, or nil if t cannot be ranged over. Besides
+// ranges, generators and channels, a record or interface with a method next() T? is an iterator
+// of values of type T. The elements of a tuple have its element types
+// if they are all identical, and are Unknown otherwise.
+func ElementType(t Type) Type {
+	u := Underlying(t)
+	if u == Range {
+		return Integer
+	}
+	switch u := u.(type) {
+	case *Generator:
+		return u.Elem
+	case *Channel:
+		return u.Elem
+	case *Sequence:
+		return u.Elem
+	case *Tuple:
+		if len(u.Elements) == 0 {
+			return Unknown
+		}
+		for _, el := range u.Elements[1:] {
+			if !Identical(el, u.Elements[0]) {
+				return Unknown
+			}
+		}
+		return u.Elements[0]
+	}
+	next := methods(u)["next"]
+	if next == nil || len(next.Params) > 0 {
+		return nil
+	}
+	if opt, ok := next.Result.(*Optional); ok {
+		return opt.Elem
+	}
+	return nil
+}
+
+// MissingMethod returns a description of the first method of iface, in
+// name order, that t lacks or has with a different signature. It
+// returns "" if t implements iface.
+func MissingMethod(t Type, iface *Interface) string {
+	names := make([]string, 0, len(iface.Methods))
+	for name := range iface.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	have := methods(t)
+	for _, name := range names {
+		m, ok := have[name]
+		switch {
+		case !ok:
+			return "missing method " + name
+		case !Identical(m, iface.Methods[name]):
+			return fmt.Sprintf("method %s has type %s, want %s", name, m, iface.Methods[name])
+		}
+	}
+	return ""
+}
+
+// Optional is T?, the type of values that are either of type T or null.
+type Optional struct {
+	Elem Type
+}
+
+func (o *Optional) String() string { return o.Elem.String() + "?" }
+
+// NewOptional returns the optional type of t. T?? is the same as T?.
+func NewOptional(t Type) Type {
+	if _, ok := t.(*Optional); ok || t == Unknown {
+		return t
+	}
+	return &Optional{Elem: t}
+}
+
+// NonNull returns the type of the values of t other than null.
+func NonNull(t Type) Type {
+	if o, ok := t.(*Optional); ok {
+		return o.Elem
+	}
+	return t
+}
+
+// Result is Result[T], the type of Ok and Err values.
+type Result struct {
+	Value Type
+}
+
+func (r *Result) String() string { return "Result[" + r.Value.String() + "]" }
+
+// Generator is Generator[T], the type of the generators that yield
+// values of type T.
+type Generator struct {
+	Elem Type
+}
+
+func (g *Generator) String() string { return "Generator[" + g.Elem.String() + "]" }
+
+// Sequence is the type map and filter take and return: any value a
+// for-in loop can range over whose elements have type Elem.
+type Sequence struct {
+	Elem Type
+}
+
+func (s *Sequence) String() string { return "Sequence[" + s.Elem.String() + "]" }
+
+// Channel is chan[T], the type of channels of values of type T.
+type Channel struct {
+	Elem Type
+}
+
+func (c *Channel) String() string { return "chan[" + c.Elem.String() + "]" }
+
+// TypeParam is a type parameter of a generic function. An empty
+// constraint allows any type.
+type TypeParam struct {
+	Name       string
+	Constraint []Type
+}
+
+func (tp *TypeParam) String() string { return tp.Name }
+
+// Signature is the type of a function.
+type Signature struct {
+	TypeParams []*TypeParam
+	Params     []Type
+	Result     Type // nil when the function declares no return type
+
+	// Variadic is set when the last parameter takes any number of
+	// arguments, each of its type.
+	Variadic bool
+}
+
+// param returns the type expected of argument i, or nil if there is no
+// such parameter.
+func (s *Signature) param(i int) Type {
+	n := len(s.Params)
+	switch {
+	case i < n && !(s.Variadic && i == n-1):
+		return s.Params[i]
+	case s.Variadic:
+		return s.Params[n-1]
+	}
+	return nil
+}
+
+func (s *Signature) String() string {
+	var out strings.Builder
+	out.WriteString("func(")
+	params := joinTypes(s.Params)
+	if s.Variadic {
+		params = joinTypes(s.Params[:len(s.Params)-1])
+		if len(s.Params) > 1 {
+			params += ", "
+		}
+		params += "..." + s.Params[len(s.Params)-1].String()
+	}
+	out.WriteString(params)
+	out.WriteString(")")
+	if s.Result != nil {
+		out.WriteString(" ")
+		out.WriteString(s.Result.String())
+	}
+	return out.String()
+}
+
+// Module is the type of an imported module. Members holds the types of
+// the names it exports, and is nil if they are not known.
+type Module struct {
+	Name    string
+	Members map[string]Type
+}
+
+func (m *Module) String() string { return "module " + m.Name }
+
+func joinTypes(types []Type) string {
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = t.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Identical reports whether a and b are the same type.
+func Identical(a, b Type) bool {
+	return a.String() == b.String()
+}
+
+// AssignableTo reports whether a value of type v can be used where a
+// value of type t is expected.
+func AssignableTo(v, t Type) bool {
+	if v == Unknown || t == Unknown {
+		return true
+	}
+	switch t := t.(type) {
+	case *Tuple:
+		vt, ok := v.(*Tuple)
+		if !ok || len(vt.Elements) != len(t.Elements) {
+			return false
+		}
+		for i := range t.Elements {
+			if !AssignableTo(vt.Elements[i], t.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Result:
+		vr, ok := v.(*Result)
+		return ok && AssignableTo(vr.Value, t.Value)
+	case *Optional:
+		return v == Null || AssignableTo(NonNull(v), t.Elem)
+	case *Interface:
+		return MissingMethod(v, t) == ""
+	case *Sequence:
+		elem := ElementType(v)
+		return elem != nil && AssignableTo(elem, t.Elem)
+	case *Signature:
+		return assignableSignature(v, t)
+	}
+	return Identical(v, t)
+}
+
+// assignableSignature reports whether a function of type v can be
+// called as one of type t: each argument of t's parameter types must be
+// assignable to v's, and v's result to t's. A function that declares
+// no result may return anything.
+func assignableSignature(v Type, t *Signature) bool {
+	vs, ok := v.(*Signature)
+	if !ok || len(vs.Params) != len(t.Params) || vs.Variadic != t.Variadic || len(vs.TypeParams) > 0 {
+		return Identical(v, t)
+	}
+	for i := range t.Params {
+		if !AssignableTo(t.Params[i], vs.Params[i]) {
+			return false
+		}
+	}
+	return vs.Result == nil || t.Result == nil || AssignableTo(vs.Result, t.Result)
+}